@@ -0,0 +1,126 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/config"
+	"github.com/urfave/cli"
+)
+
+const configValuesKey = "configValues"
+
+// Flags selecting the config file and the named target in it
+func configFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:  "config, c",
+			Usage: "Config file setting options by their long flag names (default: \"" + config.DefaultFile + "\" in the current directory, if it exists)",
+		},
+		cli.StringFlag{
+			Name:  "target",
+			Usage: "Named target in the config file whose options override the top-level options of the config file",
+		},
+	}
+}
+
+// Environment variable setting a flag, for example IMG2LAMBDA_OUTPUT_DIRECTORY for --output-directory
+func envVarName(flagName string) string {
+	return "IMG2LAMBDA_" + strings.ToUpper(strings.Replace(longFlagName(flagName), "-", "_", -1))
+}
+
+// Long name of a flag named like "output-directory, o"
+func longFlagName(flagName string) string {
+	return strings.TrimSpace(strings.Split(flagName, ",")[0])
+}
+
+// Allows setting each flag with an IMG2LAMBDA_* environment variable
+func withEnvVars(flags []cli.Flag) []cli.Flag {
+	for i, flag := range flags {
+		switch f := flag.(type) {
+		case cli.StringFlag:
+			f.EnvVar = envVarName(f.Name)
+			flags[i] = f
+		case cli.BoolFlag:
+			f.EnvVar = envVarName(f.Name)
+			flags[i] = f
+		case cli.StringSliceFlag:
+			f.EnvVar = envVarName(f.Name)
+			flags[i] = f
+		case cli.DurationFlag:
+			f.EnvVar = envVarName(f.Name)
+			flags[i] = f
+		case cli.Int64Flag:
+			f.EnvVar = envVarName(f.Name)
+			flags[i] = f
+		}
+	}
+	return flags
+}
+
+// Loads the config file and checks that it only sets options of the app or its commands
+func loadConfig(c *cli.Context) error {
+	file, err := config.LoadDefault(c.String("config"))
+	if err != nil {
+		return err
+	}
+	if file == nil {
+		if c.String("target") != "" {
+			return fmt.Errorf("target %s requires a config file", c.String("target"))
+		}
+		return nil
+	}
+
+	values, err := file.Values(c.String("target"))
+	if err != nil {
+		return err
+	}
+
+	known := map[string]bool{"config": true, "target": true}
+	addFlagNames(known, c.App.Flags)
+	for _, command := range c.App.Commands {
+		addFlagNames(known, command.Flags)
+	}
+	for name := range values {
+		if !known[name] {
+			return fmt.Errorf("unknown option %s in config file", name)
+		}
+	}
+
+	c.App.Metadata[configValuesKey] = values
+	return nil
+}
+
+func addFlagNames(names map[string]bool, flags []cli.Flag) {
+	for _, flag := range flags {
+		names[longFlagName(flag.GetName())] = true
+	}
+}
+
+// Sets the flags that were not set on the command line nor by environment variables from the config file
+func applyConfig(c *cli.Context, flags []cli.Flag) error {
+	values, _ := c.App.Metadata[configValuesKey].(map[string][]string)
+	if len(values) == 0 {
+		return nil
+	}
+
+	// Setting a flag resets which flags are considered set, so determine which to apply first
+	unset := []string{}
+	for _, flag := range flags {
+		name := longFlagName(flag.GetName())
+		if _, found := values[name]; found && !c.IsSet(name) {
+			unset = append(unset, name)
+		}
+	}
+
+	for _, name := range unset {
+		for _, value := range values[name] {
+			if err := c.Set(name, value); err != nil {
+				return fmt.Errorf("invalid value %s for option %s in config file: %v", value, name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli"
+)
+
+const testConfig = `
+output-directory: ./from-config
+region: us-west-2
+compatible-runtime: [python3.8, python3.7]
+targets:
+  prod:
+    region: eu-west-1
+`
+
+// Runs the app with the arguments and a config file, without converting an image.
+// Returns the options and the compatible runtimes that the conversion would use.
+func runApp(t *testing.T, args ...string) (*types.CmdOptions, []string, error) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "img2lambda.yaml")
+	require.NoError(t, ioutil.WriteFile(configFile, []byte(testConfig), 0644))
+
+	app, opts := createApp(context.Background())
+	var runtimes []string
+	app.Action = func(c *cli.Context) error {
+		runtimes = c.StringSlice("cr")
+		return nil
+	}
+	err = app.Run(append([]string{"img2lambda", "--config", configFile}, args...))
+	return opts, runtimes, err
+}
+
+func TestConfigFileSetsOptions(t *testing.T) {
+	opts, runtimes, err := runApp(t, "-i", "image")
+	require.NoError(t, err)
+	assert.Equal(t, "./from-config", opts.OutputDir)
+	assert.Equal(t, "us-west-2", opts.Region)
+	assert.Equal(t, []string{"python3.8", "python3.7"}, runtimes)
+
+	// Options that are not in the config file keep their defaults
+	assert.Equal(t, "img2lambda", opts.LayerNamespace)
+}
+
+func TestOptionPrecedence(t *testing.T) {
+	os.Setenv("IMG2LAMBDA_OUTPUT_DIRECTORY", "./from-env")
+	defer os.Unsetenv("IMG2LAMBDA_OUTPUT_DIRECTORY")
+	os.Setenv("IMG2LAMBDA_REGION", "us-east-2")
+	defer os.Unsetenv("IMG2LAMBDA_REGION")
+	os.Setenv("IMG2LAMBDA_COMPATIBLE_RUNTIME", "nodejs12.x")
+	defer os.Unsetenv("IMG2LAMBDA_COMPATIBLE_RUNTIME")
+
+	// Environment variables override the config file
+	opts, runtimes, err := runApp(t, "-i", "image")
+	require.NoError(t, err)
+	assert.Equal(t, "./from-env", opts.OutputDir)
+	assert.Equal(t, "us-east-2", opts.Region)
+	assert.Equal(t, []string{"nodejs12.x"}, runtimes)
+
+	// Flags override environment variables and the config file
+	opts, runtimes, err = runApp(t, "-i", "image", "--output-directory", "./from-flag", "-r", "ap-south-1", "--cr", "go1.x")
+	require.NoError(t, err)
+	assert.Equal(t, "./from-flag", opts.OutputDir)
+	assert.Equal(t, "ap-south-1", opts.Region)
+	assert.Equal(t, []string{"go1.x"}, runtimes)
+}
+
+func TestConfigTarget(t *testing.T) {
+	// The target's options override the top-level options of the config file
+	opts, _, err := runApp(t, "-i", "image", "--target", "prod")
+	require.NoError(t, err)
+	assert.Equal(t, "eu-west-1", opts.Region)
+	assert.Equal(t, "./from-config", opts.OutputDir)
+
+	// Flags override the target's options
+	opts, _, err = runApp(t, "-i", "image", "--target", "prod", "-r", "ap-south-1")
+	require.NoError(t, err)
+	assert.Equal(t, "ap-south-1", opts.Region)
+
+	_, _, err = runApp(t, "-i", "image", "--target", "staging")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "target staging not found in config file (available targets: [prod])")
+}
@@ -0,0 +1,130 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/converter"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/diff"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
+	"github.com/urfave/cli"
+)
+
+func diffCommand(ctx context.Context, opts *types.CmdOptions) cli.Command {
+	return cli.Command{
+		Name:  "diff",
+		Usage: "Compares the Lambda layers and function deployment package of two images, showing which layers would be republished",
+		Flags: withEnvVars([]cli.Flag{
+			cli.StringSliceFlag{
+				Name:  "image, i",
+				Usage: "Name or path of a source container image. Specify the old image first and the new image second: -i my-image:1.0 -i my-image:1.1",
+				Value: &cli.StringSlice{},
+			},
+			cli.StringFlag{
+				Name:        "image-type, t",
+				Usage:       "Type of the source container images. Valid values: 'docker' (Docker image from the local Docker daemon), 'oci' (OCI image archive at the given path), 'docker-archive' (image archive created by 'docker save' at the given path), 'oci-dir' (OCI image layout directory at the given path, with an optional :tag), 'dir' (image directory at the given path, as written by 'skopeo copy'), 'containers-storage' (image in the local containers storage used by podman), 'auto' (detect the type of the archive or directory at the given path, otherwise use the Docker daemon)",
+				Value:       "docker",
+				Destination: &opts.ImageType,
+			},
+			cli.StringFlag{
+				Name:        "format, f",
+				Usage:       "Output format. Valid values: 'table', 'json'",
+				Value:       "table",
+				Destination: &opts.OutputFormat,
+			},
+		}),
+		Before: func(c *cli.Context) error {
+			if err := applyConfig(c, c.Command.Flags); err != nil {
+				return err
+			}
+			validateCommandOptions(c, opts, validateRepackOptions)
+			return nil
+		},
+		Action: func(c *cli.Context) error {
+			return runWithTimeout(ctx, opts.Timeout, func(ctx context.Context) error {
+				return diffImagesAction(ctx, opts, c)
+			})
+		},
+	}
+}
+
+func diffImagesAction(ctx context.Context, opts *types.CmdOptions, c *cli.Context) error {
+	images := c.StringSlice("image")
+	if len(images) != 2 {
+		fmt.Print("ERROR: Exactly two images are required\n\n")
+		cli.ShowCommandHelpAndExit(c, "diff", 1)
+	}
+
+	if opts.OutputFormat != "table" && opts.OutputFormat != "json" {
+		fmt.Print("ERROR: Output format must be one of the supported formats\n\n")
+		cli.ShowCommandHelpAndExit(c, "diff", 1)
+	}
+
+	var imageLocations []string
+	for _, image := range images {
+		imageLocation, err := converter.ImageReference(image, opts.ImageType)
+		if err != nil {
+			fmt.Println("ERROR: " + err.Error())
+			cli.ShowCommandHelpAndExit(c, "diff", 1)
+		}
+		imageLocations = append(imageLocations, imageLocation)
+	}
+
+	extractOpts, err := extractOptions(opts)
+	if err != nil {
+		return err
+	}
+	imageDiff, err := diff.DiffImages(ctx, imageLocations[0], imageLocations[1], extractOpts)
+	if err != nil {
+		return err
+	}
+
+	if opts.OutputFormat == "json" {
+		contents, err := json.MarshalIndent(imageDiff, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(contents))
+		return nil
+	}
+
+	return printDiffTable(os.Stdout, imageDiff)
+}
+
+func printDiffTable(out io.Writer, imageDiff *types.ImageDiff) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(w, "LAMBDA LAYERS (%s -> %s)\n", imageDiff.OldImage, imageDiff.NewImage)
+	fmt.Fprintf(w, "  STATUS\tIMAGE LAYER\tCODE SHA256\tSIZE\n")
+	for _, layer := range imageDiff.Layers {
+		size := "-"
+		if layer.Status != types.LayerRemoved {
+			size = fmt.Sprintf("%d", layer.CodeSize)
+		}
+		digest := layer.Digest
+		if layer.Part > 0 {
+			digest = fmt.Sprintf("%s (part %d)", layer.Digest, layer.Part)
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", layer.Status, digest, layer.CodeSha256, size)
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintf(w, "FUNCTION DEPLOYMENT PACKAGE (%d files unchanged)\n", imageDiff.Function.UnchangedCount)
+	for _, name := range imageDiff.Function.Added {
+		fmt.Fprintf(w, "  added\t%s\n", name)
+	}
+	for _, name := range imageDiff.Function.Removed {
+		fmt.Fprintf(w, "  removed\t%s\n", name)
+	}
+	for _, name := range imageDiff.Function.Modified {
+		fmt.Fprintf(w, "  modified\t%s\n", name)
+	}
+
+	return w.Flush()
+}
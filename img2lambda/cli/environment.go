@@ -0,0 +1,75 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/converter"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/extract"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
+	"github.com/urfave/cli"
+)
+
+func environmentManifestCommand(ctx context.Context, opts *types.CmdOptions) cli.Command {
+	return cli.Command{
+		Name:  "environment-manifest",
+		Usage: "Records the files and packages that a Lambda base image, like public.ecr.aws/lambda/python:3.8, provides to functions, as a manifest for --environment-manifest",
+		Flags: withEnvVars(append(imageFlags(opts),
+			cli.StringFlag{
+				Name:  "environment, e",
+				Usage: "Name of the execution environment, like 'python', 'nodejs', 'provided' or 'provided.al2'. Python and Node.js modules are only recorded for the environments of those runtimes",
+			},
+			cli.StringSliceFlag{
+				Name:  "environment-runtime",
+				Usage: "Runtime that runs in the execution environment, like 'python3.8'. To specify multiple runtimes, repeat the option",
+				Value: &cli.StringSlice{},
+			},
+		)),
+		Before: func(c *cli.Context) error {
+			return applyConfig(c, c.Command.Flags)
+		},
+		Action: func(c *cli.Context) error {
+			return runWithTimeout(ctx, opts.Timeout, func(ctx context.Context) error {
+				return environmentManifestAction(ctx, opts, c)
+			})
+		},
+	}
+}
+
+func environmentManifestAction(ctx context.Context, opts *types.CmdOptions, c *cli.Context) error {
+	if opts.Image == "" {
+		fmt.Print("ERROR: Image name is required\n\n")
+		cli.ShowCommandHelpAndExit(c, "environment-manifest", 1)
+	}
+
+	name := c.String("environment")
+	if name == "" {
+		fmt.Print("ERROR: Environment name is required\n\n")
+		cli.ShowCommandHelpAndExit(c, "environment-manifest", 1)
+	}
+
+	imageLocation, err := converter.ImageReference(opts.Image, opts.ImageType)
+	if err != nil {
+		fmt.Println("ERROR: " + err.Error())
+		cli.ShowCommandHelpAndExit(c, "environment-manifest", 1)
+	}
+
+	extractOpts, err := extractOptions(opts)
+	if err != nil {
+		return err
+	}
+	manifest, err := extract.DescribeEnvironment(ctx, imageLocation, name, c.StringSlice("environment-runtime"), extractOpts)
+	if err != nil {
+		return err
+	}
+
+	contents, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(contents))
+	return nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/converter"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/extract"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
+	"github.com/urfave/cli"
+)
+
+func inspectCommand(ctx context.Context, opts *types.CmdOptions) cli.Command {
+	return cli.Command{
+		Name:  "inspect",
+		Usage: "Shows which files in each image layer would be repackaged into Lambda layers and the function deployment package, repackaging the image into a temporary directory instead of the output directory",
+		Flags: withEnvVars(append(imageFlags(opts),
+			cli.StringFlag{
+				Name:        "format, f",
+				Usage:       "Output format. Valid values: 'table', 'json'",
+				Value:       "table",
+				Destination: &opts.OutputFormat,
+			},
+		)),
+		Before: func(c *cli.Context) error {
+			if err := applyConfig(c, c.Command.Flags); err != nil {
+				return err
+			}
+			validateCommandOptions(c, opts, validateRepackOptions)
+			return nil
+		},
+		Action: func(c *cli.Context) error {
+			return runWithTimeout(ctx, opts.Timeout, func(ctx context.Context) error {
+				return inspectImageAction(ctx, opts, c)
+			})
+		},
+	}
+}
+
+func inspectImageAction(ctx context.Context, opts *types.CmdOptions, c *cli.Context) error {
+	if opts.Image == "" {
+		fmt.Print("ERROR: Image name is required\n\n")
+		cli.ShowCommandHelpAndExit(c, "inspect", 1)
+	}
+
+	if opts.OutputFormat != "table" && opts.OutputFormat != "json" {
+		fmt.Print("ERROR: Output format must be one of the supported formats\n\n")
+		cli.ShowCommandHelpAndExit(c, "inspect", 1)
+	}
+
+	imageLocation, err := converter.ImageReference(opts.Image, opts.ImageType)
+	if err != nil {
+		fmt.Println("ERROR: " + err.Error())
+		cli.ShowCommandHelpAndExit(c, "inspect", 1)
+	}
+
+	extractOpts, err := extractOptions(opts)
+	if err != nil {
+		return err
+	}
+	inspection, err := extract.InspectImage(ctx, imageLocation, extractOpts)
+	if err != nil {
+		return err
+	}
+
+	if opts.OutputFormat == "json" {
+		contents, err := json.MarshalIndent(inspection, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(contents))
+		return nil
+	}
+
+	return printInspectionTable(os.Stdout, inspection)
+}
+
+func printInspectionTable(out io.Writer, inspection *types.ImageInspection) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+
+	for i, layer := range inspection.Layers {
+		size := "unknown"
+		if layer.Size >= 0 {
+			size = fmt.Sprintf("%d", layer.Size)
+		}
+		fmt.Fprintf(w, "IMAGE LAYER %d/%d  %s  %s  %s bytes\n", i+1, len(inspection.Layers), layer.Digest, layer.MediaType, size)
+		if layer.Skipped != "" {
+			fmt.Fprintf(w, "  (skipped: %s)\n\n", layer.Skipped)
+			continue
+		}
+		fmt.Fprintf(w, "  DESTINATION\tTYPE\tSIZE\tPATH\n")
+
+		for _, f := range layer.LayerFiles {
+			fmt.Fprintf(w, "  lambda layer\t%s\t%d\t%s\n", f.Type, f.Size, f.Path)
+		}
+		for _, f := range layer.FunctionFiles {
+			fmt.Fprintf(w, "  function\t%s\t%d\t%s\n", f.Type, f.Size, f.Path)
+		}
+		for _, f := range layer.RemovedFiles {
+			fmt.Fprintf(w, "  removed\t%s\t%d\t%s\n", f.Type, f.Size, f.Path)
+		}
+		for _, path := range layer.Whiteouts {
+			fmt.Fprintf(w, "  skipped (whiteout)\t-\t-\t%s\n", path)
+		}
+		for _, f := range layer.IgnoredEntries {
+			fmt.Fprintf(w, "  ignored\t%s\t%d\t%s\n", f.Type, f.Size, f.Path)
+		}
+		fmt.Fprintf(w, "  (%d other files outside of /opt and /var/task)\n\n", layer.OtherFileCount)
+	}
+
+	if len(inspection.BundledLibraries) > 0 {
+		fmt.Fprintf(w, "BUNDLED LIBRARIES\n")
+		for _, soname := range inspection.BundledLibraries {
+			fmt.Fprintf(w, "  %s\n", soname)
+		}
+	}
+
+	return w.Flush()
+}
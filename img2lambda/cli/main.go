@@ -3,20 +3,24 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
+	"io"
 	"os"
-	"strings"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/extract"
-	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/publish"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/converter"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/logging"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/progress"
 	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
 	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/version"
 	"github.com/urfave/cli"
 )
 
-func createApp() (*cli.App, *types.CmdOptions) {
+func createApp(ctx context.Context) (*cli.App, *types.CmdOptions) {
 	opts := types.CmdOptions{}
 
 	app := cli.NewApp()
@@ -24,25 +28,46 @@ func createApp() (*cli.App, *types.CmdOptions) {
 	app.Name = "img2lambda"
 	app.Version = version.VersionString()
 	app.Usage = "Repackages a container image into an AWS Lambda function deployment package. Extracts AWS Lambda layers from the image and publishes them to Lambda"
-	app.Action = func(c *cli.Context) error {
-		// parse and store the passed runtime list into the options object
-		opts.CompatibleRuntimes = c.StringSlice("cr")
+	app.Before = func(c *cli.Context) error {
+		if err := loadConfig(c); err != nil {
+			return err
+		}
+		if err := applyConfig(c, c.App.Flags); err != nil {
+			return err
+		}
+
+		logger, err := logging.NewFromOptions(opts.LogFormat, opts.Quiet, opts.Verbose)
+		if err != nil {
+			return err
+		}
+		opts.Logger = logger
 
+		// Progress bars would be interleaved with debug messages and JSON log lines,
+		// so progress is logged instead unless logging plain text at info level
+		if !opts.Quiet {
+			var terminal io.Writer
+			if progress.IsTerminal(os.Stderr) && opts.LogFormat == logging.FormatText && !opts.Verbose {
+				terminal = os.Stderr
+			}
+			opts.Progress = progress.New(logger, terminal)
+		}
+
+		// parse and store the passed lists into the options object, which the commands use too
+		opts.CompatibleRuntimes = c.StringSlice("cr")
+		opts.IncludeLayers = c.StringSlice("include-layer")
+		opts.ExcludeLayers = c.StringSlice("exclude-layer")
+		opts.PrependLayerArns = c.StringSlice("prepend-layer-arn")
+		opts.AppendLayerArns = c.StringSlice("append-layer-arn")
+		opts.KeepFiles = c.StringSlice("keep-file")
+		return nil
+	}
+	app.Action = func(c *cli.Context) error {
 		validateCliOptions(&opts, c)
-		return repackImageAction(&opts, c)
+		return runWithTimeout(ctx, opts.Timeout, func(ctx context.Context) error {
+			return repackImageAction(ctx, &opts, c)
+		})
 	}
-	app.Flags = []cli.Flag{
-		cli.StringFlag{
-			Name:        "image, i",
-			Usage:       "Name or path of the source container image. For example, 'my-docker-image:latest' or './my-oci-image-archive'. The image must be pulled locally already.",
-			Destination: &opts.Image,
-		},
-		cli.StringFlag{
-			Name:        "image-type, t",
-			Usage:       "Type of the source container image. Valid values: 'docker' (Docker image from the local Docker daemon), 'oci' (OCI image archive at the given path)",
-			Value:       "docker",
-			Destination: &opts.ImageType,
-		},
+	app.Flags = withEnvVars(append(append(configFlags(), imageFlags(&opts)...),
 		cli.StringFlag{
 			Name:        "region, r",
 			Usage:       "AWS region",
@@ -56,7 +81,7 @@ func createApp() (*cli.App, *types.CmdOptions) {
 		},
 		cli.StringFlag{
 			Name:        "output-directory, o",
-			Usage:       "Destination directory for output: function deployment package (function.zip) and list of published layers (layers.json, layers.yaml)",
+			Usage:       "Destination directory for output: function deployment package (function.zip), list of published layers (layers.json, layers.yaml), their provenance (provenance.json) and lock (img2lambda.lock), report of the run (report.json) and conversion manifest for the publish command (conversion.json)",
 			Value:       "./output",
 			Destination: &opts.OutputDir,
 		},
@@ -66,6 +91,11 @@ func createApp() (*cli.App, *types.CmdOptions) {
 			Value:       "img2lambda",
 			Destination: &opts.LayerNamespace,
 		},
+		cli.StringFlag{
+			Name:        "layer-name-template",
+			Usage:       "Go template for the names of the layers published to Lambda, for example '{{.Namespace}}-{{.ShortDigest}}'. Variables: .Namespace, .Image, .ManifestDigest, .Digest, .DigestHex, .ShortDigest, .Part, .Index, .ToolVersion, .Timestamp (default: \"{{.Namespace}}-sha256-{{.DigestHex}}\")",
+			Destination: &opts.LayerNameTemplate,
+		},
 		cli.BoolFlag{
 			Name:        "dry-run, d",
 			Usage:       "Conduct a dry-run: Repackage the image, but only write the Lambda layers to local disk (do not publish to Lambda)",
@@ -73,7 +103,7 @@ func createApp() (*cli.App, *types.CmdOptions) {
 		},
 		cli.StringFlag{
 			Name:        "description, desc",
-			Usage:       "The description of this layer version (default: \"created by img2lambda from image <name of the image>\")",
+			Usage:       "The description of this layer version. It is a Go template with the same variables as --layer-name-template if it contains {{ and parses as one, otherwise literal text (default: \"created by img2lambda from image {{.Image}}\")",
 			Destination: &opts.Description,
 		},
 		cli.StringFlag{
@@ -86,73 +116,327 @@ func createApp() (*cli.App, *types.CmdOptions) {
 			Usage: "An AWS Lambda function runtime compatible with the image layers. To specify multiple runtimes, repeat the option: --cr provided --cr python2.7 (default: \"provided\")",
 			Value: &cli.StringSlice{},
 		},
-	}
+		cli.BoolFlag{
+			Name:        "sbom",
+			Usage:       "Write a CycloneDX software bill of materials for each Lambda layer (named after the image layer digest, for example sha256-<digest>.cdx.json) and for the function deployment package (function.cdx.json) to the output directory. Packages are detected from Python, Node.js, Ruby, Maven and Debian package metadata; RPM databases are not read",
+			Destination: &opts.SBOM,
+		},
+		cli.StringFlag{
+			Name:        "secrets-allowlist",
+			Usage:       "File listing potential secrets that may be packaged into the Lambda layers and function. Files are scanned for AWS access keys, private keys, npm tokens, .env files and .git directories, and signing or publishing fails if any are found. Each line is a glob matching file paths in the image, optionally preceded by a rule ID, for example 'opt/app/.env.example' or 'private-key opt/certs/test-*.pem'",
+			Destination: &opts.SecretsAllowlist,
+		},
+		cli.BoolFlag{
+			Name:        "flatten-whiteouts",
+			Usage:       "Merge the Lambda layers of image layers that delete files under /opt of earlier image layers, so that the deleted files are not in the Lambda layers. Without this option, deleted files stay in the earlier Lambda layers and a warning is logged, because Lambda layers cannot delete files",
+			Destination: &opts.FlattenWhiteouts,
+		},
+		cli.Int64Flag{
+			Name:        "max-layer-size",
+			Usage:       "Split Lambda layer zip files larger than this many megabytes into several Lambda layers, keeping the files of each top-level directory under /opt together where possible (default: no limit)",
+			Destination: &opts.MaxLayerSizeMB,
+		},
+		cli.BoolFlag{
+			Name:        "separate-extensions",
+			Usage:       "Move the Lambda extensions in /opt/extensions into a dedicated Lambda layer, which is listed first and named after a digest of its files, so that the extensions are versioned separately from the rest of the image",
+			Destination: &opts.SeparateExtensions,
+		},
+		cli.BoolFlag{
+			Name:        "bundle-libraries",
+			Usage:       "Copy the shared libraries that repackaged binaries need from the library directories of the image, like /usr/lib64, into lib/ of an additional Lambda layer, unless the Lambda execution environment provides them",
+			Destination: &opts.BundleLibraries,
+		},
+		cli.BoolFlag{
+			Name:        "prune-environment-files",
+			Usage:       "Do not repackage files that the Lambda execution environment already provides with the same contents, like the AWS SDK, at the same path where the --runtime loads modules or libraries from. Requires --environment-manifest",
+			Destination: &opts.PruneEnvironment,
+		},
+		cli.StringFlag{
+			Name:        "environment-manifest",
+			Usage:       "Manifest of the files of the execution environment to prune, written by 'img2lambda environment-manifest' from the Lambda base image of the runtime. Requires --prune-environment-files",
+			Destination: &opts.EnvironmentManifest,
+		},
+		cli.StringSliceFlag{
+			Name:  "keep-file",
+			Usage: "Path pattern of files to repackage even if the execution environment provides them, like '/var/task/boto3/**'. To specify multiple patterns, repeat the option",
+			Value: &cli.StringSlice{},
+		},
+		cli.StringFlag{
+			Name:        "runtime",
+			Usage:       "Runtime of the function, like 'python3.8' or 'provided'. The repackaged function and layers are checked before publishing: custom runtimes need an executable /var/task/bootstrap or /opt/bootstrap, and the file of the --handler must exist",
+			Destination: &opts.Runtime,
+		},
+		cli.StringFlag{
+			Name:        "handler",
+			Usage:       "Handler of the function, like 'hello.hello', whose file must be in the repackaged function or layers, like hello.py for Python runtimes. Requires --runtime",
+			Destination: &opts.Handler,
+		},
+		cli.StringFlag{
+			Name:        "handler-file",
+			Usage:       "Go template for the path of the handler file, relative to /var/task unless it starts with /, for custom runtimes or handler conventions that img2lambda does not know, for example 'src/{{.Function}}.php'. Variables: .Handler, .Module (up to the last dot), .Function (after the last dot). Without it, the handler file of a custom runtime is not checked. Requires --handler",
+			Destination: &opts.HandlerFile,
+		},
+		cli.StringFlag{
+			Name:        "base-image",
+			Usage:       "Image that the source image is built from (with FROM), of the same --image-type. Its layers are skipped, so that only the layers added by the source image are published",
+			Destination: &opts.BaseImage,
+		},
+		cli.StringFlag{
+			Name:        "base-layers",
+			Usage:       "layers.json written when publishing the base image, whose layer ARNs are listed before the published layers in layers.json and layers.yaml. Requires --base-image",
+			Destination: &opts.BaseLayersFile,
+		},
+		cli.StringSliceFlag{
+			Name:  "include-layer",
+			Usage: "Only repackage the image layers matching this selector: a layer number starting at 1, a layer digest (compressed or uncompressed, as listed by 'docker inspect'), or 'created-by:<regular expression>' matching the command that created the layer in the image history. To specify multiple selectors, repeat the option (default: all layers)",
+			Value: &cli.StringSlice{},
+		},
+		cli.StringSliceFlag{
+			Name:  "exclude-layer",
+			Usage: "Do not repackage the image layers matching this selector, in the same format as --include-layer. To specify multiple selectors, repeat the option",
+			Value: &cli.StringSlice{},
+		},
+		cli.StringSliceFlag{
+			Name:  "prepend-layer-arn",
+			Usage: "ARN of an existing layer version, like a Lambda extension, to list before the published layers in layers.json and layers.yaml. To specify multiple layers, repeat the option",
+			Value: &cli.StringSlice{},
+		},
+		cli.StringSliceFlag{
+			Name:  "append-layer-arn",
+			Usage: "ARN of an existing layer version to list after the published layers in layers.json and layers.yaml. To specify multiple layers, repeat the option",
+			Value: &cli.StringSlice{},
+		},
+		cli.StringFlag{
+			Name:        "signature-policy",
+			Usage:       "containers/image signature policy file (policy.json) that must allow the image, for example requiring a simple signing signature by a GPG key. The image is not converted if the policy rejects it",
+			Destination: &opts.Signatures.PolicyFile,
+		},
+		cli.StringFlag{
+			Name:        "cosign-key",
+			Usage:       "Public key file of a cosign signature that the image must have. Requires --cosign-signature and --cosign-payload",
+			Destination: &opts.Signatures.CosignKey,
+		},
+		cli.StringFlag{
+			Name:        "cosign-signature",
+			Usage:       "File with the base64-encoded cosign signature of the image, as written by 'cosign sign --output-signature'",
+			Destination: &opts.Signatures.CosignSignature,
+		},
+		cli.StringFlag{
+			Name:        "cosign-payload",
+			Usage:       "File with the payload signed by the cosign signature, as written by 'cosign sign --output-payload'. It must name the manifest digest of the image",
+			Destination: &opts.Signatures.CosignPayload,
+		},
+		cli.StringFlag{
+			Name:        "signing-profile",
+			Usage:       "AWS Signer signing profile for signing the function deployment package and Lambda layers before publishing, for functions with a code signing config. Requires --signing-bucket",
+			Destination: &opts.SigningProfile,
+		},
+		cli.StringFlag{
+			Name:        "signing-bucket",
+			Usage:       "S3 bucket with versioning enabled, in the same region, for staging the files to sign and storing the signed files. Signed layers are published from this bucket",
+			Destination: &opts.SigningBucket,
+		},
+		cli.StringFlag{
+			Name:        "log-format",
+			Usage:       "Log output format. Valid values: 'text', 'json' (one JSON object per line)",
+			Value:       "text",
+			Destination: &opts.LogFormat,
+		},
+		cli.BoolFlag{
+			Name:        "quiet, q",
+			Usage:       "Only log warnings and errors",
+			Destination: &opts.Quiet,
+		},
+		cli.BoolFlag{
+			Name:        "verbose",
+			Usage:       "Log debug messages, like why each file in the image is or is not repackaged",
+			Destination: &opts.Verbose,
+		},
+		cli.BoolFlag{
+			Name:        "keep-layer-zips",
+			Usage:       "Keep the Lambda layer zip files in the output directory after publishing them",
+			Destination: &opts.KeepLayerZips,
+		},
+		cli.DurationFlag{
+			Name:        "timeout",
+			Usage:       "Stop and remove partially written output if the command does not finish in time, for example '10m' (default: no timeout)",
+			Destination: &opts.Timeout,
+		},
+	))
 
+	app.Commands = []cli.Command{
+		inspectCommand(ctx, &opts),
+		diffCommand(ctx, &opts),
+		environmentManifestCommand(ctx, &opts),
+		publishCommand(ctx, &opts, app.Flags),
+		verifyCommand(ctx, &opts, app.Flags),
+	}
 	app.Setup()
-	app.Commands = []cli.Command{}
 
 	return app, &opts
 }
 
-func validateCliOptions(opts *types.CmdOptions, context *cli.Context) {
+// Flags for selecting the source container image, shared by the commands
+func imageFlags(opts *types.CmdOptions) []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:        "image, i",
+			Usage:       "Name or path of the source container image. For example, 'my-docker-image:latest' or './my-oci-image-archive'. The image must be pulled locally already.",
+			Destination: &opts.Image,
+		},
+		cli.StringFlag{
+			Name:        "image-type, t",
+			Usage:       "Type of the source container image. Valid values: 'docker' (Docker image from the local Docker daemon), 'oci' (OCI image archive at the given path), 'docker-archive' (image archive created by 'docker save' at the given path), 'oci-dir' (OCI image layout directory at the given path, with an optional :tag), 'dir' (image directory at the given path, as written by 'skopeo copy'), 'containers-storage' (image in the local containers storage used by podman), 'auto' (detect the type of the archive or directory at the given path, otherwise use the Docker daemon)",
+			Value:       "docker",
+			Destination: &opts.ImageType,
+		},
+	}
+}
+
+func validateCliOptions(opts *types.CmdOptions, c *cli.Context) {
 	if opts.Image == "" {
 		fmt.Print("ERROR: Image name is required\n\n")
-		cli.ShowAppHelpAndExit(context, 1)
+		cli.ShowAppHelpAndExit(c, 1)
+	}
+
+	if opts.BaseLayersFile != "" && opts.BaseImage == "" {
+		fmt.Print("ERROR: --base-layers requires --base-image\n\n")
+		cli.ShowAppHelpAndExit(c, 1)
+	}
+
+	for _, validate := range []func(*types.CmdOptions) error{validatePublishOptions, validateRepackOptions} {
+		if err := validate(opts); err != nil {
+			fmt.Printf("ERROR: %v\n\n", err)
+			cli.ShowAppHelpAndExit(c, 1)
+		}
+	}
+}
+
+// Shows the help of the command and exits if the options are invalid, for the Before of commands
+func validateCommandOptions(c *cli.Context, opts *types.CmdOptions, validate func(*types.CmdOptions) error) {
+	if err := validate(opts); err != nil {
+		fmt.Printf("ERROR: %v\n\n", err)
+		cli.ShowCommandHelpAndExit(c, c.Command.Name, 1)
 	}
+}
 
+// Checks the options for publishing layers, which the publish command shares
+func validatePublishOptions(opts *types.CmdOptions) error {
 	for _, runtime := range opts.CompatibleRuntimes {
 		if !types.ValidRuntimes.Contains(runtime) {
-			fmt.Println("ERROR: Compatible runtimes must be one of the supported runtimes\n\n", types.ValidRuntimes)
-			cli.ShowAppHelpAndExit(context, 1)
+			return fmt.Errorf("Compatible runtimes must be one of the supported runtimes: %v", types.ValidRuntimes)
 		}
 	}
-}
 
-func repackImageAction(opts *types.CmdOptions, context *cli.Context) error {
-	var imageTransport string
-	switch opts.ImageType {
-	case "docker":
-		imageTransport = "docker-daemon:"
-	case "oci":
-		imageTransport = "oci-archive:"
-	default:
-		fmt.Println("ERROR: Image type must be one of the supported image types")
-		cli.ShowAppHelpAndExit(context, 1)
+	if (opts.SigningProfile == "") != (opts.SigningBucket == "") {
+		return errors.New("--signing-profile and --signing-bucket must be given together")
 	}
+	return nil
+}
 
-	imageLocation := imageTransport + opts.Image
-	if opts.ImageType == "docker" && strings.Count(imageLocation, ":") == 1 {
-		imageLocation += ":latest"
+// Checks the options for checking the signatures of the image, which the verify command shares
+func validateSignatureOptions(opts *types.CmdOptions) error {
+	if opts.Signatures.CosignKey != "" && (opts.Signatures.CosignSignature == "" || opts.Signatures.CosignPayload == "") {
+		return errors.New("--cosign-key requires --cosign-signature and --cosign-payload")
 	}
+	return nil
+}
 
-	layers, function, err := extract.RepackImage(imageLocation, opts.OutputDir)
-	if err != nil {
+// Checks the options for reading and repacking the image, which the commands that repack images share
+func validateRepackOptions(opts *types.CmdOptions) error {
+	if err := validateSignatureOptions(opts); err != nil {
 		return err
 	}
 
-	if function.FileCount == 0 {
-		// remove empty zip file
-		os.Remove(function.File)
+	if opts.Runtime != "" && !types.ValidRuntimes.Contains(opts.Runtime) {
+		return fmt.Errorf("Runtime must be one of the supported runtimes: %v", types.ValidRuntimes)
 	}
 
-	if len(layers) == 0 && function.FileCount == 0 {
-		return errors.New("No compatible layers or function files found in the image (likely nothing found in /opt and /var/task)")
+	if opts.Handler != "" && opts.Runtime == "" {
+		return errors.New("--handler requires --runtime")
 	}
 
-	if !opts.DryRun {
-		_, _, err := publish.PublishLambdaLayers(types.ConvertToPublishOptions(opts), layers)
-		if err != nil {
-			return err
-		}
+	if opts.HandlerFile != "" && opts.Handler == "" {
+		return errors.New("--handler-file requires --handler")
+	}
+
+	if opts.PruneEnvironment && opts.EnvironmentManifest == "" {
+		return errors.New("--prune-environment-files requires --environment-manifest")
 	}
 
+	if opts.EnvironmentManifest != "" && !opts.PruneEnvironment {
+		return errors.New("--environment-manifest requires --prune-environment-files")
+	}
+
+	if opts.MaxLayerSizeMB < 0 {
+		return errors.New("--max-layer-size must not be negative")
+	}
 	return nil
 }
 
+func repackImageAction(ctx context.Context, opts *types.CmdOptions, c *cli.Context) error {
+	if _, err := converter.ImageReference(opts.Image, opts.ImageType); err != nil {
+		fmt.Println("ERROR: " + err.Error())
+		cli.ShowAppHelpAndExit(c, 1)
+	}
+
+	_, err := converter.New(types.ConvertToConverterOptions(opts)).Convert(ctx, opts.Image)
+	return err
+}
+
+// Options for reading and repacking the image in the commands, the same as in a conversion
+func extractOptions(opts *types.CmdOptions) (*types.ExtractOptions, error) {
+	return converter.New(types.ConvertToLocalConverterOptions(opts)).ExtractOptions()
+}
+
+// Runs a command with a context that is cancelled when the timeout passes, if there is one
+func runWithTimeout(ctx context.Context, timeout time.Duration, run func(context.Context) error) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	err := run(ctx)
+	if err != nil {
+		switch ctx.Err() {
+		case context.DeadlineExceeded:
+			return fmt.Errorf("timed out after %s: %v", timeout, err)
+		case context.Canceled:
+			return fmt.Errorf("interrupted: %v", err)
+		}
+	}
+	return err
+}
+
+// Context that is cancelled on SIGINT or SIGTERM. A second signal terminates the process immediately.
+func interruptContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+			signal.Stop(signals)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
+
 func main() {
-	app, _ := createApp()
+	ctx, stop := interruptContext()
+	app, opts := createApp(ctx)
 	err := app.Run(os.Args)
+	stop()
 	if err != nil {
-		log.Fatal(err)
+		opts.Logger.Errorf("%v", err)
+		os.Exit(1)
 	}
 }
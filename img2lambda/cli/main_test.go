@@ -0,0 +1,24 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package main
+
+import (
+	"testing"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRepackOptions(t *testing.T) {
+	assert.Nil(t, validateRepackOptions(&types.CmdOptions{Runtime: "python3.8", Handler: "hello.handler"}))
+
+	err := validateRepackOptions(&types.CmdOptions{Runtime: "python9"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Runtime must be one of the supported runtimes")
+
+	err = validateRepackOptions(&types.CmdOptions{Signatures: types.SignatureOptions{CosignKey: "cosign.pub"}})
+	assert.EqualError(t, err, "--cosign-key requires --cosign-signature and --cosign-payload")
+
+	err = validateRepackOptions(&types.CmdOptions{PruneEnvironment: true})
+	assert.EqualError(t, err, "--prune-environment-files requires --environment-manifest")
+}
@@ -0,0 +1,82 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/converter"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
+	"github.com/urfave/cli"
+)
+
+// Options of the app for publishing layers, which the publish command accepts too
+var publishFlagNames = []string{
+	"region",
+	"profile",
+	"layer-namespace",
+	"layer-name-template",
+	"description",
+	"license-info",
+	"compatible-runtime",
+	"signing-profile",
+	"signing-bucket",
+	"keep-layer-zips",
+	"secrets-allowlist",
+}
+
+func publishCommand(ctx context.Context, opts *types.CmdOptions, appFlags []cli.Flag) cli.Command {
+	return cli.Command{
+		Name:  "publish",
+		Usage: "Publishes the Lambda layers of an earlier conversion from its conversion manifest, for example after converting the image with --dry-run in a stage without AWS credentials",
+		Flags: append(withEnvVars([]cli.Flag{
+			cli.StringFlag{
+				Name:  "manifest, m",
+				Usage: "Conversion manifest written to the output directory by the conversion. The Lambda layer files listed in it must not have changed since. Results files are written next to it",
+				Value: "./output/conversion.json",
+			},
+		}), selectFlags(appFlags, publishFlagNames)...),
+		Before: func(c *cli.Context) error {
+			if err := applyConfig(c, c.Command.Flags); err != nil {
+				return err
+			}
+			opts.CompatibleRuntimes = c.StringSlice("compatible-runtime")
+			validateCommandOptions(c, opts, validatePublishOptions)
+			return nil
+		},
+		Action: func(c *cli.Context) error {
+			return runWithTimeout(ctx, opts.Timeout, func(ctx context.Context) error {
+				return publishAction(ctx, opts, c)
+			})
+		},
+	}
+}
+
+// Returns the flags with the given names, in the order of the flags
+func selectFlags(flags []cli.Flag, names []string) []cli.Flag {
+	selected := map[string]bool{}
+	for _, name := range names {
+		selected[name] = true
+	}
+
+	var result []cli.Flag
+	for _, flag := range flags {
+		name := strings.TrimSpace(strings.Split(flag.GetName(), ",")[0])
+		if selected[name] {
+			result = append(result, flag)
+		}
+	}
+	return result
+}
+
+func publishAction(ctx context.Context, opts *types.CmdOptions, c *cli.Context) error {
+	if opts.DryRun {
+		fmt.Print("ERROR: The publish command cannot be a dry-run\n\n")
+		cli.ShowCommandHelpAndExit(c, "publish", 1)
+	}
+
+	_, err := converter.New(types.ConvertToConverterOptions(opts)).Publish(ctx, c.String("manifest"))
+	return err
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/clients"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/converter"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/lock"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
+	"github.com/urfave/cli"
+)
+
+// Options of the app for checking the signatures of the image, which the verify command accepts too
+var verifyFlagNames = []string{
+	"profile",
+	"signature-policy",
+	"cosign-key",
+	"cosign-signature",
+	"cosign-payload",
+}
+
+func verifyCommand(ctx context.Context, opts *types.CmdOptions, appFlags []cli.Flag) cli.Command {
+	return cli.Command{
+		Name:  "verify",
+		Usage: "Checks that the image still has the manifest digest locked in img2lambda.lock, and that the locked layer versions still exist with the locked CodeSha256. Fails if anything differs",
+		Flags: append(withEnvVars(append([]cli.Flag{
+			cli.StringFlag{
+				Name:  "lock-file",
+				Usage: "Lock file written to the output directory after publishing",
+				Value: "./output/img2lambda.lock",
+			},
+		}, imageFlags(opts)...)), selectFlags(appFlags, verifyFlagNames)...),
+		Before: func(c *cli.Context) error {
+			if err := applyConfig(c, c.Command.Flags); err != nil {
+				return err
+			}
+			validateCommandOptions(c, opts, validateSignatureOptions)
+			return nil
+		},
+		Action: func(c *cli.Context) error {
+			return runWithTimeout(ctx, opts.Timeout, func(ctx context.Context) error {
+				return verifyAction(ctx, opts, c)
+			})
+		},
+	}
+}
+
+func verifyAction(ctx context.Context, opts *types.CmdOptions, c *cli.Context) error {
+	lockFile := c.String("lock-file")
+	locked, err := lock.Read(lockFile)
+	if err != nil {
+		return err
+	}
+
+	// The image is the locked one unless another name is given, like the tag of a rebuilt image
+	imageLocation := locked.ImageReference
+	if opts.Image != "" {
+		imageLocation, err = converter.ImageReference(opts.Image, opts.ImageType)
+		if err != nil {
+			fmt.Println("ERROR: " + err.Error())
+			cli.ShowCommandHelpAndExit(c, "verify", 1)
+		}
+	}
+
+	drift, err := lock.Verify(ctx, locked, imageLocation, &types.LockVerifyOptions{
+		LambdaClients: func(region string) lambdaiface.LambdaAPI {
+			return clients.NewLambdaClient(region, opts.Profile)
+		},
+		Signatures: opts.Signatures,
+		Logger:     opts.Logger,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, d := range drift {
+		if d.Arn != "" {
+			opts.Logger.Warnf("Layer version %s (image layer %s): %s", d.Arn, d.ImageLayerDigest, d.Message)
+		} else {
+			opts.Logger.Warnf("%s", d.Message)
+		}
+	}
+	if len(drift) > 0 {
+		return fmt.Errorf("%s does not match the image and the published layer versions: %d differences", lockFile, len(drift))
+	}
+	opts.Logger.Infof("%s matches the image and the published layer versions", lockFile)
+	return nil
+}
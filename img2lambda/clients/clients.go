@@ -7,6 +7,8 @@ import (
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/signer"
 	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/version"
 )
 
@@ -16,13 +18,24 @@ var userAgentHandler = request.NamedHandler{
 }
 
 func NewLambdaClient(region string, profile string) *lambda.Lambda {
+	return lambda.New(newSession(profile), &aws.Config{Region: aws.String(region)})
+}
+
+// Client for signing Lambda function deployment packages and layers with AWS Signer
+func NewSignerClient(region string, profile string) *signer.Signer {
+	return signer.New(newSession(profile), &aws.Config{Region: aws.String(region)})
+}
+
+// Client for staging files in S3 for signing
+func NewS3Client(region string, profile string) *s3.S3 {
+	return s3.New(newSession(profile), &aws.Config{Region: aws.String(region)})
+}
+
+func newSession(profile string) *session.Session {
 	sess := session.Must(session.NewSessionWithOptions(session.Options{
 		Profile:           profile,
 		SharedConfigState: session.SharedConfigEnable,
 	}))
 	sess.Handlers.Build.PushBackNamed(userAgentHandler)
-
-	client := lambda.New(sess, &aws.Config{Region: aws.String(region)})
-
-	return client
+	return sess
 }
@@ -0,0 +1,127 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+// Package codesign signs Lambda function deployment packages and layers with AWS Signer,
+// so that they can be deployed to functions with a code signing config.
+package codesign
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/signer"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/publish"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
+)
+
+// Signs the Lambda layer files and the function deployment package of the repacked image.
+// Each file is uploaded to the S3 bucket and signed by a signing job, which writes the signed file to the same bucket.
+// The S3 locations of the signed files are set on the layers and the function deployment package.
+func SignRepackedImage(ctx context.Context, opts *types.SigningOptions, repacked *types.RepackedImage) error {
+	for i := range repacked.Layers {
+		signed, err := SignFile(ctx, opts, repacked.Layers[i].File)
+		if err != nil {
+			return err
+		}
+		repacked.Layers[i].Signed = signed
+	}
+
+	if repacked.Function != nil && repacked.Function.FileCount > 0 {
+		signed, err := SignFile(ctx, opts, repacked.Function.File)
+		if err != nil {
+			return err
+		}
+		repacked.Function.Signed = signed
+	}
+	return nil
+}
+
+// Uploads the zip file to S3 and signs it, returning the S3 location of the signed zip file
+func SignFile(ctx context.Context, opts *types.SigningOptions, filename string) (*types.SignedArtifact, error) {
+	key, size, err := unsignedKey(opts.Prefix, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	task := opts.Progress.Start(fmt.Sprintf("Uploading %s for signing", filepath.Base(filename)), size)
+	uploaded, err := opts.S3Client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(opts.Bucket),
+		Key:    aws.String(key),
+		Body:   f,
+	}, publish.UploadProgress(task))
+	task.Done()
+	if err != nil {
+		return nil, fmt.Errorf("uploading %s to S3 bucket %s: %v", filename, opts.Bucket, err)
+	}
+	if uploaded.VersionId == nil {
+		return nil, fmt.Errorf("S3 bucket %s must have versioning enabled for signing files with AWS Signer", opts.Bucket)
+	}
+
+	job, err := opts.SignerClient.StartSigningJobWithContext(ctx, &signer.StartSigningJobInput{
+		ProfileName: aws.String(opts.SigningProfile),
+		Source: &signer.Source{S3: &signer.S3Source{
+			BucketName: aws.String(opts.Bucket),
+			Key:        aws.String(key),
+			Version:    uploaded.VersionId,
+		}},
+		Destination: &signer.Destination{S3: &signer.S3Destination{
+			BucketName: aws.String(opts.Bucket),
+			Prefix:     aws.String(opts.Prefix + "signed/"),
+		}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("starting signing job for %s: %v", filename, err)
+	}
+	jobID := aws.StringValue(job.JobId)
+	opts.Logger.Infof("Started signing job %s for %s with signing profile %s", jobID, filename, opts.SigningProfile)
+
+	describeArgs := &signer.DescribeSigningJobInput{JobId: job.JobId}
+	if err := opts.SignerClient.WaitUntilSuccessfulSigningJobWithContext(ctx, describeArgs); err != nil {
+		return nil, fmt.Errorf("signing job %s for %s did not succeed: %v", jobID, filename, err)
+	}
+
+	described, err := opts.SignerClient.DescribeSigningJobWithContext(ctx, describeArgs)
+	if err != nil {
+		return nil, err
+	}
+	if described.SignedObject == nil || described.SignedObject.S3 == nil {
+		return nil, fmt.Errorf("signing job %s for %s did not report the location of the signed file", jobID, filename)
+	}
+
+	signed := &types.SignedArtifact{
+		SigningJobID: jobID,
+		S3Bucket:     aws.StringValue(described.SignedObject.S3.BucketName),
+		S3Key:        aws.StringValue(described.SignedObject.S3.Key),
+	}
+	opts.Logger.Infof("Signed %s: s3://%s/%s", filename, signed.S3Bucket, signed.S3Key)
+	return signed, nil
+}
+
+// S3 key of the file to sign, named after the SHA-256 digest of its contents so that uploads of the same file share a key
+func unsignedKey(prefix string, filename string) (string, int64, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return prefix + "unsigned/" + hex.EncodeToString(hash.Sum(nil)) + ".zip", size, nil
+}
@@ -0,0 +1,169 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package codesign
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/signer"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/internal/testing/mocks"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, dir string, name string, contents string) (string, string) {
+	filename := filepath.Join(dir, name)
+	assert.Nil(t, ioutil.WriteFile(filename, []byte(contents), 0644))
+	hash := sha256.Sum256([]byte(contents))
+	return filename, "test-prefix/unsigned/" + hex.EncodeToString(hash[:]) + ".zip"
+}
+
+func signingOptions(signerClient *mocks.MockSignerAPI, s3Client *mocks.MockS3API) *types.SigningOptions {
+	return &types.SigningOptions{
+		SignerClient:   signerClient,
+		S3Client:       s3Client,
+		SigningProfile: "test-profile",
+		Bucket:         "signing-bucket",
+		Prefix:         "test-prefix/",
+	}
+}
+
+// Expects the file to be uploaded to the unsigned key and signed by a successful signing job
+func mockSigningJob(s3Client *mocks.MockS3API, signerClient *mocks.MockSignerAPI, key string, jobID string) {
+	s3Client.EXPECT().PutObjectWithContext(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, input *s3.PutObjectInput, opts ...interface{}) (*s3.PutObjectOutput, error) {
+			if aws.StringValue(input.Bucket) != "signing-bucket" || aws.StringValue(input.Key) != key {
+				return nil, fmt.Errorf("unexpected upload to s3://%s/%s", aws.StringValue(input.Bucket), aws.StringValue(input.Key))
+			}
+			return &s3.PutObjectOutput{VersionId: aws.String("version-" + jobID)}, nil
+		})
+
+	expectedStartInput := &signer.StartSigningJobInput{
+		ProfileName: aws.String("test-profile"),
+		Source: &signer.Source{S3: &signer.S3Source{
+			BucketName: aws.String("signing-bucket"),
+			Key:        aws.String(key),
+			Version:    aws.String("version-" + jobID),
+		}},
+		Destination: &signer.Destination{S3: &signer.S3Destination{
+			BucketName: aws.String("signing-bucket"),
+			Prefix:     aws.String("test-prefix/signed/"),
+		}},
+	}
+	signerClient.EXPECT().StartSigningJobWithContext(gomock.Any(), gomock.Eq(expectedStartInput)).Return(
+		&signer.StartSigningJobOutput{JobId: aws.String(jobID)}, nil)
+
+	describeInput := &signer.DescribeSigningJobInput{JobId: aws.String(jobID)}
+	signerClient.EXPECT().WaitUntilSuccessfulSigningJobWithContext(gomock.Any(), gomock.Eq(describeInput)).Return(nil)
+	signerClient.EXPECT().DescribeSigningJobWithContext(gomock.Any(), gomock.Eq(describeInput)).Return(
+		&signer.DescribeSigningJobOutput{
+			JobId:  aws.String(jobID),
+			Status: aws.String(signer.SigningStatusSucceeded),
+			SignedObject: &signer.SignedObject{S3: &signer.S3SignedObject{
+				BucketName: aws.String("signing-bucket"),
+				Key:        aws.String("test-prefix/signed/" + jobID + ".zip"),
+			}},
+		}, nil)
+}
+
+func TestSignRepackedImage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	signerClient := mocks.NewMockSignerAPI(ctrl)
+	s3Client := mocks.NewMockS3API(ctrl)
+
+	layerFile, layerKey := writeFile(t, dir, "layer-1.zip", "layer contents")
+	functionFile, functionKey := writeFile(t, dir, "function.zip", "function contents")
+	mockSigningJob(s3Client, signerClient, layerKey, "job-1")
+	mockSigningJob(s3Client, signerClient, functionKey, "job-2")
+
+	repacked := &types.RepackedImage{
+		Layers:   []types.LambdaLayer{{Digest: "sha256:1", File: layerFile}},
+		Function: &types.LambdaDeploymentPackage{File: functionFile, FileCount: 1},
+	}
+	err = SignRepackedImage(context.Background(), signingOptions(signerClient, s3Client), repacked)
+	assert.Nil(t, err)
+
+	assert.Equal(t, &types.SignedArtifact{SigningJobID: "job-1", S3Bucket: "signing-bucket", S3Key: "test-prefix/signed/job-1.zip"}, repacked.Layers[0].Signed)
+	assert.Equal(t, &types.SignedArtifact{SigningJobID: "job-2", S3Bucket: "signing-bucket", S3Key: "test-prefix/signed/job-2.zip"}, repacked.Function.Signed)
+}
+
+func TestSignRepackedImageWithoutFunction(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	signerClient := mocks.NewMockSignerAPI(ctrl)
+	s3Client := mocks.NewMockS3API(ctrl)
+
+	layerFile, layerKey := writeFile(t, dir, "layer-1.zip", "layer contents")
+	mockSigningJob(s3Client, signerClient, layerKey, "job-1")
+
+	repacked := &types.RepackedImage{
+		Layers:   []types.LambdaLayer{{Digest: "sha256:1", File: layerFile}},
+		Function: &types.LambdaDeploymentPackage{File: filepath.Join(dir, "function.zip"), FileCount: 0},
+	}
+	err = SignRepackedImage(context.Background(), signingOptions(signerClient, s3Client), repacked)
+	assert.Nil(t, err)
+	assert.NotNil(t, repacked.Layers[0].Signed)
+	assert.Nil(t, repacked.Function.Signed)
+}
+
+func TestSignFileRequiresVersionedBucket(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	signerClient := mocks.NewMockSignerAPI(ctrl)
+	s3Client := mocks.NewMockS3API(ctrl)
+
+	filename, _ := writeFile(t, dir, "layer-1.zip", "layer contents")
+	s3Client.EXPECT().PutObjectWithContext(gomock.Any(), gomock.Any(), gomock.Any()).Return(&s3.PutObjectOutput{}, nil)
+
+	_, err = SignFile(context.Background(), signingOptions(signerClient, s3Client), filename)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "must have versioning enabled")
+}
+
+func TestSignFileJobFailed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	signerClient := mocks.NewMockSignerAPI(ctrl)
+	s3Client := mocks.NewMockS3API(ctrl)
+
+	filename, _ := writeFile(t, dir, "layer-1.zip", "layer contents")
+	s3Client.EXPECT().PutObjectWithContext(gomock.Any(), gomock.Any(), gomock.Any()).Return(&s3.PutObjectOutput{VersionId: aws.String("1")}, nil)
+	signerClient.EXPECT().StartSigningJobWithContext(gomock.Any(), gomock.Any()).Return(&signer.StartSigningJobOutput{JobId: aws.String("job-1")}, nil)
+	signerClient.EXPECT().WaitUntilSuccessfulSigningJobWithContext(gomock.Any(), gomock.Any()).Return(errors.New("failed waiting for successful resource state"))
+
+	_, err = SignFile(context.Background(), signingOptions(signerClient, s3Client), filename)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "signing job job-1 for "+filename+" did not succeed")
+}
@@ -0,0 +1,117 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Config file read from the current directory when no config file is given
+const DefaultFile = "img2lambda.yaml"
+
+// Options from an img2lambda.yaml file, keyed by the long name of the command line flag they set.
+// Named targets override the top-level options, for example to publish to a different region per environment:
+//
+//	layer-namespace: my-app
+//	compatible-runtime: [provided]
+//	targets:
+//	  prod:
+//	    region: us-west-2
+type File struct {
+	Options map[string]interface{}            `yaml:",inline"`
+	Targets map[string]map[string]interface{} `yaml:"targets"`
+}
+
+func Load(filename string) (*File, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &File{}
+	if err := yaml.UnmarshalStrict(contents, file); err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %v", filename, err)
+	}
+	return file, nil
+}
+
+// Loads the given config file, or the default config file if it exists. Returns nil if there is no config file.
+func LoadDefault(filename string) (*File, error) {
+	if filename != "" {
+		return Load(filename)
+	}
+
+	if _, err := os.Stat(DefaultFile); os.IsNotExist(err) {
+		return nil, nil
+	}
+	return Load(DefaultFile)
+}
+
+// Resolves the options of the given target (or only the top-level options if target is empty)
+// to flag values. Lists result in one value per item, like repeating a command line flag.
+func (f *File) Values(target string) (map[string][]string, error) {
+	values := make(map[string][]string)
+	if err := addValues(values, f.Options); err != nil {
+		return nil, err
+	}
+
+	if target == "" {
+		return values, nil
+	}
+
+	targetOptions, found := f.Targets[target]
+	if !found {
+		return nil, fmt.Errorf("target %s not found in config file (available targets: %v)", target, f.TargetNames())
+	}
+	if err := addValues(values, targetOptions); err != nil {
+		return nil, fmt.Errorf("target %s: %v", target, err)
+	}
+	return values, nil
+}
+
+func (f *File) TargetNames() []string {
+	names := []string{}
+	for name := range f.Targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func addValues(values map[string][]string, options map[string]interface{}) error {
+	for name, option := range options {
+		switch option := option.(type) {
+		case []interface{}:
+			list := []string{}
+			for _, item := range option {
+				value, err := scalarValue(name, item)
+				if err != nil {
+					return err
+				}
+				list = append(list, value)
+			}
+			values[name] = list
+		default:
+			value, err := scalarValue(name, option)
+			if err != nil {
+				return err
+			}
+			values[name] = []string{value}
+		}
+	}
+	return nil
+}
+
+func scalarValue(name string, option interface{}) (string, error) {
+	switch option.(type) {
+	case string, bool, int, float64:
+		return fmt.Sprint(option), nil
+	default:
+		return "", fmt.Errorf("option %s must be a string, number, boolean or list", name)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfigFile(t *testing.T, contents string) (string, func()) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	filename := filepath.Join(dir, DefaultFile)
+	err = ioutil.WriteFile(filename, []byte(contents), 0644)
+	assert.Nil(t, err)
+	return filename, func() { os.RemoveAll(dir) }
+}
+
+const testConfig = `
+image: my-image
+dry-run: true
+layer-namespace: my-app
+compatible-runtime: [provided, python3.8]
+targets:
+  prod:
+    region: us-west-2
+    layer-namespace: my-app-prod
+    compatible-runtime:
+      - provided
+`
+
+func TestValues(t *testing.T) {
+	filename, cleanup := writeConfigFile(t, testConfig)
+	defer cleanup()
+
+	file, err := Load(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"prod"}, file.TargetNames())
+
+	values, err := file.Values("")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]string{
+		"image":              {"my-image"},
+		"dry-run":            {"true"},
+		"layer-namespace":    {"my-app"},
+		"compatible-runtime": {"provided", "python3.8"},
+	}, values)
+}
+
+func TestTargetValues(t *testing.T) {
+	filename, cleanup := writeConfigFile(t, testConfig)
+	defer cleanup()
+
+	file, err := Load(filename)
+	assert.Nil(t, err)
+
+	values, err := file.Values("prod")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]string{
+		"image":              {"my-image"},
+		"dry-run":            {"true"},
+		"region":             {"us-west-2"},
+		"layer-namespace":    {"my-app-prod"},
+		"compatible-runtime": {"provided"},
+	}, values)
+
+	_, err = file.Values("dev")
+	assert.EqualError(t, err, "target dev not found in config file (available targets: [prod])")
+}
+
+func TestInvalidValues(t *testing.T) {
+	filename, cleanup := writeConfigFile(t, "region:\n  name: us-west-2\n")
+	defer cleanup()
+
+	file, err := Load(filename)
+	assert.Nil(t, err)
+
+	_, err = file.Values("")
+	assert.EqualError(t, err, "option region must be a string, number, boolean or list")
+}
+
+func TestInvalidYAML(t *testing.T) {
+	filename, cleanup := writeConfigFile(t, "targets: [prod]\n")
+	defer cleanup()
+
+	_, err := Load(filename)
+	assert.Error(t, err)
+}
+
+func TestLoadDefault(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	wd, err := os.Getwd()
+	assert.Nil(t, err)
+	defer os.Chdir(wd)
+	assert.Nil(t, os.Chdir(dir))
+
+	file, err := LoadDefault("")
+	assert.Nil(t, err)
+	assert.Nil(t, file)
+
+	err = ioutil.WriteFile(DefaultFile, []byte("region: eu-west-1\n"), 0644)
+	assert.Nil(t, err)
+
+	file, err = LoadDefault("")
+	assert.Nil(t, err)
+	values, err := file.Values("")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"eu-west-1"}, values["region"])
+
+	_, err = LoadDefault(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+}
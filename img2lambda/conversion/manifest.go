@@ -0,0 +1,217 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+// Package conversion records the Lambda layer files and function deployment package of a conversion
+// in a manifest, so that they can be published later by another process, like a deploy stage with
+// AWS credentials, after they were repacked in a build stage without them.
+package conversion
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/internal/atomicfile"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/publish"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/version"
+)
+
+// Name of the conversion manifest in the output directory
+const ManifestFile = "conversion.json"
+
+// Layer versions that the function uses besides the layers of the image, in the order of the results files
+type LayerArns struct {
+	Base    []string // Layer versions of the base image
+	Prepend []string
+	Append  []string
+}
+
+// Describes the repacked image, whose files must be in the given directory, with the hashes of the files
+func NewManifest(image *types.RepackedImage, sourceImageName string, arns LayerArns, dir string) (*types.ConversionManifest, error) {
+	m := &types.ConversionManifest{
+		ToolVersion:      version.Version,
+		Image:            sourceImageName,
+		ImageReference:   image.Name,
+		ManifestDigest:   image.ManifestDigest,
+		Verification:     image.Verification,
+		BaseImage:        image.BaseImage,
+		BaseLayerDigests: image.BaseLayerDigests,
+		BaseLayerArns:    arns.Base,
+		PrependLayerArns: arns.Prepend,
+		AppendLayerArns:  arns.Append,
+		Environment:      image.Environment,
+		Layers:           []types.ManifestLayer{},
+		SecretFindings:   image.SecretFindings,
+	}
+
+	for _, layer := range image.Layers {
+		file, codeSha256, codeSize, err := describeFile(layer.File, dir)
+		if err != nil {
+			return nil, err
+		}
+		sbomFile, err := relativePath(layer.SBOMFile, dir)
+		if err != nil {
+			return nil, err
+		}
+		m.Layers = append(m.Layers, types.ManifestLayer{
+			File:             file,
+			ImageLayerDigest: layer.Digest,
+			CodeSha256:       codeSha256,
+			CodeSize:         codeSize,
+			SBOMFile:         sbomFile,
+			Part:             layer.Part,
+			FlattenedDigests: layer.FlattenedDigests,
+			Extensions:       layer.Extensions,
+			BundledLibraries: layer.BundledLibraries,
+			PrunedFiles:      layer.PrunedFiles,
+			PrunedBytes:      layer.PrunedBytes,
+		})
+	}
+
+	if image.Function != nil && image.Function.FileCount > 0 {
+		file, codeSha256, codeSize, err := describeFile(image.Function.File, dir)
+		if err != nil {
+			return nil, err
+		}
+		sbomFile, err := relativePath(image.Function.SBOMFile, dir)
+		if err != nil {
+			return nil, err
+		}
+		m.Function = &types.ManifestFunction{
+			File:        file,
+			CodeSha256:  codeSha256,
+			CodeSize:    codeSize,
+			FileCount:   image.Function.FileCount,
+			SBOMFile:    sbomFile,
+			PrunedFiles: image.Function.PrunedFiles,
+			PrunedBytes: image.Function.PrunedBytes,
+		}
+	}
+	return m, nil
+}
+
+// Path of the file relative to the directory, so that the directory can be moved to another machine
+func relativePath(filename string, dir string) (string, error) {
+	if filename == "" {
+		return "", nil
+	}
+	absFile, err := filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absDir, absFile)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+func describeFile(filename string, dir string) (string, string, int64, error) {
+	rel, err := relativePath(filename, dir)
+	if err != nil {
+		return "", "", 0, err
+	}
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", "", 0, err
+	}
+	return rel, publish.CodeSha256(contents), int64(len(contents)), nil
+}
+
+// Writes the conversion manifest to conversion.json in the given directory
+func WriteManifest(dir string, m *types.ConversionManifest) (string, error) {
+	contents, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	manifestPath := filepath.Join(dir, ManifestFile)
+	if err := atomicfile.WriteFile(manifestPath, contents, 0644); err != nil {
+		return "", err
+	}
+	return manifestPath, nil
+}
+
+// Reads the conversion manifest and checks that the files it lists were not changed since the conversion.
+// Returns the manifest and the repacked image it describes, with the paths of the files in the directory of the manifest.
+func ReadManifest(filename string) (*types.ConversionManifest, *types.RepackedImage, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading conversion manifest: %v", err)
+	}
+	m := &types.ConversionManifest{}
+	if err := json.Unmarshal(contents, m); err != nil {
+		return nil, nil, fmt.Errorf("parsing conversion manifest %s: %v", filename, err)
+	}
+
+	dir := filepath.Dir(filename)
+	image := &types.RepackedImage{
+		Name:             m.ImageReference,
+		ManifestDigest:   m.ManifestDigest,
+		Verification:     m.Verification,
+		BaseImage:        m.BaseImage,
+		BaseLayerDigests: m.BaseLayerDigests,
+		Environment:      m.Environment,
+		SecretFindings:   m.SecretFindings,
+	}
+
+	for _, layer := range m.Layers {
+		file, err := checkFile(dir, layer.File, layer.CodeSha256, layer.CodeSize)
+		if err != nil {
+			return nil, nil, err
+		}
+		image.Layers = append(image.Layers, types.LambdaLayer{
+			Digest:           layer.ImageLayerDigest,
+			File:             file,
+			SBOMFile:         joinPath(dir, layer.SBOMFile),
+			Part:             layer.Part,
+			FlattenedDigests: layer.FlattenedDigests,
+			Extensions:       layer.Extensions,
+			BundledLibraries: layer.BundledLibraries,
+			PrunedFiles:      layer.PrunedFiles,
+			PrunedBytes:      layer.PrunedBytes,
+		})
+	}
+
+	if m.Function != nil {
+		file, err := checkFile(dir, m.Function.File, m.Function.CodeSha256, m.Function.CodeSize)
+		if err != nil {
+			return nil, nil, err
+		}
+		image.Function = &types.LambdaDeploymentPackage{
+			FileCount:   m.Function.FileCount,
+			File:        file,
+			SBOMFile:    joinPath(dir, m.Function.SBOMFile),
+			PrunedFiles: m.Function.PrunedFiles,
+			PrunedBytes: m.Function.PrunedBytes,
+		}
+	}
+	return m, image, nil
+}
+
+func joinPath(dir string, rel string) string {
+	if rel == "" {
+		return ""
+	}
+	return filepath.Join(dir, filepath.FromSlash(rel))
+}
+
+// Checks that the file has the hash recorded in the manifest, returning its path
+func checkFile(dir string, rel string, codeSha256 string, codeSize int64) (string, error) {
+	filename := joinPath(dir, rel)
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", fmt.Errorf("reading file of the conversion manifest: %v", err)
+	}
+	if int64(len(contents)) != codeSize || publish.CodeSha256(contents) != codeSha256 {
+		return "", fmt.Errorf("%s was changed since the conversion: expected SHA-256 %s (%d bytes), but it is %s (%d bytes)",
+			filename, codeSha256, codeSize, publish.CodeSha256(contents), len(contents))
+	}
+	return filename, nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package conversion
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/publish"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/version"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestFile(t *testing.T, dir string, name string, contents string) string {
+	filename := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(filename, []byte(contents), 0644))
+	return filename
+}
+
+func TestWriteAndReadManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	image := &types.RepackedImage{
+		Name:           "docker-daemon:my-image:latest",
+		ManifestDigest: "sha256:abc",
+		Layers: []types.LambdaLayer{
+			{
+				Digest:     "sha256:1",
+				File:       writeTestFile(t, dir, "layer-1.zip", "layer 1"),
+				SBOMFile:   writeTestFile(t, dir, "layer-1.spdx.json", "{}"),
+				Extensions: []types.LambdaExtension{{Name: "ext", Path: "/opt/extensions/ext", ImageLayerDigest: "sha256:1"}},
+			},
+			{Digest: "sha256:2", File: writeTestFile(t, dir, "layer-2-part-1.zip", "layer 2"), Part: 1, PrunedFiles: 2, PrunedBytes: 10},
+		},
+		Function: &types.LambdaDeploymentPackage{FileCount: 3, File: writeTestFile(t, dir, "function.zip", "function")},
+	}
+
+	m, err := NewManifest(image, "my-image", LayerArns{Prepend: []string{"arn:aws:lambda:us-east-1:123456789012:layer:first:1"}}, dir)
+	require.NoError(t, err)
+	assert.Equal(t, version.Version, m.ToolVersion)
+	assert.Equal(t, "my-image", m.Image)
+	assert.Equal(t, "layer-1.zip", m.Layers[0].File)
+	assert.Equal(t, "layer-1.spdx.json", m.Layers[0].SBOMFile)
+	assert.Equal(t, publish.CodeSha256([]byte("layer 2")), m.Layers[1].CodeSha256)
+	assert.Equal(t, int64(len("layer 2")), m.Layers[1].CodeSize)
+	assert.Equal(t, "function.zip", m.Function.File)
+
+	manifestPath, err := WriteManifest(dir, m)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, ManifestFile), manifestPath)
+
+	read, repacked, err := ReadManifest(manifestPath)
+	require.NoError(t, err)
+	assert.Equal(t, m, read)
+	assert.Equal(t, image, repacked)
+}
+
+func TestNewManifestWithoutFunctionFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	image := &types.RepackedImage{
+		Layers:   []types.LambdaLayer{{Digest: "sha256:1", File: writeTestFile(t, dir, "layer-1.zip", "layer 1")}},
+		Function: &types.LambdaDeploymentPackage{File: filepath.Join(dir, "function.zip")},
+	}
+	m, err := NewManifest(image, "my-image", LayerArns{}, dir)
+	require.NoError(t, err)
+	assert.Nil(t, m.Function)
+
+	manifestPath, err := WriteManifest(dir, m)
+	require.NoError(t, err)
+	_, repacked, err := ReadManifest(manifestPath)
+	require.NoError(t, err)
+	assert.Nil(t, repacked.Function)
+}
+
+func TestReadManifestOfChangedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	layerFile := writeTestFile(t, dir, "layer-1.zip", "layer 1")
+	image := &types.RepackedImage{Layers: []types.LambdaLayer{{Digest: "sha256:1", File: layerFile}}}
+	m, err := NewManifest(image, "my-image", LayerArns{}, dir)
+	require.NoError(t, err)
+	manifestPath, err := WriteManifest(dir, m)
+	require.NoError(t, err)
+
+	writeTestFile(t, dir, "layer-1.zip", "layer 2")
+	_, _, err = ReadManifest(manifestPath)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "was changed since the conversion")
+
+	require.NoError(t, os.Remove(layerFile))
+	_, _, err = ReadManifest(manifestPath)
+	assert.Error(t, err)
+
+	_, _, err = ReadManifest(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
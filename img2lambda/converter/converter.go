@@ -0,0 +1,423 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+// Package converter repackages container images into Lambda layers and function deployment packages,
+// and publishes the layers to Lambda. It is the library behind the img2lambda command line tool.
+package converter
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/codesign"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/conversion"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/extract"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/lock"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/publish"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/report"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/secrets"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/validate"
+)
+
+// Supported image types
+const (
+	ImageTypeDocker            = "docker"             // Image in the local Docker daemon
+	ImageTypeOCI               = "oci"                // OCI image archive
+	ImageTypeDockerArchive     = "docker-archive"     // Image archive created by 'docker save'
+	ImageTypeOCIDir            = "oci-dir"            // OCI image layout directory
+	ImageTypeDir               = "dir"                // Directory of manifest, config and layer files, as written by 'skopeo copy'
+	ImageTypeContainersStorage = "containers-storage" // Image in the local containers storage used by podman and buildah
+	ImageTypeAuto              = "auto"               // Detects the type of an image archive or directory, otherwise uses the Docker daemon
+)
+
+const defaultLayerPrefix = "img2lambda"
+
+// Returned when the image has no files under /opt or /var/task
+var ErrNothingToConvert = errors.New("No compatible layers or function files found in the image (likely nothing found in /opt and /var/task)")
+
+type Converter struct {
+	opts types.ConverterOptions
+}
+
+func New(opts *types.ConverterOptions) *Converter {
+	converter := &Converter{opts: *opts}
+	if converter.opts.ImageType == "" {
+		converter.opts.ImageType = ImageTypeDocker
+	}
+	if converter.opts.LayerPrefix == "" {
+		converter.opts.LayerPrefix = defaultLayerPrefix
+	}
+	return converter
+}
+
+// Repackages the image into Lambda layer files and a function deployment package in the output directory,
+// signs them if the converter has a Signer client and signing profile,
+// and publishes the layers if the converter has a Lambda client.
+// Results files are only written to the output directory if requested in the options, along with
+// the conversion manifest from which Publish can publish the layers later.
+func (c *Converter) Convert(ctx context.Context, image string) (*types.Report, error) {
+	if c.opts.OutputDir == "" {
+		return nil, errors.New("output directory is required")
+	}
+
+	imageLocation, err := ImageReference(image, c.opts.ImageType)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.opts.LambdaClient != nil {
+		// Fail before repacking the image if the layers could not be published
+		if _, err := publish.ParseLayerTemplates(c.opts.LayerNameTemplate, c.opts.Description); err != nil {
+			return nil, err
+		}
+	}
+
+	extractOpts, err := c.ExtractOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	var baseLayerArns []string
+	if c.opts.BaseLayersFile != "" {
+		baseLayerArns, err = publish.ReadLayerArns(c.opts.BaseLayersFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading base image layers: %v", err)
+		}
+	}
+
+	for _, arn := range append(append([]string{}, c.opts.PrependLayerArns...), c.opts.AppendLayerArns...) {
+		if err := publish.ValidateLayerArn(arn); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := extract.ParseLayerSelectors(append(append([]string{}, c.opts.IncludeLayers...), c.opts.ExcludeLayers...)); err != nil {
+		return nil, err
+	}
+	if _, err := validate.ParseHandlerFileTemplate(c.opts.HandlerFile); err != nil {
+		return nil, err
+	}
+
+	repacked, err := extract.RepackImage(ctx, imageLocation, extractOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	if repacked.Function.FileCount == 0 {
+		// remove empty zip file
+		os.Remove(repacked.Function.File)
+	}
+
+	if len(repacked.Layers) == 0 && repacked.Function.FileCount == 0 {
+		return nil, ErrNothingToConvert
+	}
+
+	// Fail before signing and publishing files that the function could not start from
+	err = validate.ValidateFunction(repacked, &types.ValidationOptions{
+		Runtime:             c.opts.Runtime,
+		Handler:             c.opts.Handler,
+		HandlerFileTemplate: c.opts.HandlerFile,
+		ExternalLayers:      len(baseLayerArns) > 0 || c.opts.BaseImage != "" || len(c.opts.PrependLayerArns) > 0 || len(c.opts.AppendLayerArns) > 0,
+		Logger:              c.opts.Logger,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Fail before signing and publishing layers that functions could not use together
+	layerCount := len(c.opts.PrependLayerArns) + len(baseLayerArns) + len(repacked.Layers) + len(c.opts.AppendLayerArns)
+	if err := publish.CheckLayerCount(layerCount); err != nil {
+		if c.opts.LambdaClient != nil {
+			return nil, err
+		}
+		c.opts.Logger.Warnf("%v", err)
+	}
+
+	arns := conversion.LayerArns{Base: baseLayerArns, Prepend: c.opts.PrependLayerArns, Append: c.opts.AppendLayerArns}
+	resultsDir := ""
+	if c.opts.WriteResults {
+		// Record the files before signing and publishing, which may remove them
+		manifest, err := conversion.NewManifest(repacked, image, arns, c.opts.OutputDir)
+		if err != nil {
+			return nil, err
+		}
+		manifestPath, err := conversion.WriteManifest(c.opts.OutputDir, manifest)
+		if err != nil {
+			return nil, err
+		}
+		c.opts.Logger.Infof("Conversion manifest is written to %s", manifestPath)
+		resultsDir = c.opts.OutputDir
+	}
+	return c.signAndPublish(ctx, repacked, image, arns, resultsDir)
+}
+
+// Options for reading and repacking images like Convert does, so that commands comparing or inspecting
+// images see the same Lambda layers and function deployment package as a conversion
+func (c *Converter) ExtractOptions() (*types.ExtractOptions, error) {
+	var baseImageLocation string
+	if c.opts.BaseImage != "" {
+		var err error
+		baseImageLocation, err = ImageReference(c.opts.BaseImage, c.opts.ImageType)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &types.ExtractOptions{
+		OutputDir:           c.opts.OutputDir,
+		SBOM:                c.opts.SBOM,
+		SecretsAllowlist:    c.opts.SecretsAllowlist,
+		FlattenWhiteouts:    c.opts.FlattenWhiteouts,
+		BaseImage:           baseImageLocation,
+		IncludeLayers:       c.opts.IncludeLayers,
+		MaxLayerSize:        c.opts.MaxLayerSize,
+		SeparateExtensions:  c.opts.SeparateExtensions,
+		BundleLibraries:     c.opts.BundleLibraries,
+		PruneEnvironment:    c.opts.PruneEnvironment,
+		Runtime:             c.opts.Runtime,
+		EnvironmentManifest: c.opts.EnvironmentManifest,
+		KeepFiles:           c.opts.KeepFiles,
+		ExcludeLayers:       c.opts.ExcludeLayers,
+		SystemContext:       c.opts.SystemContext,
+		Signatures:          c.opts.Signatures,
+		Logger:              c.opts.Logger,
+		Progress:            c.opts.Progress,
+	}, nil
+}
+
+// Publishes the Lambda layers listed in a conversion manifest, which was written by an earlier
+// conversion with results files. The layer files must not have changed since the conversion.
+// Signs them first if the converter has a Signer client and signing profile. The results files
+// and report are written to the directory of the manifest.
+func (c *Converter) Publish(ctx context.Context, manifestFile string) (*types.Report, error) {
+	if c.opts.LambdaClient == nil {
+		return nil, errors.New("Lambda client is required to publish layers")
+	}
+	if _, err := publish.ParseLayerTemplates(c.opts.LayerNameTemplate, c.opts.Description); err != nil {
+		return nil, err
+	}
+
+	manifest, repacked, err := conversion.ReadManifest(manifestFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(repacked.Layers) == 0 && repacked.Function == nil {
+		return nil, ErrNothingToConvert
+	}
+
+	arns := conversion.LayerArns{
+		Base:    manifest.BaseLayerArns,
+		Prepend: manifest.PrependLayerArns,
+		Append:  manifest.AppendLayerArns,
+	}
+	if err := publish.CheckLayerCount(len(arns.Prepend) + len(arns.Base) + len(repacked.Layers) + len(arns.Append)); err != nil {
+		return nil, err
+	}
+
+	c.opts.Logger.Infof("Publishing the Lambda layers of image %s converted by img2lambda %s", manifest.Image, manifest.ToolVersion)
+	return c.signAndPublish(ctx, repacked, manifest.Image, arns, filepath.Dir(manifestFile))
+}
+
+// Signs the repacked files and publishes the layers as configured, writing the results files,
+// lock and report to the results directory unless it is empty
+func (c *Converter) signAndPublish(ctx context.Context, repacked *types.RepackedImage, image string, arns conversion.LayerArns, resultsDir string) (*types.Report, error) {
+	signing := c.opts.SignerClient != nil && c.opts.SigningProfile != ""
+	if signing || c.opts.LambdaClient != nil {
+		// Potential secrets are only reported by dry-runs, they must not leave the machine
+		var allowlist *secrets.Allowlist
+		if c.opts.SecretsAllowlist != "" {
+			var err error
+			allowlist, err = secrets.LoadAllowlist(c.opts.SecretsAllowlist)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := secrets.Check(repacked.SecretFindings, allowlist); err != nil {
+			return nil, err
+		}
+	}
+
+	if signing {
+		err := codesign.SignRepackedImage(ctx, &types.SigningOptions{
+			SignerClient:   c.opts.SignerClient,
+			S3Client:       c.opts.S3Client,
+			SigningProfile: c.opts.SigningProfile,
+			Bucket:         c.opts.SigningBucket,
+			Prefix:         c.opts.LayerPrefix + "/",
+			Logger:         c.opts.Logger,
+			Progress:       c.opts.Progress,
+		}, repacked)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var published *types.PublishedLayers
+	if c.opts.LambdaClient != nil {
+		var err error
+		published, err = publish.PublishLambdaLayers(ctx, &types.PublishOptions{
+			LambdaClient:       c.opts.LambdaClient,
+			LayerPrefix:        c.opts.LayerPrefix,
+			LayerNameTemplate:  c.opts.LayerNameTemplate,
+			SourceImageName:    image,
+			ManifestDigest:     repacked.ManifestDigest,
+			Description:        c.opts.Description,
+			LicenseInfo:        c.opts.LicenseInfo,
+			CompatibleRuntimes: c.opts.CompatibleRuntimes,
+			KeepLayerFiles:     c.opts.KeepLayerFiles,
+			BaseLayerArns:      arns.Base,
+			PrependLayerArns:   arns.Prepend,
+			AppendLayerArns:    arns.Append,
+			ResultsDir:         resultsDir,
+			Logger:             c.opts.Logger,
+			Progress:           c.opts.Progress,
+		}, repacked.Layers)
+		if err != nil {
+			return nil, err
+		}
+
+		if resultsDir != "" {
+			locked, err := lock.New(repacked, image, published)
+			if err != nil {
+				return nil, err
+			}
+			lockPath, err := lock.Write(resultsDir, locked, c.opts.Logger)
+			if err != nil {
+				return nil, err
+			}
+			c.opts.Logger.Infof("Published layer versions are locked in %s", lockPath)
+		}
+	}
+
+	result, err := report.NewReport(repacked, published)
+	if err != nil {
+		return nil, err
+	}
+
+	if resultsDir != "" {
+		reportPath, err := report.WriteReport(resultsDir, result)
+		if err != nil {
+			return nil, err
+		}
+		c.opts.Logger.Infof("Report of this run is written to %s", reportPath)
+	}
+
+	return result, nil
+}
+
+// Converts the image name and type to a containers/image transport reference
+func ImageReference(image string, imageType string) (string, error) {
+	if imageType == ImageTypeAuto {
+		var err error
+		imageType, err = DetectImageType(image)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var imageTransport string
+	switch imageType {
+	case ImageTypeDocker:
+		imageTransport = "docker-daemon:"
+	case ImageTypeOCI:
+		imageTransport = "oci-archive:"
+	case ImageTypeDockerArchive:
+		imageTransport = "docker-archive:"
+	case ImageTypeOCIDir:
+		imageTransport = "oci:"
+	case ImageTypeDir:
+		imageTransport = "dir:"
+	case ImageTypeContainersStorage:
+		imageTransport = "containers-storage:"
+	default:
+		return "", errors.New("Image type must be one of the supported image types")
+	}
+
+	imageLocation := imageTransport + image
+	if imageType == ImageTypeDocker && strings.Count(imageLocation, ":") == 1 {
+		imageLocation += ":latest"
+	}
+
+	return imageLocation, nil
+}
+
+// Detects the type of the image at the given path from the files in the archive or directory.
+// Images that are not a path are expected to be in the Docker daemon.
+func DetectImageType(image string) (string, error) {
+	info, err := os.Stat(image)
+	if err != nil {
+		return ImageTypeDocker, nil
+	}
+
+	if info.IsDir() {
+		switch {
+		case fileExists(filepath.Join(image, "oci-layout")):
+			return ImageTypeOCIDir, nil
+		case fileExists(filepath.Join(image, "version")) && fileExists(filepath.Join(image, "manifest.json")):
+			return ImageTypeDir, nil
+		default:
+			return "", fmt.Errorf("could not detect image type: directory %s is neither an OCI image layout nor a dir image", image)
+		}
+	}
+
+	names, err := listArchive(image)
+	if err != nil {
+		return "", fmt.Errorf("could not detect image type: reading %s: %v", image, err)
+	}
+	switch {
+	case names["oci-layout"]:
+		return ImageTypeOCI, nil
+	case names["manifest.json"]:
+		return ImageTypeDockerArchive, nil
+	default:
+		return "", fmt.Errorf("could not detect image type: archive %s is neither an OCI image archive nor a Docker image archive", image)
+	}
+}
+
+func fileExists(filename string) bool {
+	_, err := os.Stat(filename)
+	return err == nil
+}
+
+// Lists the names of the files in a tar archive, which may be gzip-compressed
+func listArchive(filename string) (map[string]bool, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var archive io.Reader = r
+	if magic, err := r.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzipReader, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer gzipReader.Close()
+		archive = gzipReader
+	}
+
+	names := make(map[string]bool)
+	t := tar.NewReader(archive)
+	for {
+		hdr, err := t.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		names[path.Clean(hdr.Name)] = true
+	}
+	return names, nil
+}
@@ -0,0 +1,437 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package converter
+
+import (
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/signer"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/conversion"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/internal/testing/mocks"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/secrets"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+const testImage = "testdata/oci-image.tar"
+
+const testLayerDigest = "sha256:233b6ec1f7cabde7a8b5cf241a8a736fc06e89d17f5b9ffe1930a6c110657e4e"
+
+func TestImageReference(t *testing.T) {
+	reference, err := ImageReference("my-image", ImageTypeDocker)
+	assert.Nil(t, err)
+	assert.Equal(t, "docker-daemon:my-image:latest", reference)
+
+	reference, err = ImageReference("my-image:1.0", ImageTypeDocker)
+	assert.Nil(t, err)
+	assert.Equal(t, "docker-daemon:my-image:1.0", reference)
+
+	reference, err = ImageReference("./my-image.tar", ImageTypeOCI)
+	assert.Nil(t, err)
+	assert.Equal(t, "oci-archive:./my-image.tar", reference)
+
+	reference, err = ImageReference("./my-image.tar", ImageTypeDockerArchive)
+	assert.Nil(t, err)
+	assert.Equal(t, "docker-archive:./my-image.tar", reference)
+
+	reference, err = ImageReference("./my-image:1.0", ImageTypeOCIDir)
+	assert.Nil(t, err)
+	assert.Equal(t, "oci:./my-image:1.0", reference)
+
+	reference, err = ImageReference("./my-image", ImageTypeDir)
+	assert.Nil(t, err)
+	assert.Equal(t, "dir:./my-image", reference)
+
+	reference, err = ImageReference("localhost/my-image:1.0", ImageTypeContainersStorage)
+	assert.Nil(t, err)
+	assert.Equal(t, "containers-storage:localhost/my-image:1.0", reference)
+
+	reference, err = ImageReference("testdata/docker-image.tar", ImageTypeAuto)
+	assert.Nil(t, err)
+	assert.Equal(t, "docker-archive:testdata/docker-image.tar", reference)
+
+	_, err = ImageReference("my-image", "podman")
+	assert.Error(t, err)
+}
+
+func TestDetectImageType(t *testing.T) {
+	for image, expectedType := range map[string]string{
+		"testdata/oci-image.tar":    ImageTypeOCI,
+		"testdata/docker-image.tar": ImageTypeDockerArchive,
+		"testdata/oci-image-dir":    ImageTypeOCIDir,
+		"testdata/dir-image":        ImageTypeDir,
+		"my-image:latest":           ImageTypeDocker,
+	} {
+		imageType, err := DetectImageType(image)
+		assert.Nil(t, err, image)
+		assert.Equal(t, expectedType, imageType, image)
+	}
+
+	// Compressed 'docker save' output
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	contents, err := ioutil.ReadFile("testdata/docker-image.tar")
+	assert.Nil(t, err)
+	compressed, err := os.Create(filepath.Join(dir, "docker-image.tar.gz"))
+	assert.Nil(t, err)
+	gzipWriter := gzip.NewWriter(compressed)
+	_, err = gzipWriter.Write(contents)
+	assert.Nil(t, err)
+	assert.Nil(t, gzipWriter.Close())
+	assert.Nil(t, compressed.Close())
+
+	imageType, err := DetectImageType(compressed.Name())
+	assert.Nil(t, err)
+	assert.Equal(t, ImageTypeDockerArchive, imageType)
+
+	_, err = DetectImageType("testdata")
+	assert.Error(t, err)
+
+	_, err = DetectImageType("converter.go")
+	assert.Error(t, err)
+}
+
+func TestConvertImageTypes(t *testing.T) {
+	for image, imageType := range map[string]string{
+		"testdata/oci-image.tar":        ImageTypeOCI,
+		"testdata/docker-image.tar":     ImageTypeDockerArchive,
+		"testdata/oci-image-dir:latest": ImageTypeOCIDir,
+		"testdata/dir-image":            ImageTypeDir,
+		"testdata/oci-image-dir":        ImageTypeAuto,
+	} {
+		dir, err := ioutil.TempDir("", "")
+		assert.Nil(t, err)
+
+		result, err := New(&types.ConverterOptions{ImageType: imageType, OutputDir: dir}).Convert(context.Background(), image)
+		assert.Nil(t, err, image)
+		assert.Len(t, result.Layers, 1, image)
+		assert.Equal(t, 1, result.Function.FileCount, image)
+
+		os.RemoveAll(dir)
+	}
+}
+
+func TestConvertWithoutPublishing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	converter := New(&types.ConverterOptions{ImageType: ImageTypeOCI, OutputDir: dir})
+	result, err := converter.Convert(context.Background(), testImage)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "oci-archive:"+testImage, result.Image)
+	assert.NotEmpty(t, result.ManifestDigest)
+	assert.False(t, result.Published)
+	assert.Len(t, result.Layers, 1)
+	assert.Equal(t, testLayerDigest, result.Layers[0].ImageLayerDigest)
+	assert.Equal(t, filepath.Join(dir, "layer-1.zip"), result.Layers[0].File)
+	assert.Equal(t, types.LayerStatusNotPublished, result.Layers[0].Status)
+	assert.NotEmpty(t, result.Layers[0].CodeSha256)
+	assert.Equal(t, 1, result.Function.FileCount)
+	assert.Equal(t, filepath.Join(dir, "function.zip"), result.Function.File)
+
+	// Results files are only written if requested
+	_, err = os.Stat(filepath.Join(dir, "report.json"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestConvertVerifiesSignaturePolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	acceptPolicy := filepath.Join(dir, "accept.json")
+	assert.Nil(t, ioutil.WriteFile(acceptPolicy, []byte(`{"default": [{"type": "insecureAcceptAnything"}]}`), 0644))
+	rejectPolicy := filepath.Join(dir, "reject.json")
+	assert.Nil(t, ioutil.WriteFile(rejectPolicy, []byte(`{"default": [{"type": "reject"}]}`), 0644))
+
+	outputDir := filepath.Join(dir, "output")
+	converter := New(&types.ConverterOptions{ImageType: ImageTypeOCI, OutputDir: outputDir, Signatures: types.SignatureOptions{PolicyFile: acceptPolicy}})
+	result, err := converter.Convert(context.Background(), testImage)
+	assert.Nil(t, err)
+	assert.Equal(t, &types.SignatureVerification{ManifestDigest: result.ManifestDigest, PolicyFile: acceptPolicy}, result.Verification)
+
+	// Rejected images are not converted
+	assert.Nil(t, os.RemoveAll(outputDir))
+	converter = New(&types.ConverterOptions{ImageType: ImageTypeOCI, OutputDir: outputDir, Signatures: types.SignatureOptions{PolicyFile: rejectPolicy}})
+	_, err = converter.Convert(context.Background(), testImage)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "image is not allowed by signature policy")
+	_, err = os.Stat(outputDir)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestConvertSkipsBaseImageLayers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// All layers of the image are in its base image
+	converter := New(&types.ConverterOptions{ImageType: ImageTypeDir, OutputDir: dir, BaseImage: "testdata/dir-image"})
+	_, err = converter.Convert(context.Background(), "testdata/dir-image")
+	assert.Equal(t, ErrNothingToConvert, err)
+
+	converter = New(&types.ConverterOptions{ImageType: ImageTypeDir, OutputDir: dir, BaseImage: "testdata/does-not-exist"})
+	_, err = converter.Convert(context.Background(), "testdata/dir-image")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "opening base image dir:testdata/does-not-exist")
+}
+
+func TestConvertValidatesHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	converter := New(&types.ConverterOptions{ImageType: ImageTypeDir, OutputDir: dir, Runtime: "python3.8", Handler: "hello.handler"})
+	_, err = converter.Convert(context.Background(), "testdata/dir-image")
+	assert.Nil(t, err)
+
+	converter = New(&types.ConverterOptions{ImageType: ImageTypeDir, OutputDir: dir, Runtime: "python3.8", Handler: "missing.handler"})
+	_, err = converter.Convert(context.Background(), "testdata/dir-image")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "handler missing.handler needs one of /var/task/missing.py")
+
+	converter = New(&types.ConverterOptions{ImageType: ImageTypeDir, OutputDir: dir, Runtime: "provided", Handler: "hello.handler", HandlerFile: "{{.Unknown}}"})
+	_, err = converter.Convert(context.Background(), "testdata/dir-image")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid handler file template")
+}
+
+func TestConvertAndPublish(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	lambdaClient := mocks.NewMockLambdaAPI(ctrl)
+	layerName := "my-app-sha256-233b6ec1f7cabde7a8b5cf241a8a736fc06e89d17f5b9ffe1930a6c110657e4e"
+	layerArn := "arn:aws:lambda:us-east-1:123456789012:layer:" + layerName + ":1"
+
+	gomock.InOrder(
+		lambdaClient.EXPECT().
+			ListLayerVersionsWithContext(gomock.Any(), gomock.Eq(&lambda.ListLayerVersionsInput{LayerName: aws.String(layerName)})).
+			Return(&lambda.ListLayerVersionsOutput{}, nil),
+		lambdaClient.EXPECT().
+			PublishLayerVersionWithContext(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(&lambda.PublishLayerVersionOutput{LayerVersionArn: aws.String(layerArn), Version: aws.Int64(1)}, nil),
+	)
+
+	converter := New(&types.ConverterOptions{
+		ImageType:    ImageTypeOCI,
+		OutputDir:    dir,
+		LambdaClient: lambdaClient,
+		LayerPrefix:  "my-app",
+		WriteResults: true,
+	})
+	result, err := converter.Convert(context.Background(), testImage)
+	assert.Nil(t, err)
+
+	assert.True(t, result.Published)
+	assert.Len(t, result.Layers, 1)
+	assert.Equal(t, types.LayerStatusPublished, result.Layers[0].Status)
+	assert.Equal(t, layerArn, result.Layers[0].Arn)
+	assert.Equal(t, int64(1), result.Layers[0].Version)
+
+	for _, resultsFile := range []string{"report.json", "layers.json", "layers.yaml", "provenance.json", "img2lambda.lock"} {
+		_, err = os.Stat(filepath.Join(dir, resultsFile))
+		assert.Nil(t, err, resultsFile)
+	}
+}
+
+func TestConvertThenPublishFromManifest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	converted, err := New(&types.ConverterOptions{
+		ImageType:    ImageTypeOCI,
+		OutputDir:    dir,
+		WriteResults: true,
+	}).Convert(context.Background(), testImage)
+	assert.Nil(t, err)
+	assert.False(t, converted.Published)
+	manifestFile := filepath.Join(dir, "conversion.json")
+	_, err = os.Stat(manifestFile)
+	assert.Nil(t, err)
+
+	lambdaClient := mocks.NewMockLambdaAPI(ctrl)
+	layerName := "my-app-sha256-233b6ec1f7cabde7a8b5cf241a8a736fc06e89d17f5b9ffe1930a6c110657e4e"
+	layerArn := "arn:aws:lambda:us-east-1:123456789012:layer:" + layerName + ":1"
+
+	gomock.InOrder(
+		lambdaClient.EXPECT().
+			ListLayerVersionsWithContext(gomock.Any(), gomock.Eq(&lambda.ListLayerVersionsInput{LayerName: aws.String(layerName)})).
+			Return(&lambda.ListLayerVersionsOutput{}, nil),
+		lambdaClient.EXPECT().
+			PublishLayerVersionWithContext(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(&lambda.PublishLayerVersionOutput{LayerVersionArn: aws.String(layerArn), Version: aws.Int64(1)}, nil),
+	)
+
+	result, err := New(&types.ConverterOptions{
+		LambdaClient: lambdaClient,
+		LayerPrefix:  "my-app",
+	}).Publish(context.Background(), manifestFile)
+	assert.Nil(t, err)
+
+	assert.True(t, result.Published)
+	assert.Equal(t, converted.ManifestDigest, result.ManifestDigest)
+	assert.Len(t, result.Layers, 1)
+	assert.Equal(t, testLayerDigest, result.Layers[0].ImageLayerDigest)
+	assert.Equal(t, converted.Layers[0].CodeSha256, result.Layers[0].CodeSha256)
+	assert.Equal(t, layerArn, result.Layers[0].Arn)
+
+	for _, resultsFile := range []string{"report.json", "layers.json", "layers.yaml", "provenance.json", "img2lambda.lock"} {
+		_, err = os.Stat(filepath.Join(dir, resultsFile))
+		assert.Nil(t, err, resultsFile)
+	}
+}
+
+func TestPublishRequiresLambdaClient(t *testing.T) {
+	_, err := New(&types.ConverterOptions{}).Publish(context.Background(), "conversion.json")
+	assert.Error(t, err)
+}
+
+func TestConvertSignAndPublish(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	lambdaClient := mocks.NewMockLambdaAPI(ctrl)
+	signerClient := mocks.NewMockSignerAPI(ctrl)
+	s3Client := mocks.NewMockS3API(ctrl)
+	layerArn := "arn:aws:lambda:us-east-1:123456789012:layer:my-app-sha256-233b6ec1f7cabde7a8b5cf241a8a736fc06e89d17f5b9ffe1930a6c110657e4e:1"
+
+	// The layer and the function deployment package are signed, then the signed layer is published from S3
+	s3Client.EXPECT().PutObjectWithContext(gomock.Any(), gomock.Any(), gomock.Any()).Return(&s3.PutObjectOutput{VersionId: aws.String("1")}, nil).Times(2)
+	gomock.InOrder(
+		signerClient.EXPECT().StartSigningJobWithContext(gomock.Any(), gomock.Any()).Return(&signer.StartSigningJobOutput{JobId: aws.String("layer-job")}, nil),
+		signerClient.EXPECT().StartSigningJobWithContext(gomock.Any(), gomock.Any()).Return(&signer.StartSigningJobOutput{JobId: aws.String("function-job")}, nil),
+	)
+	signerClient.EXPECT().WaitUntilSuccessfulSigningJobWithContext(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+	signerClient.EXPECT().DescribeSigningJobWithContext(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, input *signer.DescribeSigningJobInput, opts ...interface{}) (*signer.DescribeSigningJobOutput, error) {
+			return &signer.DescribeSigningJobOutput{SignedObject: &signer.SignedObject{S3: &signer.S3SignedObject{
+				BucketName: aws.String("signing-bucket"),
+				Key:        aws.String("my-app/signed/" + aws.StringValue(input.JobId) + ".zip"),
+			}}}, nil
+		}).Times(2)
+	lambdaClient.EXPECT().
+		PublishLayerVersionWithContext(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, input *lambda.PublishLayerVersionInput, opts ...interface{}) (*lambda.PublishLayerVersionOutput, error) {
+			assert.Equal(t, "my-app/signed/layer-job.zip", aws.StringValue(input.Content.S3Key))
+			assert.Nil(t, input.Content.ZipFile)
+			return &lambda.PublishLayerVersionOutput{LayerVersionArn: aws.String(layerArn), Version: aws.Int64(1)}, nil
+		})
+
+	converter := New(&types.ConverterOptions{
+		ImageType:      ImageTypeOCI,
+		OutputDir:      dir,
+		LambdaClient:   lambdaClient,
+		SignerClient:   signerClient,
+		S3Client:       s3Client,
+		SigningProfile: "my-profile",
+		SigningBucket:  "signing-bucket",
+		LayerPrefix:    "my-app",
+	})
+	result, err := converter.Convert(context.Background(), testImage)
+	assert.Nil(t, err)
+
+	assert.Len(t, result.Layers, 1)
+	assert.Equal(t, layerArn, result.Layers[0].Arn)
+	assert.Equal(t, &types.SignedArtifact{SigningJobID: "layer-job", S3Bucket: "signing-bucket", S3Key: "my-app/signed/layer-job.zip"}, result.Layers[0].Signed)
+	assert.Equal(t, &types.SignedArtifact{SigningJobID: "function-job", S3Bucket: "signing-bucket", S3Key: "my-app/signed/function-job.zip"}, result.Function.Signed)
+}
+
+func TestExtractOptions(t *testing.T) {
+	extractOpts, err := New(&types.ConverterOptions{
+		ImageType:          ImageTypeOCI,
+		OutputDir:          "./output",
+		BaseImage:          "base.tar",
+		IncludeLayers:      []string{"2"},
+		ExcludeLayers:      []string{"3"},
+		MaxLayerSize:       1000,
+		SeparateExtensions: true,
+		BundleLibraries:    true,
+		Signatures:         types.SignatureOptions{PolicyFile: "policy.json"},
+	}).ExtractOptions()
+	assert.Nil(t, err)
+
+	assert.Equal(t, "oci-archive:base.tar", extractOpts.BaseImage)
+	assert.Equal(t, []string{"2"}, extractOpts.IncludeLayers)
+	assert.Equal(t, []string{"3"}, extractOpts.ExcludeLayers)
+	assert.Equal(t, int64(1000), extractOpts.MaxLayerSize)
+	assert.True(t, extractOpts.SeparateExtensions)
+	assert.True(t, extractOpts.BundleLibraries)
+	assert.Equal(t, "policy.json", extractOpts.Signatures.PolicyFile)
+}
+
+func TestConvertRequiresOutputDir(t *testing.T) {
+	_, err := New(&types.ConverterOptions{ImageType: ImageTypeOCI}).Convert(context.Background(), testImage)
+	assert.EqualError(t, err, "output directory is required")
+}
+
+func TestPublishFailsOnSecretFindings(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = New(&types.ConverterOptions{
+		ImageType:    ImageTypeOCI,
+		OutputDir:    dir,
+		WriteResults: true,
+	}).Convert(context.Background(), testImage)
+	assert.Nil(t, err)
+
+	// Conversions only report the findings
+	manifestFile := filepath.Join(dir, "conversion.json")
+	manifest, _, err := conversion.ReadManifest(manifestFile)
+	assert.Nil(t, err)
+	manifest.SecretFindings = []secrets.Finding{
+		{Rule: "private-key", Description: "private key", Path: "opt/certs/test.pem", LayerDigest: testLayerDigest},
+	}
+	_, err = conversion.WriteManifest(dir, manifest)
+	assert.Nil(t, err)
+
+	lambdaClient := mocks.NewMockLambdaAPI(ctrl)
+	_, err = New(&types.ConverterOptions{LambdaClient: lambdaClient}).Publish(context.Background(), manifestFile)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "found 1 potential secrets in files packaged for Lambda")
+	assert.Contains(t, err.Error(), "opt/certs/test.pem: private key (rule private-key)")
+
+	// Findings allowed when publishing are published
+	allowlistFile := filepath.Join(dir, "allowlist")
+	assert.Nil(t, ioutil.WriteFile(allowlistFile, []byte("private-key opt/certs/*.pem\n"), 0644))
+	lambdaClient.EXPECT().
+		ListLayerVersionsWithContext(gomock.Any(), gomock.Any()).
+		Return(&lambda.ListLayerVersionsOutput{}, nil)
+	lambdaClient.EXPECT().
+		PublishLayerVersionWithContext(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(&lambda.PublishLayerVersionOutput{LayerVersionArn: aws.String("arn:aws:lambda:us-east-1:123456789012:layer:my-app:1"), Version: aws.Int64(1)}, nil)
+	result, err := New(&types.ConverterOptions{LambdaClient: lambdaClient, SecretsAllowlist: allowlistFile}).Publish(context.Background(), manifestFile)
+	assert.Nil(t, err)
+	assert.True(t, result.Published)
+	assert.Len(t, result.SecretFindings, 1)
+}
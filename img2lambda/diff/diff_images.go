@@ -0,0 +1,191 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package diff
+
+import (
+	"archive/zip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/extract"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/publish"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
+)
+
+// Repacks both images into temporary directories and compares the resulting
+// Lambda layers and function deployment packages
+func DiffImages(ctx context.Context, oldImageName string, newImageName string, opts *types.ExtractOptions) (*types.ImageDiff, error) {
+	dir, err := ioutil.TempDir("", "img2lambda-diff-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	oldOpts := *opts
+	oldOpts.OutputDir = filepath.Join(dir, "old")
+	oldImage, err := extract.RepackImage(ctx, oldImageName, &oldOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	newOpts := *opts
+	newOpts.OutputDir = filepath.Join(dir, "new")
+	newImage, err := extract.RepackImage(ctx, newImageName, &newOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	imageDiff, err := diffRepackedImages(oldImage.Layers, oldImage.Function, newImage.Layers, newImage.Function)
+	if err != nil {
+		return nil, err
+	}
+
+	imageDiff.OldImage = oldImageName
+	imageDiff.NewImage = newImageName
+	return imageDiff, nil
+}
+
+func diffRepackedImages(oldLayers []types.LambdaLayer, oldFunction *types.LambdaDeploymentPackage,
+	newLayers []types.LambdaLayer, newFunction *types.LambdaDeploymentPackage) (*types.ImageDiff, error) {
+
+	imageDiff := &types.ImageDiff{Layers: []types.LayerDiff{}}
+
+	oldHashes := make(map[layerKey]string)
+	for _, layer := range oldLayers {
+		hash, _, err := hashLayerFile(layer.File)
+		if err != nil {
+			return nil, err
+		}
+		oldHashes[keyOf(layer)] = hash
+	}
+
+	newKeys := make(map[layerKey]bool)
+	for _, layer := range newLayers {
+		newKeys[keyOf(layer)] = true
+
+		hash, size, err := hashLayerFile(layer.File)
+		if err != nil {
+			return nil, err
+		}
+
+		// Layers are published under a name derived from the image layer digest and part, and
+		// matched to existing layer versions by their hash, like matchExistingLambdaLayer
+		status := types.LayerNew
+		if oldHash, found := oldHashes[keyOf(layer)]; found && oldHash == hash {
+			status = types.LayerUnchanged
+		}
+
+		imageDiff.Layers = append(imageDiff.Layers, types.LayerDiff{
+			Digest:     layer.Digest,
+			Part:       layer.Part,
+			Status:     status,
+			CodeSha256: hash,
+			CodeSize:   size,
+		})
+	}
+
+	for _, layer := range oldLayers {
+		if newKeys[keyOf(layer)] {
+			continue
+		}
+
+		imageDiff.Layers = append(imageDiff.Layers, types.LayerDiff{
+			Digest:     layer.Digest,
+			Part:       layer.Part,
+			Status:     types.LayerRemoved,
+			CodeSha256: oldHashes[keyOf(layer)],
+		})
+	}
+
+	functionDiff, err := diffFunctionFiles(oldFunction, newFunction)
+	if err != nil {
+		return nil, err
+	}
+	imageDiff.Function = *functionDiff
+
+	return imageDiff, nil
+}
+
+// Identifies a Lambda layer like its default layer name: the parts of a split image layer are different layers
+type layerKey struct {
+	digest string
+	part   int
+}
+
+func keyOf(layer types.LambdaLayer) layerKey {
+	return layerKey{digest: layer.Digest, part: layer.Part}
+}
+
+func hashLayerFile(filename string) (string, int64, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", 0, err
+	}
+	return publish.CodeSha256(contents), int64(len(contents)), nil
+}
+
+type functionFile struct {
+	crc32 uint32
+	size  uint64
+}
+
+// Lists the files in a function deployment package. Files from later image
+// layers are written to the package after the files they overwrite.
+func listFunctionFiles(function *types.LambdaDeploymentPackage) (map[string]functionFile, error) {
+	files := make(map[string]functionFile)
+	if function == nil || function.FileCount == 0 {
+		return files, nil
+	}
+
+	zr, err := zip.OpenReader(function.File)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	for _, zf := range zr.File {
+		files[zf.Name] = functionFile{crc32: zf.CRC32, size: zf.UncompressedSize64}
+	}
+	return files, nil
+}
+
+func diffFunctionFiles(oldFunction *types.LambdaDeploymentPackage, newFunction *types.LambdaDeploymentPackage) (*types.FunctionDiff, error) {
+	oldFiles, err := listFunctionFiles(oldFunction)
+	if err != nil {
+		return nil, err
+	}
+
+	newFiles, err := listFunctionFiles(newFunction)
+	if err != nil {
+		return nil, err
+	}
+
+	functionDiff := &types.FunctionDiff{Added: []string{}, Removed: []string{}, Modified: []string{}}
+
+	for name, newFile := range newFiles {
+		oldFile, found := oldFiles[name]
+		switch {
+		case !found:
+			functionDiff.Added = append(functionDiff.Added, name)
+		case oldFile != newFile:
+			functionDiff.Modified = append(functionDiff.Modified, name)
+		default:
+			functionDiff.UnchangedCount++
+		}
+	}
+
+	for name := range oldFiles {
+		if _, found := newFiles[name]; !found {
+			functionDiff.Removed = append(functionDiff.Removed, name)
+		}
+	}
+
+	sort.Strings(functionDiff.Added)
+	sort.Strings(functionDiff.Removed)
+	sort.Strings(functionDiff.Modified)
+
+	return functionDiff, nil
+}
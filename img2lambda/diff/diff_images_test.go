@@ -0,0 +1,135 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package diff
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func createZipFile(t *testing.T, filename string, files map[string]string) {
+	out, err := os.Create(filename)
+	assert.Nil(t, err)
+	zw := zip.NewWriter(out)
+	for name, contents := range files {
+		w, err := zw.Create(name)
+		assert.Nil(t, err)
+		_, err = w.Write([]byte(contents))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, zw.Close())
+	assert.Nil(t, out.Close())
+}
+
+func TestDiffRepackedImages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// The base layer is unchanged, the runtime layer is replaced
+	createZipFile(t, filepath.Join(dir, "old-layer-1.zip"), map[string]string{"bin/php": "php 7.3"})
+	createZipFile(t, filepath.Join(dir, "old-layer-2.zip"), map[string]string{"bootstrap": "v1"})
+	createZipFile(t, filepath.Join(dir, "new-layer-1.zip"), map[string]string{"bin/php": "php 7.3"})
+	createZipFile(t, filepath.Join(dir, "new-layer-2.zip"), map[string]string{"bootstrap": "v2"})
+
+	oldLayers := []types.LambdaLayer{
+		{Digest: "sha256:1", File: filepath.Join(dir, "old-layer-1.zip")},
+		{Digest: "sha256:2", File: filepath.Join(dir, "old-layer-2.zip")},
+	}
+	newLayers := []types.LambdaLayer{
+		{Digest: "sha256:1", File: filepath.Join(dir, "new-layer-1.zip")},
+		{Digest: "sha256:3", File: filepath.Join(dir, "new-layer-2.zip")},
+	}
+
+	createZipFile(t, filepath.Join(dir, "old-function.zip"), map[string]string{
+		"src/hello.php":   "hello",
+		"src/goodbye.php": "goodbye",
+		"src/old.php":     "old",
+	})
+	createZipFile(t, filepath.Join(dir, "new-function.zip"), map[string]string{
+		"src/hello.php":   "hello",
+		"src/goodbye.php": "goodbye!",
+		"src/new.php":     "new",
+	})
+
+	oldFunction := &types.LambdaDeploymentPackage{FileCount: 3, File: filepath.Join(dir, "old-function.zip")}
+	newFunction := &types.LambdaDeploymentPackage{FileCount: 3, File: filepath.Join(dir, "new-function.zip")}
+
+	imageDiff, err := diffRepackedImages(oldLayers, oldFunction, newLayers, newFunction)
+	assert.Nil(t, err)
+
+	assert.Len(t, imageDiff.Layers, 3)
+	assert.Equal(t, "sha256:1", imageDiff.Layers[0].Digest)
+	assert.Equal(t, types.LayerUnchanged, imageDiff.Layers[0].Status)
+	assert.NotEmpty(t, imageDiff.Layers[0].CodeSha256)
+	assert.Equal(t, "sha256:3", imageDiff.Layers[1].Digest)
+	assert.Equal(t, types.LayerNew, imageDiff.Layers[1].Status)
+	assert.Equal(t, "sha256:2", imageDiff.Layers[2].Digest)
+	assert.Equal(t, types.LayerRemoved, imageDiff.Layers[2].Status)
+
+	assert.Equal(t, []string{"src/new.php"}, imageDiff.Function.Added)
+	assert.Equal(t, []string{"src/old.php"}, imageDiff.Function.Removed)
+	assert.Equal(t, []string{"src/goodbye.php"}, imageDiff.Function.Modified)
+	assert.Equal(t, 1, imageDiff.Function.UnchangedCount)
+}
+
+func TestDiffChangedLayerContents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// Same image layer digest, but different Lambda layer contents (for example from a newer img2lambda version)
+	createZipFile(t, filepath.Join(dir, "old-layer-1.zip"), map[string]string{"bin/php": "php 7.3"})
+	createZipFile(t, filepath.Join(dir, "new-layer-1.zip"), map[string]string{"bin/php": "php 7.3", "extra": "file"})
+
+	oldLayers := []types.LambdaLayer{{Digest: "sha256:1", File: filepath.Join(dir, "old-layer-1.zip")}}
+	newLayers := []types.LambdaLayer{{Digest: "sha256:1", File: filepath.Join(dir, "new-layer-1.zip")}}
+
+	imageDiff, err := diffRepackedImages(oldLayers, &types.LambdaDeploymentPackage{}, newLayers, &types.LambdaDeploymentPackage{})
+	assert.Nil(t, err)
+
+	assert.Len(t, imageDiff.Layers, 1)
+	assert.Equal(t, types.LayerNew, imageDiff.Layers[0].Status)
+	assert.Len(t, imageDiff.Function.Added, 0)
+	assert.Equal(t, 0, imageDiff.Function.UnchangedCount)
+}
+
+func TestDiffSplitLayerParts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// The parts of the same image layer are different Lambda layers, of which only the second changed
+	createZipFile(t, filepath.Join(dir, "old-part-1.zip"), map[string]string{"python/a.py": "a"})
+	createZipFile(t, filepath.Join(dir, "old-part-2.zip"), map[string]string{"python/b.py": "b"})
+	createZipFile(t, filepath.Join(dir, "old-part-3.zip"), map[string]string{"python/c.py": "c"})
+	createZipFile(t, filepath.Join(dir, "new-part-1.zip"), map[string]string{"python/a.py": "a"})
+	createZipFile(t, filepath.Join(dir, "new-part-2.zip"), map[string]string{"python/b.py": "b2"})
+
+	oldLayers := []types.LambdaLayer{
+		{Digest: "sha256:1", Part: 1, File: filepath.Join(dir, "old-part-1.zip")},
+		{Digest: "sha256:1", Part: 2, File: filepath.Join(dir, "old-part-2.zip")},
+		{Digest: "sha256:1", Part: 3, File: filepath.Join(dir, "old-part-3.zip")},
+	}
+	newLayers := []types.LambdaLayer{
+		{Digest: "sha256:1", Part: 1, File: filepath.Join(dir, "new-part-1.zip")},
+		{Digest: "sha256:1", Part: 2, File: filepath.Join(dir, "new-part-2.zip")},
+	}
+
+	imageDiff, err := diffRepackedImages(oldLayers, &types.LambdaDeploymentPackage{}, newLayers, &types.LambdaDeploymentPackage{})
+	assert.Nil(t, err)
+
+	assert.Len(t, imageDiff.Layers, 3)
+	assert.Equal(t, 1, imageDiff.Layers[0].Part)
+	assert.Equal(t, types.LayerUnchanged, imageDiff.Layers[0].Status)
+	assert.Equal(t, 2, imageDiff.Layers[1].Part)
+	assert.Equal(t, types.LayerNew, imageDiff.Layers[1].Status)
+	assert.Equal(t, 3, imageDiff.Layers[2].Part)
+	assert.Equal(t, types.LayerRemoved, imageDiff.Layers[2].Status)
+}
@@ -0,0 +1,204 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+// Package environment describes the files that the Lambda execution environments of the
+// runtimes provide, so that identical copies can be pruned from the function and layers.
+package environment
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// Files and packages that an execution environment provides to the functions of its runtimes
+type Manifest struct {
+	Environment string    `json:"environment"` // Name of the environment, like python or provided.al2
+	Runtimes    []string  `json:"runtimes"`
+	Files       []File    `json:"files"`
+	Packages    []Package `json:"packages,omitempty"`
+
+	byModulePath map[string]File
+	byModuleDir  map[string]Package
+}
+
+// File of the execution environment, identified by where the runtime loads it from
+type File struct {
+	ModulePath string `json:"modulePath"` // Like python/boto3/__init__.py, nodejs/aws-sdk/index.js or lib/libssl.so.10
+	Size       int64  `json:"size"`
+	SHA256     string `json:"sha256"` // Hex-encoded SHA-256 digest of the contents
+}
+
+// Package installed in the execution environment
+type Package struct {
+	Type    string `json:"type"` // Package URL type, like pypi or npm
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+func (m *Manifest) HasRuntime(runtime string) bool {
+	for _, r := range m.Runtimes {
+		if r == runtime {
+			return true
+		}
+	}
+	return false
+}
+
+// Reads a manifest written by 'img2lambda environment-manifest'
+func LoadManifest(filename string) (*Manifest, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("reading environment manifest: %v", err)
+	}
+	m := &Manifest{}
+	if err := json.Unmarshal(contents, m); err != nil {
+		return nil, fmt.Errorf("parsing environment manifest %s: %v", filename, err)
+	}
+	if m.Environment == "" {
+		return nil, fmt.Errorf("parsing environment manifest %s: missing environment name", filename)
+	}
+	return m, nil
+}
+
+// Returns the file of the environment with the module path
+func (m *Manifest) Lookup(modulePath string) (File, bool) {
+	if m.byModulePath == nil {
+		m.byModulePath = map[string]File{}
+		for _, f := range m.Files {
+			m.byModulePath[f.ModulePath] = f
+		}
+	}
+	f, ok := m.byModulePath[modulePath]
+	return f, ok
+}
+
+// Returns the package of the environment in the module directory, like python/boto3
+func (m *Manifest) LookupPackage(moduleDir string) (Package, bool) {
+	if m.byModuleDir == nil {
+		m.byModuleDir = map[string]Package{}
+		for _, p := range m.Packages {
+			if dir, ok := PackageModuleDir(p); ok {
+				m.byModuleDir[dir] = p
+			}
+		}
+	}
+	p, ok := m.byModuleDir[moduleDir]
+	return p, ok
+}
+
+// Module directory that the files of the package are loaded from, like python/boto3 for the PyPI package boto3
+// or nodejs/@aws/foo for the npm package @aws/foo. Python packages are assumed to have a top-level module of their
+// normalized name, which holds for packages like boto3 and requests, but not for packages like PyYAML.
+func PackageModuleDir(p Package) (string, bool) {
+	switch p.Type {
+	case "pypi":
+		return "python/" + strings.NewReplacer("-", "_", ".", "_").Replace(strings.ToLower(p.Name)), true
+	case "npm":
+		return "nodejs/" + p.Name, true
+	default:
+		return "", false
+	}
+}
+
+// Module directory of the package that a module path would belong to, like python/boto3
+// for python/boto3/session.py or nodejs/@aws/foo for nodejs/@aws/foo/index.js
+func ModuleDir(modulePath string) (string, bool) {
+	components := strings.Split(modulePath, "/")
+	switch {
+	case components[0] == "python" && len(components) > 2:
+		return "python/" + strings.ToLower(components[1]), true
+	case components[0] == "nodejs" && strings.HasPrefix(components[1], "@") && len(components) > 3:
+		return strings.Join(components[:3], "/"), true
+	case components[0] == "nodejs" && len(components) > 2:
+		return strings.Join(components[:2], "/"), true
+	default:
+		return "", false
+	}
+}
+
+// Directory that runtimes load modules or libraries from
+type moduleDir struct {
+	pattern string // Path pattern of the directory, without the leading slash
+	kind    string // First component of the module paths of its files: lib, python or nodejs
+}
+
+// Directories of the function and its layers that the runtimes load modules and libraries from,
+// in the order they are matched. Only the directories of the kinds of modules that a runtime loads apply
+// to its functions: /var/task is a Python module directory for Python functions, but not for Node.js functions.
+var functionModuleDirs = []moduleDir{
+	{"opt/lib", "lib"},
+	{"var/task/lib", "lib"},
+	{"opt/python/lib/python*/site-packages", "python"},
+	{"opt/python", "python"},
+	{"opt/nodejs/node_modules", "nodejs"},
+	{"opt/nodejs/node*/node_modules", "nodejs"},
+	{"var/task/node_modules", "nodejs"},
+	{"var/task", "python"},
+}
+
+// Directories of the execution environment that the runtimes load modules and libraries from,
+// in the order they are loaded from for each kind
+var environmentModuleDirs = []moduleDir{
+	{"lib64", "lib"},
+	{"usr/lib64", "lib"},
+	{"var/runtime/node_modules", "nodejs"},
+	{"var/lang/lib/node_modules", "nodejs"},
+	{"var/runtime", "python"},
+	{"var/lang/lib/python*/site-packages", "python"},
+}
+
+// Module path of a file of a function of the runtime or its layers, like python/boto3/__init__.py
+// for /var/task/boto3/__init__.py or /opt/python/boto3/__init__.py of a python3.8 function. The runtime
+// may also be the name of an environment, like python, for the runtimes of that environment.
+func ModulePath(runtime string, name string) (string, bool) {
+	var dirs []moduleDir
+	for _, dir := range functionModuleDirs {
+		if loadsModules(runtime, dir.kind) {
+			dirs = append(dirs, dir)
+		}
+	}
+	modulePath, _, ok := modulePath(name, dirs)
+	return modulePath, ok
+}
+
+// Whether the runtime or environment loads modules of the kind. All runtimes load libraries.
+func loadsModules(runtime string, kind string) bool {
+	return kind == "lib" || strings.HasPrefix(runtime, kind)
+}
+
+// Module path of a file in the image of an execution environment, like python/boto3/__init__.py
+// for /var/runtime/boto3/__init__.py, and the precedence of its directory: if several files have
+// the same module path, the runtime loads the one with the lowest precedence. Only files of the kinds
+// of modules that the environment loads are matched: libraries, and Python or Node.js modules for those environments.
+func EnvironmentModulePath(environment string, name string) (string, int, bool) {
+	modulePath, precedence, ok := modulePath(name, environmentModuleDirs)
+	if !ok {
+		return "", 0, false
+	}
+	kind := strings.SplitN(modulePath, "/", 2)[0]
+	return modulePath, precedence, loadsModules(environment, kind)
+}
+
+func modulePath(name string, dirs []moduleDir) (string, int, bool) {
+	name = path.Clean(strings.TrimPrefix(name, "/"))
+	for i, dir := range dirs {
+		depth := strings.Count(dir.pattern, "/") + 1
+		components := strings.SplitN(name, "/", depth+1)
+		if len(components) <= depth {
+			continue
+		}
+		if matched, _ := path.Match(dir.pattern, strings.Join(components[:depth], "/")); !matched {
+			continue
+		}
+		rest := components[depth]
+		// Libraries are only loaded from the library directories themselves
+		if dir.kind == "lib" && strings.Contains(rest, "/") {
+			continue
+		}
+		return dir.kind + "/" + rest, i, true
+	}
+	return "", 0, false
+}
@@ -0,0 +1,153 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package environment
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModulePath(t *testing.T) {
+	cases := map[string]string{
+		"var/task/boto3/__init__.py":                                   "python/boto3/__init__.py",
+		"/opt/python/boto3/__init__.py":                                "python/boto3/__init__.py",
+		"opt/python/lib/python3.8/site-packages/boto3/__init__.py":     "python/boto3/__init__.py",
+		"opt/lib/libssl.so.10":                                         "lib/libssl.so.10",
+		"var/task/lib/libssl.so.10":                                    "lib/libssl.so.10",
+		"var/task/lib/package/module.py":                               "python/lib/package/module.py",
+		"opt/python/lib/python3.8/site-packages/lib/package/module.py": "python/lib/package/module.py",
+	}
+	for name, expected := range cases {
+		modulePath, ok := ModulePath("python3.8", name)
+		assert.True(t, ok, name)
+		assert.Equal(t, expected, modulePath, name)
+	}
+
+	cases = map[string]string{
+		"opt/nodejs/node_modules/aws-sdk/index.js":        "nodejs/aws-sdk/index.js",
+		"opt/nodejs/node12/node_modules/aws-sdk/index.js": "nodejs/aws-sdk/index.js",
+		"var/task/node_modules/aws-sdk/index.js":          "nodejs/aws-sdk/index.js",
+		"var/task/lib/libssl.so.10":                       "lib/libssl.so.10",
+	}
+	for name, expected := range cases {
+		modulePath, ok := ModulePath("nodejs12.x", name)
+		assert.True(t, ok, name)
+		assert.Equal(t, expected, modulePath, name)
+	}
+
+	for _, name := range []string{"opt/bin/app", "opt/lib/engines/libpadlock.so", "usr/lib64/libssl.so.10", "var/task"} {
+		_, ok := ModulePath("python3.8", name)
+		assert.False(t, ok, name)
+	}
+
+	// Node.js functions do not load their files in /var/task as Python modules, and Python functions do not load Node.js modules
+	for _, name := range []string{"var/task/index.js", "var/task/boto3/__init__.py", "opt/python/boto3/__init__.py"} {
+		_, ok := ModulePath("nodejs12.x", name)
+		assert.False(t, ok, name)
+	}
+	_, ok := ModulePath("python3.8", "opt/nodejs/node_modules/aws-sdk/index.js")
+	assert.False(t, ok)
+
+	// The environment name stands for its runtimes
+	modulePath, ok := ModulePath("python", "var/task/six.py")
+	assert.True(t, ok)
+	assert.Equal(t, "python/six.py", modulePath)
+
+	// Custom runtimes only load libraries
+	_, ok = ModulePath("provided.al2", "var/task/six.py")
+	assert.False(t, ok)
+	modulePath, ok = ModulePath("provided.al2", "opt/lib/libssl.so.10")
+	assert.True(t, ok)
+	assert.Equal(t, "lib/libssl.so.10", modulePath)
+}
+
+func TestEnvironmentModulePath(t *testing.T) {
+	modulePath, precedence, ok := EnvironmentModulePath("python", "var/runtime/boto3/__init__.py")
+	assert.True(t, ok)
+	assert.Equal(t, "python/boto3/__init__.py", modulePath)
+
+	// Python loads modules from /var/runtime first
+	modulePath, sitePackages, ok := EnvironmentModulePath("python", "var/lang/lib/python3.8/site-packages/boto3/__init__.py")
+	assert.True(t, ok)
+	assert.Equal(t, "python/boto3/__init__.py", modulePath)
+	assert.True(t, precedence < sitePackages)
+
+	modulePath, _, ok = EnvironmentModulePath("nodejs", "var/runtime/node_modules/aws-sdk/index.js")
+	assert.True(t, ok)
+	assert.Equal(t, "nodejs/aws-sdk/index.js", modulePath)
+
+	modulePath, _, ok = EnvironmentModulePath("provided.al2", "usr/lib64/libssl.so.10")
+	assert.True(t, ok)
+	assert.Equal(t, "lib/libssl.so.10", modulePath)
+
+	// The Node.js runtime does not load Python modules
+	_, _, ok = EnvironmentModulePath("nodejs", "var/runtime/bootstrap.py")
+	assert.False(t, ok)
+	_, _, ok = EnvironmentModulePath("provided", "var/runtime/init")
+	assert.False(t, ok)
+}
+
+func TestLoadManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "python.json")
+	require.NoError(t, ioutil.WriteFile(filename, []byte(`{
+  "environment": "python",
+  "runtimes": ["python3.8"],
+  "files": [
+    {"modulePath": "python/boto3/__init__.py", "size": 4, "sha256": "abcd"}
+  ]
+}`), 0644))
+
+	m, err := LoadManifest(filename)
+	require.NoError(t, err)
+	assert.True(t, m.HasRuntime("python3.8"))
+
+	f, ok := m.Lookup("python/boto3/__init__.py")
+	assert.True(t, ok)
+	assert.Equal(t, File{ModulePath: "python/boto3/__init__.py", Size: 4, SHA256: "abcd"}, f)
+	_, ok = m.Lookup("python/botocore/__init__.py")
+	assert.False(t, ok)
+
+	require.NoError(t, ioutil.WriteFile(filename, []byte(`{"files": []}`), 0644))
+	_, err = LoadManifest(filename)
+	assert.Error(t, err)
+}
+
+func TestLookupPackage(t *testing.T) {
+	m := &Manifest{Environment: "python", Packages: []Package{
+		{Type: "pypi", Name: "boto3", Version: "1.14.40"},
+		{Type: "pypi", Name: "typing-extensions", Version: "3.7.4"},
+		{Type: "npm", Name: "@aws/foo", Version: "1.0.0"},
+	}}
+
+	dir, ok := ModuleDir("python/boto3/session.py")
+	require.True(t, ok)
+	p, ok := m.LookupPackage(dir)
+	assert.True(t, ok)
+	assert.Equal(t, "1.14.40", p.Version)
+
+	dir, ok = ModuleDir("python/typing_extensions/__init__.py")
+	require.True(t, ok)
+	_, ok = m.LookupPackage(dir)
+	assert.True(t, ok)
+
+	dir, ok = ModuleDir("nodejs/@aws/foo/index.js")
+	require.True(t, ok)
+	assert.Equal(t, "nodejs/@aws/foo", dir)
+	_, ok = m.LookupPackage(dir)
+	assert.True(t, ok)
+
+	// Files directly in a module directory and libraries belong to no package
+	_, ok = ModuleDir("python/six.py")
+	assert.False(t, ok)
+	_, ok = ModuleDir("lib/libssl.so.10")
+	assert.False(t, ok)
+}
@@ -0,0 +1,330 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package extract
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/environment"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/sbom"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
+	imgtypes "github.com/containers/image/v5/types"
+	zglob "github.com/mattn/go-zglob"
+	"github.com/mholt/archiver"
+	"github.com/pkg/errors"
+)
+
+// Loads the manifest of the execution environment whose files are pruned, or returns nil if no files are pruned
+func loadEnvironment(extractOpts *types.ExtractOptions) (*environment.Manifest, error) {
+	for _, pattern := range extractOpts.KeepFiles {
+		if _, err := zglob.Match(strings.TrimPrefix(pattern, "/"), ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q of files to keep: %v", pattern, err)
+		}
+	}
+
+	if !extractOpts.PruneEnvironment {
+		return nil, nil
+	}
+
+	// Manifests are recorded from the base image of the environment with 'img2lambda environment-manifest'
+	if extractOpts.EnvironmentManifest == "" {
+		return nil, errors.New("pruning the files of the execution environment requires a manifest of the environment")
+	}
+	m, err := environment.LoadManifest(extractOpts.EnvironmentManifest)
+	if err != nil {
+		return nil, err
+	}
+	if extractOpts.Runtime != "" && !m.HasRuntime(extractOpts.Runtime) {
+		extractOpts.Logger.Warnf("The manifest of the %s execution environment does not list runtime %s", m.Environment, extractOpts.Runtime)
+	}
+
+	if len(m.Files) == 0 {
+		extractOpts.Logger.Warnf("The manifest of the %s execution environment lists no files, so no files are pruned", m.Environment)
+	}
+	return m, nil
+}
+
+// Runtime whose module directories are pruned. Without a runtime, the files are matched for the runtimes of the environment.
+func pruneRuntime(opts *repackOptions) string {
+	if opts.runtime == "" {
+		return opts.environment.Environment
+	}
+	return opts.runtime
+}
+
+// Checks whether the repacked file is identical to the file that the execution environment provides at
+// the same module path, and is not kept by a pattern. Files of a package that the environment provides in
+// another version are never pruned, so that a function does not load a mix of both versions. Files with the
+// size of the environment's file are copied to a temporary file while computing their digest, so the file's
+// reader is replaced to allow repacking it afterwards.
+func isEnvironmentFile(f *archiver.File, hdr *tar.Header, opts *repackOptions) (bool, error) {
+	if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+		return false, nil
+	}
+	name := path.Clean(strings.TrimPrefix(filepath.ToSlash(hdr.Name), "/"))
+	modulePath, ok := environment.ModulePath(pruneRuntime(opts), name)
+	if !ok {
+		return false, nil
+	}
+	file, ok := opts.environment.Lookup(modulePath)
+	if !ok || file.Size != hdr.Size {
+		return false, nil
+	}
+
+	if dir, ok := environment.ModuleDir(modulePath); ok {
+		imagePackage, inImage := opts.imagePackages[dir]
+		environmentPackage, inEnvironment := opts.environment.LookupPackage(dir)
+		if inImage && inEnvironment && imagePackage.Version != environmentPackage.Version {
+			opts.logger.Debugf("Keeping /%s, because the image has version %s of %s and the %s execution environment has version %s",
+				name, imagePackage.Version, imagePackage.Name, opts.environment.Environment, environmentPackage.Version)
+			return false, nil
+		}
+	}
+
+	hash := sha256.New()
+	f.ReadCloser = teeReadCloser{Reader: io.TeeReader(f.ReadCloser, hash), Closer: f.ReadCloser}
+	if _, _, err := copyToTempFile(f, "img2lambda-environment-"); err != nil {
+		return false, err
+	}
+
+	if hex.EncodeToString(hash.Sum(nil)) != file.SHA256 {
+		return false, nil
+	}
+	if keepsFile(opts.keepFiles, name) {
+		opts.logger.Debugf("Keeping /%s, which the %s execution environment provides, because it matches a pattern of files to keep", name, opts.environment.Environment)
+		return false, nil
+	}
+	return true, nil
+}
+
+// Records the versions of the packages in the module directories of the selected image layers, from their
+// package metadata, like /var/task/boto3-1.14.40.dist-info/METADATA or /opt/nodejs/node_modules/aws-sdk/package.json
+func scanImagePackages(opts *repackOptions, layerInfos []imgtypes.BlobInfo) error {
+	opts.imagePackages = map[string]environment.Package{}
+	runtime := pruneRuntime(opts)
+
+	for i, layerInfo := range layerInfos {
+		if i < opts.baseLayerCount || opts.excludedLayers[i+1] {
+			continue
+		}
+		err := walkLayer(opts, layerInfo, func(f *archiver.File, hdr *tar.Header) error {
+			if (hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA) || hdr.Size > sbom.MaxMetadataFileSize || !sbom.IsMetadataFile(hdr.Name) {
+				return nil
+			}
+			name := path.Clean(strings.TrimPrefix(filepath.ToSlash(hdr.Name), "/"))
+			modulePath, ok := environment.ModulePath(runtime, name)
+			if !ok {
+				return nil
+			}
+
+			contents, err := ioutil.ReadAll(f.ReadCloser)
+			if err != nil {
+				return err
+			}
+			packages, err := sbom.Parse(name, contents)
+			if err != nil {
+				// Files of packages with unparseable metadata are pruned by their digests only
+				return nil
+			}
+			for _, p := range packages {
+				pkg := environment.Package{Type: p.Type, Name: p.Name, Version: p.Version}
+				dir, ok := environment.PackageModuleDir(pkg)
+				// The metadata is next to the module directory of a Python package, and in the module directory of a Node.js package
+				if ok && (path.Dir(modulePath) == dir || (p.Type == sbom.TypePyPI && path.Dir(path.Dir(modulePath)) == "python")) {
+					opts.imagePackages[dir] = pkg
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("reading packages of image layer %s: %v", layerInfo.Digest, err)
+		}
+	}
+	return nil
+}
+
+func keepsFile(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, err := zglob.Match(strings.TrimPrefix(pattern, "/"), name); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Records the files and packages of the execution environment in the image of a Lambda base environment,
+// like public.ecr.aws/lambda/python:3.8, for pruning them from the images of functions
+func DescribeEnvironment(ctx context.Context, imageName string, name string, runtimes []string, extractOpts *types.ExtractOptions) (manifest *environment.Manifest, retErr error) {
+	extractOpts.Logger.Infof("Parsing the image %s", imageName)
+
+	opts, err := openImage(ctx, imageName, extractOpts.SystemContext, &extractOpts.Signatures)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := opts.imageSource.Close(); err != nil {
+			retErr = errors.Wrapf(retErr, " (close error: %v)", err)
+		}
+	}()
+
+	opts.logger = extractOpts.Logger
+	opts.progress = extractOpts.Progress
+
+	return describeEnvironment(opts, name, runtimes)
+}
+
+// File of the image of an execution environment
+type environmentFile struct {
+	link   string // Path in the image that the link points to, for links
+	size   int64
+	sha256 string
+}
+
+func describeEnvironment(opts *repackOptions, name string, runtimes []string) (*environment.Manifest, error) {
+	files := map[string]environmentFile{}
+	packages := map[string][]sbom.Package{}
+
+	for i, layerInfo := range opts.imageSource.LayerInfos() {
+		opts.logger.Infof("Reading image layer %d/%d %s", i+1, len(opts.imageSource.LayerInfos()), layerInfo.Digest)
+		err := walkLayer(opts, layerInfo, func(f *archiver.File, hdr *tar.Header) error {
+			filename := path.Clean(strings.TrimPrefix(filepath.ToSlash(hdr.Name), "/"))
+			dir, base := path.Split(filename)
+			dir = path.Clean(dir)
+
+			if strings.HasPrefix(base, whiteoutPrefix) {
+				target := path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix))
+				if base == whiteoutOpaque {
+					target = dir
+				}
+				for p := range files {
+					if (p == target && base != whiteoutOpaque) || strings.HasPrefix(p, target+"/") || target == "." {
+						delete(files, p)
+						delete(packages, p)
+					}
+				}
+				return nil
+			}
+
+			switch hdr.Typeflag {
+			case tar.TypeSymlink:
+				if strings.HasPrefix(hdr.Linkname, "/") {
+					files[filename] = environmentFile{link: path.Clean(strings.TrimPrefix(hdr.Linkname, "/"))}
+				} else {
+					files[filename] = environmentFile{link: path.Join(dir, hdr.Linkname)}
+				}
+				return nil
+			case tar.TypeLink:
+				files[filename] = environmentFile{link: path.Clean(strings.TrimPrefix(filepath.ToSlash(hdr.Linkname), "/"))}
+				return nil
+			case tar.TypeReg, tar.TypeRegA:
+			default:
+				return nil
+			}
+
+			if _, _, ok := environment.EnvironmentModulePath(name, filename); !ok && !isImageLibraryDir(dir) {
+				return nil
+			}
+
+			// Files are hashed as they are read, and only package metadata is buffered in memory
+			hash := sha256.New()
+			var found []sbom.Package
+			var parseErr error
+			switch {
+			case sbom.IsJar(filename):
+				f.ReadCloser = teeReadCloser{Reader: io.TeeReader(f.ReadCloser, hash), Closer: f.ReadCloser}
+				tmp, size, err := copyToTempFile(f, "img2lambda-jar-")
+				if err != nil {
+					return err
+				}
+				found, parseErr = sbom.ParseJar(filename, tmp, size)
+				f.Close()
+			case sbom.IsMetadataFile(filename) && hdr.Size <= sbom.MaxMetadataFileSize:
+				contents, err := ioutil.ReadAll(io.TeeReader(f.ReadCloser, hash))
+				if err != nil {
+					return err
+				}
+				found, parseErr = sbom.Parse(filename, contents)
+			default:
+				if _, err := io.Copy(hash, f.ReadCloser); err != nil {
+					return err
+				}
+			}
+			files[filename] = environmentFile{size: hdr.Size, sha256: hex.EncodeToString(hash.Sum(nil))}
+
+			delete(packages, filename)
+			if parseErr != nil {
+				opts.logger.Warnf("Could not parse package metadata %s: %v", filename, parseErr)
+				return nil
+			}
+			if found != nil {
+				packages[filename] = found
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("reading image layer %s: %v", layerInfo.Digest, err)
+		}
+	}
+
+	// Several directories of the environment may have files at the same module path, of which the runtime loads one
+	loaded := map[string]environment.File{}
+	precedences := map[string]int{}
+	for filename := range files {
+		modulePath, precedence, ok := environment.EnvironmentModulePath(name, filename)
+		if !ok {
+			continue
+		}
+		if p, found := precedences[modulePath]; found && p <= precedence {
+			continue
+		}
+		// Functions contain copies of the files that links point to
+		file, ok := resolveEnvironmentFile(files, filename)
+		if !ok {
+			continue
+		}
+		loaded[modulePath] = environment.File{ModulePath: modulePath, Size: file.size, SHA256: file.sha256}
+		precedences[modulePath] = precedence
+	}
+
+	manifest := &environment.Manifest{Environment: name, Runtimes: runtimes, Files: []environment.File{}}
+	for _, file := range loaded {
+		manifest.Files = append(manifest.Files, file)
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool { return manifest.Files[i].ModulePath < manifest.Files[j].ModulePath })
+
+	var found []sbom.Package
+	for _, p := range packages {
+		found = append(found, p...)
+	}
+	for _, p := range sbom.Dedupe(found) {
+		manifest.Packages = append(manifest.Packages, environment.Package{Type: p.Type, Name: p.Name, Version: p.Version})
+	}
+
+	opts.logger.Infof("Recorded %d files and %d packages of the %s execution environment", len(manifest.Files), len(manifest.Packages), name)
+	return manifest, nil
+}
+
+// Follows links to the regular file with the contents, which may be outside of the module directories
+func resolveEnvironmentFile(files map[string]environmentFile, filename string) (environmentFile, bool) {
+	for hops := 0; hops < 10; hops++ {
+		file, ok := files[filename]
+		if !ok {
+			return environmentFile{}, false
+		}
+		if file.link == "" {
+			return file, true
+		}
+		filename = file.link
+	}
+	return environmentFile{}, false
+}
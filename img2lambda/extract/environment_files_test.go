@@ -0,0 +1,234 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/environment"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/internal/testing/mocks"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
+	imgtypes "github.com/containers/image/v5/types"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func environmentFileOf(modulePath string, contents string) environment.File {
+	sum := sha256.Sum256([]byte(contents))
+	return environment.File{ModulePath: modulePath, Size: int64(len(contents)), SHA256: hex.EncodeToString(sum[:])}
+}
+
+func TestRepackPruneEnvironmentFiles(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	source := mocks.NewMockImageCloser(ctrl)
+	rawSource := mocks.NewMockImageSource(ctrl)
+	source.EXPECT().LayerInfos().Return([]imgtypes.BlobInfo{
+		createImageLayerEntries(t, rawSource, "sha256:1",
+			layerEntry{name: "opt/python/six.py", body: []byte("six 1.0")},
+			layerEntry{name: "opt/bin/tool", body: []byte("tool")}),
+		createImageLayerEntries(t, rawSource, "sha256:2",
+			layerEntry{name: "opt/python/six.py", body: []byte("six 2.0")},
+			layerEntry{name: "opt/python/lib/python3.8/site-packages/botocore/__init__.py", body: []byte("botocore")},
+			layerEntry{name: "opt/python/lib/python3.8/site-packages/botocore/patched.py", body: []byte("patched!")},
+			layerEntry{name: "opt/lib/libssl.so.10", body: []byte("libssl")},
+			layerEntry{name: "var/task/boto3/__init__.py", body: []byte("boto3")},
+			layerEntry{name: "var/task/app.py", body: []byte("app")}),
+	})
+
+	layers, function, err := repackImage(&repackOptions{
+		ctx:            context.Background(),
+		imageSource:    source,
+		rawImageSource: rawSource,
+		imageName:      "test-image",
+		layerOutputDir: dir,
+		environment: &environment.Manifest{
+			Environment: "python",
+			Files: []environment.File{
+				environmentFileOf("python/six.py", "six 2.0"),
+				environmentFileOf("python/botocore/__init__.py", "botocore"),
+				environmentFileOf("python/botocore/patched.py", "original"),
+				environmentFileOf("lib/libssl.so.10", "libssl"),
+				environmentFileOf("python/boto3/__init__.py", "boto3"),
+			},
+		},
+		keepFiles: []string{"/opt/lib/**"},
+	})
+	require.NoError(t, err)
+
+	// The pruned six.py of the second layer replaces six.py of the first layer
+	require.Len(t, layers, 2)
+	assert.Equal(t, map[string][]byte{"bin/tool": []byte("tool")}, zipFileContents(t, layers[0].File))
+	assert.Equal(t, 0, layers[0].PrunedFiles)
+	assert.Equal(t, map[string][]byte{
+		"python/lib/python3.8/site-packages/botocore/patched.py": []byte("patched!"),
+		"lib/libssl.so.10": []byte("libssl"),
+	}, zipFileContents(t, layers[1].File))
+	assert.Equal(t, 2, layers[1].PrunedFiles)
+	assert.Equal(t, int64(len("six 2.0")+len("botocore")), layers[1].PrunedBytes)
+
+	assert.Equal(t, map[string][]byte{"app.py": []byte("app")}, zipFileContents(t, function.File))
+	assert.Equal(t, 1, function.FileCount)
+	assert.Equal(t, 1, function.PrunedFiles)
+	assert.Equal(t, int64(len("boto3")), function.PrunedBytes)
+}
+
+func TestRepackPruneEnvironmentFilesOfRuntime(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	source := mocks.NewMockImageCloser(ctrl)
+	rawSource := mocks.NewMockImageSource(ctrl)
+	source.EXPECT().LayerInfos().Return([]imgtypes.BlobInfo{
+		createImageLayerEntries(t, rawSource, "sha256:1",
+			layerEntry{name: "var/task/six.py", body: []byte("six")},
+			layerEntry{name: "var/task/node_modules/aws-sdk/index.js", body: []byte("sdk")}),
+	})
+
+	// Node.js functions do not load their files in /var/task as Python modules
+	_, function, err := repackImage(&repackOptions{
+		ctx:            context.Background(),
+		imageSource:    source,
+		rawImageSource: rawSource,
+		imageName:      "test-image",
+		layerOutputDir: dir,
+		runtime:        "nodejs12.x",
+		environment: &environment.Manifest{
+			Environment: "custom",
+			Files: []environment.File{
+				environmentFileOf("python/six.py", "six"),
+				environmentFileOf("nodejs/aws-sdk/index.js", "sdk"),
+			},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"six.py": []byte("six")}, zipFileContents(t, function.File))
+	assert.Equal(t, 1, function.PrunedFiles)
+}
+
+func TestRepackPruneEnvironmentPackageVersions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	source := mocks.NewMockImageCloser(ctrl)
+	rawSource := mocks.NewMockImageSource(ctrl)
+	source.EXPECT().LayerInfos().Return([]imgtypes.BlobInfo{
+		createImageLayerEntries(t, rawSource, "sha256:1",
+			layerEntry{name: "var/task/boto3/__init__.py", body: []byte("boto3")},
+			layerEntry{name: "var/task/boto3-1.13.0.dist-info/METADATA", body: []byte("Name: boto3\nVersion: 1.13.0\n")},
+			layerEntry{name: "var/task/botocore/__init__.py", body: []byte("botocore")},
+			layerEntry{name: "var/task/botocore-1.17.0.dist-info/METADATA", body: []byte("Name: botocore\nVersion: 1.17.0\n")}),
+	})
+
+	_, function, err := repackImage(&repackOptions{
+		ctx:            context.Background(),
+		imageSource:    source,
+		rawImageSource: rawSource,
+		imageName:      "test-image",
+		layerOutputDir: dir,
+		runtime:        "python3.8",
+		environment: &environment.Manifest{
+			Environment: "python",
+			Files: []environment.File{
+				environmentFileOf("python/boto3/__init__.py", "boto3"),
+				environmentFileOf("python/botocore/__init__.py", "botocore"),
+			},
+			Packages: []environment.Package{
+				{Type: "pypi", Name: "boto3", Version: "1.14.0"},
+				{Type: "pypi", Name: "botocore", Version: "1.17.0"},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	// Files of a package that the environment provides in another version are kept, even if they are identical
+	contents := zipFileContents(t, function.File)
+	assert.Contains(t, contents, "boto3/__init__.py")
+	assert.NotContains(t, contents, "botocore/__init__.py")
+	assert.Equal(t, 1, function.PrunedFiles)
+}
+
+func TestLoadEnvironmentRequiresManifest(t *testing.T) {
+	_, err := loadEnvironment(&types.ExtractOptions{PruneEnvironment: true, Runtime: "python3.8"})
+	assert.Error(t, err)
+
+	m, err := loadEnvironment(&types.ExtractOptions{Runtime: "python3.8"})
+	assert.NoError(t, err)
+	assert.Nil(t, m)
+}
+
+func TestDescribeEnvironment(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	metadata := "Metadata-Version: 2.1\nName: boto3\nVersion: 1.14.0\n"
+
+	var jar bytes.Buffer
+	zw := zip.NewWriter(&jar)
+	w, err := zw.Create("META-INF/maven/com.amazonaws/aws-lambda-java-core/pom.properties")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("version=1.2.1\ngroupId=com.amazonaws\nartifactId=aws-lambda-java-core\n"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	source := mocks.NewMockImageCloser(ctrl)
+	rawSource := mocks.NewMockImageSource(ctrl)
+	source.EXPECT().LayerInfos().Return([]imgtypes.BlobInfo{
+		createImageLayerEntries(t, rawSource, "sha256:1",
+			layerEntry{name: "lib64/libssl.so.1.0.2k", body: []byte("libssl")},
+			layerEntry{name: "lib64/libssl.so.10", linkname: "libssl.so.1.0.2k"},
+			layerEntry{name: "usr/lib64/libold.so.1", body: []byte("old")},
+			layerEntry{name: "etc/passwd", body: []byte("root")},
+			layerEntry{name: "var/lang/lib/python3.8/site-packages/boto3/__init__.py", body: []byte("older boto3")}),
+		createImageLayerEntries(t, rawSource, "sha256:2",
+			layerEntry{name: "usr/lib64/.wh.libold.so.1"},
+			layerEntry{name: "var/runtime/boto3/__init__.py", body: []byte("boto3")},
+			layerEntry{name: "var/runtime/boto3-1.14.0.dist-info/METADATA", body: []byte(metadata)},
+			layerEntry{name: "var/runtime/node_modules/ignored/index.js", body: []byte("node")},
+			layerEntry{name: "var/runtime/lib/aws-lambda-java-core.jar", body: jar.Bytes()}),
+	}).AnyTimes()
+
+	manifest, err := describeEnvironment(&repackOptions{
+		ctx:            context.Background(),
+		imageSource:    source,
+		rawImageSource: rawSource,
+	}, "python", []string{"python3.8"})
+	require.NoError(t, err)
+
+	assert.Equal(t, &environment.Manifest{
+		Environment: "python",
+		Runtimes:    []string{"python3.8"},
+		Files: []environment.File{
+			environmentFileOf("lib/libssl.so.1.0.2k", "libssl"),
+			environmentFileOf("lib/libssl.so.10", "libssl"),
+			environmentFileOf("python/boto3-1.14.0.dist-info/METADATA", metadata),
+			environmentFileOf("python/boto3/__init__.py", "boto3"),
+			environmentFileOf("python/lib/aws-lambda-java-core.jar", jar.String()),
+		},
+		Packages: []environment.Package{
+			{Type: "maven", Name: "aws-lambda-java-core", Version: "1.2.1"},
+			{Type: "pypi", Name: "boto3", Version: "1.14.0"},
+		},
+	}, manifest)
+}
@@ -0,0 +1,213 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package extract
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/logging"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/sbom"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
+	"github.com/mholt/archiver"
+	godigest "github.com/opencontainers/go-digest"
+)
+
+// Lambda starts each file in this directory as an external extension
+const extensionsDir = "opt/extensions"
+
+// Executable in /opt/extensions, which Lambda starts as an extension
+type extensionFile struct {
+	path     string // Path in the image, like opt/extensions/my-extension
+	digest   string // Digest of the image layer with the file
+	problems []string
+}
+
+func isExtensionPath(name string) bool {
+	return path.Dir(name) == extensionsDir
+}
+
+// Checks that the file in /opt/extensions can be started by Lambda: it must be executable,
+// and be an ELF binary or a script starting with #!. The header of the file is read,
+// so the file's reader is replaced to allow repacking it afterwards.
+func checkExtensionFile(f *archiver.File, hdr *tar.Header) (*extensionFile, error) {
+	extension := &extensionFile{path: path.Clean(filepath.ToSlash(hdr.Name))}
+
+	// Links are not followed, and their targets may be in other layers
+	if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+		return extension, nil
+	}
+
+	if hdr.Mode&0111 == 0 {
+		extension.problems = append(extension.problems, fmt.Sprintf("is not executable (mode %04o)", hdr.Mode&07777))
+	}
+
+	header := make([]byte, 4)
+	n, err := io.ReadFull(f.ReadCloser, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	header = header[:n]
+	f.ReadCloser = teeReadCloser{Reader: io.MultiReader(bytes.NewReader(header), f.ReadCloser), Closer: f.ReadCloser}
+
+	if !bytes.HasPrefix(header, []byte("\x7fELF")) && !bytes.HasPrefix(header, []byte("#!")) {
+		extension.problems = append(extension.problems, "is neither an ELF binary nor a script starting with #!")
+	}
+	return extension, nil
+}
+
+// Extensions that remain in the layer after files replaced or deleted by later image layers were removed
+func (c *layerContents) remainingExtensions() []extensionFile {
+	var extensions []extensionFile
+	for _, extension := range c.extensions {
+		if c.files[extension.path] {
+			extensions = append(extensions, extension)
+		}
+	}
+	return extensions
+}
+
+// Fails if Lambda could not start any of the extensions in the layers
+func checkExtensions(layers []*layerContents, logger *logging.Logger) error {
+	var invalid []string
+	for _, layer := range layers {
+		for _, extension := range layer.remainingExtensions() {
+			if len(extension.problems) == 0 {
+				logger.Infof("Found Lambda extension %s in image layer %s", path.Base(extension.path), extension.digest)
+				continue
+			}
+			for _, problem := range extension.problems {
+				invalid = append(invalid, fmt.Sprintf("/%s in image layer %s %s", extension.path, extension.digest, problem))
+			}
+		}
+	}
+
+	if len(invalid) > 0 {
+		return fmt.Errorf("found %d problems with Lambda extensions, which would prevent the function from starting:\n  %s",
+			len(invalid), strings.Join(invalid, "\n  "))
+	}
+	return nil
+}
+
+// Extensions of the Lambda layer, for the report
+func lambdaExtensions(layer *layerContents) []types.LambdaExtension {
+	var extensions []types.LambdaExtension
+	for _, extension := range layer.remainingExtensions() {
+		extensions = append(extensions, types.LambdaExtension{
+			Name:             path.Base(extension.path),
+			Path:             "/" + extension.path,
+			ImageLayerDigest: extension.digest,
+		})
+	}
+	return extensions
+}
+
+// Moves the files under /opt/extensions of all layers into a dedicated Lambda layer file, which is
+// listed first. Its digest is derived from the names, modes and contents of the files, so that the
+// layer keeps its name when other files of the image change, and extensions can be versioned separately.
+func separateExtensions(layers []*layerContents, destination string, logger *logging.Logger) ([]*layerContents, error) {
+	separated := &layerContents{file: destination, files: map[string]bool{}}
+
+	var sources []*layerContents
+	moved := map[*layerContents]*layerContents{}
+	for _, layer := range layers {
+		names := layer.filesUnder(extensionsDir)
+		if len(names) == 0 {
+			continue
+		}
+
+		source := &layerContents{file: layer.file, files: map[string]bool{}}
+		for _, name := range names {
+			source.files[name] = true
+			separated.files[name] = true
+		}
+		for _, pkg := range layer.packages {
+			if source.files[pkg.Path] {
+				separated.packages = append(separated.packages, pkg)
+			}
+		}
+		separated.extensions = append(separated.extensions, layer.remainingExtensions()...)
+		sources = append(sources, source)
+		moved[layer] = source
+	}
+	if len(sources) == 0 {
+		return layers, nil
+	}
+
+	if err := rewriteLayerFile(separated.file, sources); err != nil {
+		return nil, err
+	}
+	digest, err := zipContentDigest(separated.file)
+	if err != nil {
+		return nil, err
+	}
+	separated.digest = digest
+
+	result := []*layerContents{separated}
+	for _, layer := range layers {
+		source, ok := moved[layer]
+		if !ok {
+			result = append(result, layer)
+			continue
+		}
+
+		for name := range source.files {
+			delete(layer.files, name)
+		}
+		var packages []sbom.Package
+		for _, pkg := range layer.packages {
+			if !source.files[pkg.Path] {
+				packages = append(packages, pkg)
+			}
+		}
+		layer.packages = packages
+
+		if len(layer.files) == 0 {
+			if err := os.Remove(layer.file); err != nil {
+				return nil, err
+			}
+			logger.Infof("Moved all files of Lambda layer file %s from image layer %s to the extensions layer file %s", layer.file, layer.digest, separated.file)
+			continue
+		}
+		if err := rewriteLayerFile(layer.file, []*layerContents{layer}); err != nil {
+			return nil, err
+		}
+		logger.Infof("Moved %d files under /%s of Lambda layer file %s to the extensions layer file %s", len(source.files), extensionsDir, layer.file, separated.file)
+		result = append(result, layer)
+	}
+	return result, nil
+}
+
+// SHA-256 digest of the names, modes and SHA-256 digests of the contents of the files in the zip file,
+// which does not change with the modification times of the files
+func zipContentDigest(filename string) (string, error) {
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	var lines []string
+	for _, f := range r.File {
+		contents, err := f.Open()
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", f.Name, err)
+		}
+		digest, err := godigest.SHA256.FromReader(contents)
+		contents.Close()
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", f.Name, err)
+		}
+		lines = append(lines, fmt.Sprintf("%s %o %s", f.Name, f.Mode(), digest))
+	}
+	sort.Strings(lines)
+	return string(godigest.SHA256.FromString(strings.Join(lines, "\n"))), nil
+}
@@ -0,0 +1,199 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package extract
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/internal/testing/mocks"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
+	imgtypes "github.com/containers/image/v5/types"
+	"github.com/golang/mock/gomock"
+	godigest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type executableFile struct {
+	name string
+	mode int64
+	body string
+}
+
+// Creates an image layer with the given files and modes
+func createImageLayerExecutables(t *testing.T,
+	rawSource *mocks.MockImageSource,
+	digest string,
+	files ...executableFile) imgtypes.BlobInfo {
+
+	var contents bytes.Buffer
+	tw := tar.NewWriter(&contents)
+	for _, f := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: f.name, Typeflag: tar.TypeReg, Mode: f.mode, Size: int64(len(f.body))}))
+		_, err := tw.Write([]byte(f.body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+
+	blobInfo := imgtypes.BlobInfo{Digest: godigest.Digest(digest)}
+	rawSource.EXPECT().GetBlob(gomock.Any(),
+		blobInfo,
+		gomock.Any()).Return(ioutil.NopCloser(bytes.NewReader(contents.Bytes())), int64(0), nil)
+	return blobInfo
+}
+
+func repackExtensions(t *testing.T, dir string, separate bool, layers func(*mocks.MockImageSource) []imgtypes.BlobInfo) ([]types.LambdaLayer, error) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	source := mocks.NewMockImageCloser(ctrl)
+	rawSource := mocks.NewMockImageSource(ctrl)
+	source.EXPECT().LayerInfos().Return(layers(rawSource))
+
+	repacked, _, err := repackImage(&repackOptions{
+		ctx:                context.Background(),
+		imageSource:        source,
+		rawImageSource:     rawSource,
+		imageName:          "test-image",
+		layerOutputDir:     dir,
+		separateExtensions: separate,
+	})
+	return repacked, err
+}
+
+func TestRepackExtensions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	layers, err := repackExtensions(t, dir, false, func(rawSource *mocks.MockImageSource) []imgtypes.BlobInfo {
+		return []imgtypes.BlobInfo{
+			createImageLayerExecutables(t, rawSource, "sha256:1",
+				executableFile{"opt/extensions/script", 0755, "#!/bin/sh\n"},
+				executableFile{"opt/extensions/binary", 0755, "\x7fELF\x02\x01\x01"},
+				// Files in subdirectories are not started by Lambda
+				executableFile{"opt/extensions/lib/config.json", 0644, "{}"},
+				executableFile{"opt/bin/app", 0755, "#!/bin/sh\n"}),
+		}
+	})
+	require.NoError(t, err)
+	require.Len(t, layers, 1)
+
+	assert.ElementsMatch(t, []types.LambdaExtension{
+		{Name: "script", Path: "/opt/extensions/script", ImageLayerDigest: "sha256:1"},
+		{Name: "binary", Path: "/opt/extensions/binary", ImageLayerDigest: "sha256:1"},
+	}, layers[0].Extensions)
+
+	// The file header that was read to check the extension is still repacked
+	assert.Equal(t, []string{"extensions/script", "extensions/binary", "extensions/lib/config.json", "bin/app"}, zipFileNames(t, layers[0].File))
+}
+
+func TestRepackInvalidExtensions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = repackExtensions(t, dir, false, func(rawSource *mocks.MockImageSource) []imgtypes.BlobInfo {
+		return []imgtypes.BlobInfo{
+			createImageLayerExecutables(t, rawSource, "sha256:1",
+				executableFile{"opt/extensions/not-executable", 0644, "#!/bin/sh\n"},
+				executableFile{"opt/extensions/text", 0755, "hello"},
+				executableFile{"opt/extensions/replaced", 0644, ""}),
+			// A later layer replaces the invalid extension with a valid one
+			createImageLayerExecutables(t, rawSource, "sha256:2",
+				executableFile{"opt/extensions/replaced", 0755, "#!/bin/sh\n"}),
+		}
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "found 2 problems with Lambda extensions")
+	assert.Contains(t, err.Error(), "/opt/extensions/not-executable in image layer sha256:1 is not executable (mode 0644)")
+	assert.Contains(t, err.Error(), "/opt/extensions/text in image layer sha256:1 is neither an ELF binary nor a script starting with #!")
+	assert.NotContains(t, err.Error(), "replaced")
+
+	// Files of the failed run are removed
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestRepackSeparateExtensions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	layers, err := repackExtensions(t, dir, true, func(rawSource *mocks.MockImageSource) []imgtypes.BlobInfo {
+		return []imgtypes.BlobInfo{
+			createImageLayerExecutables(t, rawSource, "sha256:1",
+				executableFile{"opt/extensions/first", 0755, "#!/bin/sh\n"},
+				executableFile{"opt/bin/app", 0755, "#!/bin/sh\n"}),
+			createImageLayerExecutables(t, rawSource, "sha256:2",
+				executableFile{"opt/extensions/second", 0755, "#!/bin/sh\n"}),
+			createImageLayerExecutables(t, rawSource, "sha256:3",
+				executableFile{"opt/lib/libfoo.so", 0644, "\x7fELF"}),
+		}
+	})
+	require.NoError(t, err)
+
+	var files []string
+	for _, layer := range layers {
+		files = append(files, filepath.Base(layer.File)+": "+layer.Digest)
+	}
+	extensionsFile := filepath.Join(dir, "extensions.zip")
+	digest, err := zipContentDigest(extensionsFile)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"extensions.zip: " + digest, "layer-1.zip: sha256:1", "layer-3.zip: sha256:3"}, files)
+
+	assert.Equal(t, []string{"extensions/first", "extensions/second"}, zipFileNames(t, extensionsFile))
+	assert.Equal(t, []string{"bin/app"}, zipFileNames(t, filepath.Join(dir, "layer-1.zip")))
+	_, err = os.Stat(filepath.Join(dir, "layer-2.zip"))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Equal(t, []types.LambdaExtension{
+		{Name: "first", Path: "/opt/extensions/first", ImageLayerDigest: "sha256:1"},
+		{Name: "second", Path: "/opt/extensions/second", ImageLayerDigest: "sha256:2"},
+	}, layers[0].Extensions)
+	assert.Empty(t, layers[1].Extensions)
+}
+
+func TestZipContentDigest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeZip := func(name string, modified time.Time, body string) string {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		header := &zip.FileHeader{Name: "extensions/app", Method: zip.Deflate, Modified: modified}
+		header.SetMode(0755)
+		w, err := zw.CreateHeader(header)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(body))
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+
+		filename := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(filename, buf.Bytes(), 0644))
+		return filename
+	}
+
+	digest, err := zipContentDigest(writeZip("first.zip", time.Unix(0, 0), "#!/bin/sh\n"))
+	require.NoError(t, err)
+	contentDigest := godigest.SHA256.FromString("#!/bin/sh\n")
+	assert.Equal(t, string(godigest.SHA256.FromString("extensions/app 755 "+string(contentDigest))), digest)
+
+	// Modification times do not change the digest, contents do
+	sameDigest, err := zipContentDigest(writeZip("second.zip", time.Now(), "#!/bin/sh\n"))
+	require.NoError(t, err)
+	assert.Equal(t, digest, sameDigest)
+	otherDigest, err := zipContentDigest(writeZip("third.zip", time.Unix(0, 0), "#!/bin/bash"))
+	require.NoError(t, err)
+	assert.NotEqual(t, digest, otherDigest)
+}
@@ -0,0 +1,289 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package extract
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
+	"github.com/containers/image/v5/manifest"
+	"github.com/pkg/errors"
+)
+
+// Lists what each layer of the container image would be repacked into. The image is repacked into a temporary
+// directory like a conversion, so that skipped layers, files that later layers replace or delete and files that
+// the execution environment provides are listed as they would be converted.
+func InspectImage(ctx context.Context, imageName string, extractOpts *types.ExtractOptions) (inspection *types.ImageInspection, retErr error) {
+	dir, err := ioutil.TempDir("", "img2lambda-inspect-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	repackOpts := *extractOpts
+	repackOpts.OutputDir = dir
+	repackOpts.SBOM = false
+	opts, err := openRepackOptions(ctx, imageName, &repackOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := opts.imageSource.Close(); err != nil {
+			retErr = errors.Wrapf(retErr, " (close error: %v)", err)
+		}
+	}()
+
+	layers, function, err := repackImage(opts)
+	if err != nil {
+		return nil, err
+	}
+	return inspectImage(opts, layers, function)
+}
+
+// Returns the digest of the image's manifest, which identifies the image, without reading its layers
+func ImageManifestDigest(ctx context.Context, imageName string, extractOpts *types.ExtractOptions) (digest string, retErr error) {
+	opts, err := openImage(ctx, imageName, extractOpts.SystemContext, &extractOpts.Signatures)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := opts.imageSource.Close(); err != nil {
+			retErr = errors.Wrapf(retErr, " (close error: %v)", err)
+		}
+	}()
+
+	manifestBytes, _, err := opts.imageSource.Manifest(ctx)
+	if err != nil {
+		return "", err
+	}
+	manifestDigest, err := manifest.Digest(manifestBytes)
+	if err != nil {
+		return "", err
+	}
+	return string(manifestDigest), nil
+}
+
+// Lists the files of each image layer by where repackImage repacked them, from the Lambda layers and
+// function deployment package it wrote
+func inspectImage(opts *repackOptions, layers []types.LambdaLayer, function *types.LambdaDeploymentPackage) (*types.ImageInspection, error) {
+	inspection := &types.ImageInspection{Image: opts.imageName, Layers: []types.InspectedLayer{}}
+
+	layerFiles := map[string]bool{}
+	for _, layer := range layers {
+		if err := listZipFiles(layer.File, "opt/", layerFiles); err != nil {
+			return nil, err
+		}
+		inspection.BundledLibraries = append(inspection.BundledLibraries, layer.BundledLibraries...)
+	}
+	functionFiles := map[string]bool{}
+	if err := listZipFiles(function.File, "var/task/", functionFiles); err != nil {
+		return nil, err
+	}
+
+	layerInfos := opts.imageSource.LayerInfos()
+	for i, layerInfo := range layerInfos {
+		if err := opts.ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var skipped string
+		switch {
+		case i < opts.baseLayerCount:
+			skipped = "base image"
+		case opts.excludedLayers[i+1]:
+			skipped = "not selected"
+		}
+		if skipped != "" {
+			inspection.Layers = append(inspection.Layers, types.InspectedLayer{
+				Digest:         string(layerInfo.Digest),
+				MediaType:      layerInfo.MediaType,
+				Size:           layerInfo.Size,
+				Skipped:        skipped,
+				LayerFiles:     []types.InspectedFile{},
+				FunctionFiles:  []types.InspectedFile{},
+				RemovedFiles:   []types.InspectedFile{},
+				Whiteouts:      []string{},
+				IgnoredEntries: []types.InspectedFile{},
+			})
+			continue
+		}
+
+		task := opts.progress.Start(fmt.Sprintf("Inspecting image layer %d/%d", i+1, len(layerInfos)), layerInfo.Size)
+
+		layerStream, _, err := opts.rawImageSource.GetBlob(opts.ctx, layerInfo, opts.cache)
+		if err != nil {
+			return nil, err
+		}
+		defer layerStream.Close()
+
+		inspected, err := inspectLayer(task.Reader(layerStream), false)
+		if err != nil {
+			tarErr := err
+
+			// tar extraction failed, try tar.gz
+			layerStream, _, err = opts.rawImageSource.GetBlob(opts.ctx, layerInfo, opts.cache)
+			if err != nil {
+				return nil, err
+			}
+			defer layerStream.Close()
+
+			task.Reset()
+			inspected, err = inspectLayer(task.Reader(layerStream), true)
+			if err != nil {
+				return nil, fmt.Errorf("could not read layer with tar nor tar.gz: %v, %v", err, tarErr)
+			}
+		}
+		task.Done()
+
+		inspected.Digest = string(layerInfo.Digest)
+		inspected.MediaType = layerInfo.MediaType
+		inspected.Size = layerInfo.Size
+		inspection.Layers = append(inspection.Layers, *inspected)
+	}
+
+	// Files of the same path in later layers replace the files of earlier layers
+	repacked := map[string]bool{}
+	for i := len(inspection.Layers) - 1; i >= 0; i-- {
+		layer := &inspection.Layers[i]
+		var removedLayerFiles, removedFunctionFiles []types.InspectedFile
+		layer.LayerFiles, removedLayerFiles = splitRepackedFiles(layer.LayerFiles, layerFiles, repacked)
+		layer.FunctionFiles, removedFunctionFiles = splitRepackedFiles(layer.FunctionFiles, functionFiles, repacked)
+		layer.RemovedFiles = append(append(layer.RemovedFiles, removedLayerFiles...), removedFunctionFiles...)
+	}
+
+	return inspection, nil
+}
+
+// Adds the paths of the files in the zip file, with the prefix of the directory they were repacked from
+func listZipFiles(filename string, prefix string, paths map[string]bool) error {
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		paths[prefix+f.Name] = true
+	}
+	return nil
+}
+
+// Splits the files of a layer into the files that were repacked from it, and the files that were not,
+// because the Lambda archives do not contain them or contain the file of a later layer instead
+func splitRepackedFiles(files []types.InspectedFile, archived map[string]bool, repacked map[string]bool) ([]types.InspectedFile, []types.InspectedFile) {
+	kept := []types.InspectedFile{}
+	var removed []types.InspectedFile
+	for _, f := range files {
+		if archived[f.Path] && !repacked[f.Path] {
+			repacked[f.Path] = true
+			kept = append(kept, f)
+		} else {
+			removed = append(removed, f)
+		}
+	}
+	return kept, removed
+}
+
+// Applies the same filters as repackLayer to each entry of the layer archive
+func inspectLayer(layerContents io.Reader, isGzip bool) (*types.InspectedLayer, error) {
+	t, closeTar, err := openLayerTar(layerContents, isGzip)
+	if err != nil {
+		return nil, err
+	}
+	defer closeTar()
+
+	inspected := &types.InspectedLayer{
+		LayerFiles:     []types.InspectedFile{},
+		FunctionFiles:  []types.InspectedFile{},
+		RemovedFiles:   []types.InspectedFile{},
+		Whiteouts:      []string{},
+		IgnoredEntries: []types.InspectedFile{},
+	}
+
+	for {
+		f, err := t.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("opening next file in layer tar: %v", err)
+		}
+
+		hdr, ok := f.Header.(*tar.Header)
+		if !ok {
+			return nil, fmt.Errorf("expected header to be *tar.Header but was %T", f.Header)
+		}
+
+		file := types.InspectedFile{Path: hdr.Name, Type: tarEntryType(hdr.Typeflag), Size: hdr.Size}
+
+		if strings.HasPrefix(f.Name(), ".wh.") {
+			inspected.Whiteouts = append(inspected.Whiteouts, hdr.Name)
+			continue
+		}
+
+		toLayer, err := shouldRepackLayerFileToLambdaLayer(f)
+		if err != nil {
+			return nil, fmt.Errorf("filtering file in layer tar: %v", err)
+		}
+
+		toFunction, err := shouldRepackLayerFileToLambdaFunction(f)
+		if err != nil {
+			return nil, fmt.Errorf("filtering file in layer tar: %v", err)
+		}
+
+		switch {
+		case (toLayer || toFunction) && !isRepackableEntryType(hdr.Typeflag):
+			inspected.IgnoredEntries = append(inspected.IgnoredEntries, file)
+		case toLayer:
+			inspected.LayerFiles = append(inspected.LayerFiles, file)
+		case toFunction:
+			inspected.FunctionFiles = append(inspected.FunctionFiles, file)
+		case strings.HasPrefix(hdr.Name, "opt/") || strings.HasPrefix(hdr.Name, "var/task/"):
+			inspected.IgnoredEntries = append(inspected.IgnoredEntries, file)
+		default:
+			inspected.OtherFileCount++
+		}
+	}
+
+	return inspected, nil
+}
+
+// Mirrors the entry types that repackLayerFile writes to the Lambda archives
+func isRepackableEntryType(typeflag byte) bool {
+	switch typeflag {
+	case tar.TypeReg, tar.TypeRegA, tar.TypeChar, tar.TypeBlock, tar.TypeFifo, tar.TypeSymlink, tar.TypeLink:
+		return true
+	}
+	return false
+}
+
+func tarEntryType(typeflag byte) string {
+	switch typeflag {
+	case tar.TypeReg, tar.TypeRegA:
+		return "file"
+	case tar.TypeLink:
+		return "hardlink"
+	case tar.TypeSymlink:
+		return "symlink"
+	case tar.TypeChar:
+		return "char-device"
+	case tar.TypeBlock:
+		return "block-device"
+	case tar.TypeDir:
+		return "directory"
+	case tar.TypeFifo:
+		return "fifo"
+	case tar.TypeXGlobalHeader:
+		return "pax-global-header"
+	default:
+		return fmt.Sprintf("unknown (%c)", typeflag)
+	}
+}
@@ -0,0 +1,409 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package extract
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/internal/atomicfile"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/logging"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/sbom"
+	godigest "github.com/opencontainers/go-digest"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
+// Whiteout file of an image layer, which deletes a path of the layers below it
+type whiteout struct {
+	name   string // Name of the whiteout file in the layer tar
+	target string // Deleted path, or directory whose contents are deleted if opaque
+	opaque bool
+}
+
+// Parses the whiteout file name in a layer tar, returning false if the file is
+// not a whiteout or does not delete anything under /opt
+func parseWhiteout(name string) (whiteout, bool) {
+	name = path.Clean(strings.TrimPrefix(name, "/"))
+	dir, base := path.Split(name)
+	dir = path.Clean(dir)
+	if !strings.HasPrefix(base, whiteoutPrefix) {
+		return whiteout{}, false
+	}
+
+	w := whiteout{name: name}
+	switch {
+	case base == whiteoutOpaque && dir == ".":
+		// Deleting the contents of / deletes /opt
+		w.target = "opt"
+	case base == whiteoutOpaque:
+		w.target = dir
+		w.opaque = true
+	default:
+		w.target = path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix))
+	}
+	return w, isOptPath(w.target)
+}
+
+func isOptPath(name string) bool {
+	return name == "opt" || strings.HasPrefix(name, "opt/")
+}
+
+// Contents of an image layer under /opt
+type layerContents struct {
+	digest      string
+	file        string          // Lambda layer file, empty if the image layer has no files under /opt
+	files       map[string]bool // Paths of the files in the Lambda layer file, like opt/bin/app
+	dirs        map[string]bool // Parent directories of the files
+	whiteouts   []whiteout
+	packages    []sbom.Package
+	shadowed    int // Number of files removed because later image layers replace them
+	part        int // Number of the part, starting at 1, if the image layer was split into several Lambda layers
+	extensions  []extensionFile
+	libraries   []string // Sonames of the libraries in the layer, only set for the layer of bundled libraries
+	pruned      []string // Paths of the files of the image layer that were not repacked, because the execution environment provides them
+	prunedBytes int64
+
+	flattenedDigests []string // Digests of the image layers merged into this layer, if flattened
+}
+
+func newLayerContents(digest string, file string, repacked *repackedLayer) *layerContents {
+	contents := &layerContents{
+		digest:      digest,
+		file:        file,
+		files:       map[string]bool{},
+		dirs:        map[string]bool{},
+		whiteouts:   repacked.whiteouts,
+		packages:    repacked.layerPackages,
+		pruned:      repacked.prunedLayerFiles,
+		prunedBytes: repacked.prunedLayerBytes,
+	}
+	for _, extension := range repacked.extensions {
+		extension.digest = digest
+		contents.extensions = append(contents.extensions, extension)
+	}
+	for _, name := range repacked.layerFiles {
+		contents.files[name] = true
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			contents.dirs[dir] = true
+		}
+	}
+	return contents
+}
+
+// Files of the layer that are the given path, or are under it
+func (c *layerContents) filesAt(name string) []string {
+	var matches []string
+	if c.files[name] {
+		matches = append(matches, name)
+	}
+	return append(matches, c.filesUnder(name)...)
+}
+
+func (c *layerContents) filesUnder(dir string) []string {
+	if !c.dirs[dir] {
+		return nil
+	}
+	var matches []string
+	for name := range c.files {
+		if strings.HasPrefix(name, dir+"/") {
+			matches = append(matches, name)
+		}
+	}
+	return matches
+}
+
+// Files of the layer deleted by the whiteout
+func (c *layerContents) deletedBy(w whiteout) []string {
+	if w.opaque {
+		return c.filesUnder(w.target)
+	}
+	return c.filesAt(w.target)
+}
+
+// Files of the layer replaced by a file at the given path in a later layer,
+// including files and directories that the file replaces by type
+func (c *layerContents) replacedBy(name string) []string {
+	matches := c.filesAt(name)
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if c.files[dir] {
+			matches = append(matches, dir)
+		}
+	}
+	return matches
+}
+
+func (c *layerContents) remove(names []string) {
+	for _, name := range names {
+		delete(c.files, name)
+	}
+}
+
+// Packages whose metadata files remain in the layer after files replaced or deleted by later image layers were removed
+func (c *layerContents) remainingPackages() []sbom.Package {
+	var packages []sbom.Package
+	for _, pkg := range c.packages {
+		if c.files[pkg.Path] {
+			packages = append(packages, pkg)
+		}
+	}
+	return packages
+}
+
+// Files of an earlier layer deleted by a whiteout of a later layer
+type deletion struct {
+	whiteout whiteout
+	from     int // Index of the layer with the deleted files
+	by       int // Index of the layer with the whiteout
+	files    []string
+}
+
+// Removes the files of each layer that later layers replace, and returns the files
+// deleted by whiteouts of later layers that are still in earlier layers.
+//
+// Lambda layers are extracted on top of each other, so removing a replaced file from
+// an earlier layer does not change the files visible to the function. Lambda layers
+// cannot delete files of earlier layers though, and removing the deleted files from
+// the earlier layer would make it differ from the image layer it was created from.
+func resolveShadowedFiles(layers []*layerContents) []deletion {
+	var deletions []deletion
+	for by, layer := range layers {
+		for _, w := range layer.whiteouts {
+			for from := 0; from < by; from++ {
+				if files := layers[from].deletedBy(w); len(files) > 0 {
+					deletions = append(deletions, deletion{whiteout: w, from: from, by: by, files: files})
+				}
+			}
+		}
+
+		// Pruned files replace the files of earlier layers with the file of the execution environment
+		names := append([]string{}, layer.pruned...)
+		for name := range layer.files {
+			names = append(names, name)
+		}
+		for _, name := range names {
+			for from := 0; from < by; from++ {
+				replaced := layers[from].replacedBy(name)
+				layers[from].remove(replaced)
+				layers[from].shadowed += len(replaced)
+			}
+		}
+	}
+
+	// Deleted files that a later layer adds again were removed as replaced files
+	var unresolved []deletion
+	for _, d := range deletions {
+		var files []string
+		for _, name := range d.files {
+			if layers[d.from].files[name] {
+				files = append(files, name)
+			}
+		}
+		if len(files) > 0 {
+			sort.Strings(files)
+			d.files = files
+			unresolved = append(unresolved, d)
+		}
+	}
+	return unresolved
+}
+
+// Range of layers that are flattened into a single Lambda layer
+type layerGroup struct {
+	first, last int
+}
+
+// Groups the layers from the layer with the deleted files to the layer with the whiteout,
+// merging overlapping groups
+func flattenGroups(deletions []deletion) []layerGroup {
+	var groups []layerGroup
+	for _, d := range deletions {
+		groups = append(groups, layerGroup{first: d.from, last: d.by})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].first < groups[j].first })
+
+	var merged []layerGroup
+	for _, group := range groups {
+		if n := len(merged); n > 0 && group.first <= merged[n-1].last {
+			if group.last > merged[n-1].last {
+				merged[n-1].last = group.last
+			}
+			continue
+		}
+		merged = append(merged, group)
+	}
+	return merged
+}
+
+// Digest identifying a Lambda layer flattened from several image layers
+func flattenedDigest(digests []string) string {
+	return string(godigest.FromString(strings.Join(digests, "\n")))
+}
+
+// Writes a Lambda layer file with the remaining files of the layers, which must not overlap
+func rewriteLayerFile(destination string, layers []*layerContents) (retErr error) {
+	out, err := atomicfile.Create(destination, 0644)
+	if err != nil {
+		return fmt.Errorf("creating %s: %v", destination, err)
+	}
+	defer func() {
+		if retErr != nil {
+			out.Abort()
+		} else if err := out.Commit(); err != nil {
+			retErr = fmt.Errorf("writing %s: %v", destination, err)
+		}
+	}()
+
+	w := zip.NewWriter(out)
+	for _, layer := range layers {
+		if layer.file == "" {
+			continue
+		}
+		if err := copyZipFiles(w, layer.file, layer.files); err != nil {
+			w.Close()
+			return fmt.Errorf("copying files from %s: %v", layer.file, err)
+		}
+	}
+	return w.Close()
+}
+
+func copyZipFiles(w *zip.Writer, filename string, files map[string]bool) error {
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if !files["opt/"+f.Name] {
+			continue
+		}
+
+		header := f.FileHeader
+		dst, err := w.CreateHeader(&header)
+		if err != nil {
+			return err
+		}
+		src, err := f.Open()
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(dst, src)
+		src.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", f.Name, err)
+		}
+	}
+	return nil
+}
+
+// Applies the cross-layer analysis to the Lambda layer files: replaced files are removed from
+// earlier layers, and deletions that Lambda layers cannot represent are logged, or applied by
+// flattening the affected layers into a single Lambda layer. Returns the remaining layers.
+func resolveLayerConflicts(layers []*layerContents, flatten bool, logger *logging.Logger) ([]*layerContents, error) {
+	deletions := resolveShadowedFiles(layers)
+
+	var groups []layerGroup
+	if flatten {
+		groups = flattenGroups(deletions)
+		for _, d := range deletions {
+			layers[d.from].remove(d.files)
+		}
+	} else {
+		for _, d := range deletions {
+			logger.Warnf("Image layer %s deletes %s, but Lambda layer file %s from image layer %s still contains %d deleted files (%s), because Lambda layers cannot delete files of earlier layers. Flatten the layers to apply the deletion",
+				layers[d.by].digest, "/"+d.whiteout.target, layers[d.from].file, layers[d.from].digest, len(d.files), strings.Join(d.files, ", "))
+		}
+	}
+
+	var result []*layerContents
+	for i := 0; i < len(layers); i++ {
+		if len(groups) > 0 && groups[0].first == i {
+			group := groups[0]
+			groups = groups[1:]
+			flattened, err := flattenLayers(layers[group.first:group.last+1], logger)
+			if err != nil {
+				return nil, err
+			}
+			if flattened != nil {
+				result = append(result, flattened)
+			}
+			i = group.last
+			continue
+		}
+
+		layer := layers[i]
+		if layer.file == "" {
+			continue
+		}
+		if layer.shadowed == 0 {
+			result = append(result, layer)
+			continue
+		}
+
+		if len(layer.files) == 0 {
+			if err := os.Remove(layer.file); err != nil {
+				return nil, err
+			}
+			logger.Infof("Removed Lambda layer file %s from image layer %s, because later image layers replace all of its files", layer.file, layer.digest)
+			continue
+		}
+		if err := rewriteLayerFile(layer.file, []*layerContents{layer}); err != nil {
+			return nil, err
+		}
+		layer.packages = layer.remainingPackages()
+		logger.Infof("Removed %d files replaced by later image layers from Lambda layer file %s", layer.shadowed, layer.file)
+		result = append(result, layer)
+	}
+	return result, nil
+}
+
+// Merges the remaining files of the layers into the file of the first Lambda layer among them.
+// Returns nil if no files remain.
+func flattenLayers(layers []*layerContents, logger *logging.Logger) (*layerContents, error) {
+	flattened := &layerContents{files: map[string]bool{}}
+	var digests []string
+	for _, layer := range layers {
+		digests = append(digests, layer.digest)
+		flattened.packages = append(flattened.packages, layer.remainingPackages()...)
+		flattened.extensions = append(flattened.extensions, layer.remainingExtensions()...)
+		flattened.pruned = append(flattened.pruned, layer.pruned...)
+		flattened.prunedBytes += layer.prunedBytes
+		for name := range layer.files {
+			flattened.files[name] = true
+		}
+		if flattened.file == "" {
+			flattened.file = layer.file
+		}
+	}
+	flattened.digest = flattenedDigest(digests)
+	flattened.flattenedDigests = digests
+
+	if len(flattened.files) > 0 {
+		if err := rewriteLayerFile(flattened.file, layers); err != nil {
+			return nil, err
+		}
+	}
+	for _, layer := range layers {
+		if layer.file != "" && (layer.file != flattened.file || len(flattened.files) == 0) {
+			if err := os.Remove(layer.file); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(flattened.files) == 0 {
+		logger.Infof("Removed the Lambda layer files of image layers %s, because they delete all of their files", strings.Join(digests, ", "))
+		return nil, nil
+	}
+	logger.Infof("Flattened image layers %s into Lambda layer file %s, to apply the files they delete", strings.Join(digests, ", "), flattened.file)
+	return flattened, nil
+}
@@ -0,0 +1,248 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package extract
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/internal/testing/mocks"
+	imgtypes "github.com/containers/image/v5/types"
+	"github.com/golang/mock/gomock"
+	godigest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Creates an image layer with the given files, in order. Whiteout files have empty contents.
+func createImageLayerFiles(t *testing.T,
+	rawSource *mocks.MockImageSource,
+	digest string,
+	files ...string) imgtypes.BlobInfo {
+
+	var contents bytes.Buffer
+	tw := tar.NewWriter(&contents)
+	for _, name := range files {
+		body := "contents of " + name
+		if strings.HasPrefix(filepath.Base(name), whiteoutPrefix) {
+			body = ""
+		}
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(body))}))
+		_, err := tw.Write([]byte(body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+
+	blobInfo := imgtypes.BlobInfo{Digest: godigest.Digest(digest)}
+	rawSource.EXPECT().GetBlob(gomock.Any(),
+		blobInfo,
+		gomock.Any()).Return(ioutil.NopCloser(bytes.NewReader(contents.Bytes())), int64(0), nil)
+	return blobInfo
+}
+
+// Names of the files in the zip file
+func zipFileNames(t *testing.T, filename string) []string {
+	r, err := zip.OpenReader(filename)
+	require.NoError(t, err)
+	defer r.Close()
+
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+func repackLayerFiles(t *testing.T, dir string, flatten bool, layers func(*mocks.MockImageSource) []imgtypes.BlobInfo) []string {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	source := mocks.NewMockImageCloser(ctrl)
+	rawSource := mocks.NewMockImageSource(ctrl)
+	source.EXPECT().LayerInfos().Return(layers(rawSource))
+
+	repacked, _, err := repackImage(&repackOptions{
+		ctx:              context.Background(),
+		imageSource:      source,
+		rawImageSource:   rawSource,
+		imageName:        "test-image",
+		layerOutputDir:   dir,
+		flattenWhiteouts: flatten,
+	})
+	require.NoError(t, err)
+
+	var files []string
+	for _, layer := range repacked {
+		files = append(files, filepath.Base(layer.File)+": "+layer.Digest)
+	}
+	return files
+}
+
+func TestParseWhiteout(t *testing.T) {
+	w, ok := parseWhiteout("opt/lib/.wh.cache")
+	assert.True(t, ok)
+	assert.Equal(t, whiteout{name: "opt/lib/.wh.cache", target: "opt/lib/cache"}, w)
+
+	w, ok = parseWhiteout("opt/lib/.wh..wh..opq")
+	assert.True(t, ok)
+	assert.Equal(t, whiteout{name: "opt/lib/.wh..wh..opq", target: "opt/lib", opaque: true}, w)
+
+	w, ok = parseWhiteout(".wh.opt")
+	assert.True(t, ok)
+	assert.Equal(t, "opt", w.target)
+
+	_, ok = parseWhiteout("var/task/.wh.app.js")
+	assert.False(t, ok)
+
+	_, ok = parseWhiteout("opt/lib/cache")
+	assert.False(t, ok)
+}
+
+func TestRepackReplacedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	layers := repackLayerFiles(t, dir, false, func(rawSource *mocks.MockImageSource) []imgtypes.BlobInfo {
+		return []imgtypes.BlobInfo{
+			createImageLayerFiles(t, rawSource, "sha256:1", "opt/bin/app", "opt/lib/libfoo.so", "opt/share/data"),
+			// Replaces a file, and a directory of the first layer with a file
+			createImageLayerFiles(t, rawSource, "sha256:2", "opt/bin/app", "opt/lib"),
+		}
+	})
+	assert.Equal(t, []string{"layer-1.zip: sha256:1", "layer-2.zip: sha256:2"}, layers)
+
+	assert.Equal(t, []string{"share/data"}, zipFileNames(t, filepath.Join(dir, "layer-1.zip")))
+	assert.Equal(t, []string{"bin/app", "lib"}, zipFileNames(t, filepath.Join(dir, "layer-2.zip")))
+}
+
+func TestRepackDeletedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	layers := repackLayerFiles(t, dir, false, func(rawSource *mocks.MockImageSource) []imgtypes.BlobInfo {
+		return []imgtypes.BlobInfo{
+			createImageLayerFiles(t, rawSource, "sha256:1", "opt/bin/app", "opt/cache/1", "opt/cache/2"),
+			createImageLayerFiles(t, rawSource, "sha256:2", "opt/.wh.cache", "opt/bin/other"),
+		}
+	})
+
+	// The deleted files stay in the first layer without flattening
+	assert.Equal(t, []string{"layer-1.zip: sha256:1", "layer-2.zip: sha256:2"}, layers)
+	assert.Equal(t, []string{"bin/app", "cache/1", "cache/2"}, zipFileNames(t, filepath.Join(dir, "layer-1.zip")))
+	assert.Equal(t, []string{"bin/other"}, zipFileNames(t, filepath.Join(dir, "layer-2.zip")))
+}
+
+func TestRepackDeletedFilesAddedAgain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	layers := repackLayerFiles(t, dir, true, func(rawSource *mocks.MockImageSource) []imgtypes.BlobInfo {
+		return []imgtypes.BlobInfo{
+			createImageLayerFiles(t, rawSource, "sha256:1", "opt/bin/app", "opt/etc/config"),
+			createImageLayerFiles(t, rawSource, "sha256:2", "opt/etc/.wh.config", "opt/etc/config"),
+		}
+	})
+
+	// The deleted file is replaced, so the layers are not flattened
+	assert.Equal(t, []string{"layer-1.zip: sha256:1", "layer-2.zip: sha256:2"}, layers)
+	assert.Equal(t, []string{"bin/app"}, zipFileNames(t, filepath.Join(dir, "layer-1.zip")))
+	assert.Equal(t, []string{"etc/config"}, zipFileNames(t, filepath.Join(dir, "layer-2.zip")))
+}
+
+func TestRepackFlattenWhiteouts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	layers := repackLayerFiles(t, dir, true, func(rawSource *mocks.MockImageSource) []imgtypes.BlobInfo {
+		return []imgtypes.BlobInfo{
+			createImageLayerFiles(t, rawSource, "sha256:1", "opt/bin/app", "opt/cache/1"),
+			createImageLayerFiles(t, rawSource, "sha256:2", "opt/lib/libfoo.so", "opt/share/a", "opt/share/b"),
+			createImageLayerFiles(t, rawSource, "sha256:3", "opt/.wh.cache"),
+			// Overlaps with the layers flattened for the deleted cache
+			createImageLayerFiles(t, rawSource, "sha256:4", "opt/share/.wh..wh..opq", "opt/share/c"),
+			createImageLayerFiles(t, rawSource, "sha256:5", "opt/bin/other"),
+		}
+	})
+
+	flattened := flattenedDigest([]string{"sha256:1", "sha256:2", "sha256:3", "sha256:4"})
+	assert.Equal(t, []string{"layer-1.zip: " + flattened, "layer-4.zip: sha256:5"}, layers)
+	assert.ElementsMatch(t, []string{"bin/app", "lib/libfoo.so", "share/c"}, zipFileNames(t, filepath.Join(dir, "layer-1.zip")))
+	assert.Equal(t, []string{"bin/other"}, zipFileNames(t, filepath.Join(dir, "layer-4.zip")))
+
+	// The other files of the flattened layers are removed
+	files, err := filepath.Glob(filepath.Join(dir, "layer-*.zip"))
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+}
+
+func TestFlattenGroups(t *testing.T) {
+	groups := flattenGroups([]deletion{
+		{from: 3, by: 5},
+		{from: 0, by: 2},
+		{from: 1, by: 3},
+		{from: 6, by: 7},
+	})
+	assert.Equal(t, []layerGroup{{first: 0, last: 5}, {first: 6, last: 7}}, groups)
+}
+
+func TestRepackSBOMWithoutShadowedPackages(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	source := mocks.NewMockImageCloser(ctrl)
+	rawSource := mocks.NewMockImageSource(ctrl)
+	source.EXPECT().LayerInfos().Return([]imgtypes.BlobInfo{
+		createImageLayerEntries(t, rawSource, "sha256:1",
+			layerEntry{name: "opt/nodejs/node_modules/left-pad/package.json", body: []byte(`{"name": "left-pad", "version": "1.3.0"}`)},
+			layerEntry{name: "opt/bin/app", body: []byte("app")}),
+		// Replaces the package of the first layer
+		createImageLayerEntries(t, rawSource, "sha256:2",
+			layerEntry{name: "opt/nodejs/node_modules/left-pad/package.json", body: []byte(`{"name": "left-pad", "version": "1.3.1"}`)}),
+		createImageLayerEntries(t, rawSource, "sha256:3",
+			layerEntry{name: "opt/python/six-1.15.0.dist-info/METADATA", body: []byte("Name: six\nVersion: 1.15.0\n")}),
+		// Deletes the package of the third layer, which is flattened into it
+		createImageLayerEntries(t, rawSource, "sha256:4",
+			layerEntry{name: "opt/python/.wh.six-1.15.0.dist-info"},
+			layerEntry{name: "opt/python/six-1.16.0.dist-info/METADATA", body: []byte("Name: six\nVersion: 1.16.0\n")}),
+	})
+
+	layers, _, err := repackImage(&repackOptions{
+		ctx:              context.Background(),
+		imageSource:      source,
+		rawImageSource:   rawSource,
+		imageName:        "test-image",
+		layerOutputDir:   dir,
+		generateSBOM:     true,
+		flattenWhiteouts: true,
+	})
+	require.NoError(t, err)
+	require.Len(t, layers, 3)
+
+	sboms := make([]string, len(layers))
+	for i, layer := range layers {
+		contents, err := ioutil.ReadFile(layer.SBOMFile)
+		require.NoError(t, err)
+		sboms[i] = string(contents)
+	}
+
+	assert.NotContains(t, sboms[0], "pkg:npm/left-pad")
+	assert.Contains(t, sboms[1], "pkg:npm/left-pad@1.3.1")
+	assert.Equal(t, flattenedDigest([]string{"sha256:3", "sha256:4"}), layers[2].Digest)
+	assert.Contains(t, sboms[2], "pkg:pypi/six@1.16.0")
+	assert.NotContains(t, sboms[2], "pkg:pypi/six@1.15.0")
+}
@@ -0,0 +1,178 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package extract
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	imgtypes "github.com/containers/image/v5/types"
+	godigest "github.com/opencontainers/go-digest"
+)
+
+const createdByPrefix = "created-by:"
+
+// Selects image layers by their number in the image (starting at 1), their digest or the digest
+// of their uncompressed contents (as listed by 'docker inspect'), or a regular expression matching the command that created them in the image history,
+// like '3', 'sha256:<hex>' or 'created-by:pip install'
+type LayerSelector struct {
+	selector  string
+	index     int
+	digest    godigest.Digest
+	createdBy *regexp.Regexp
+}
+
+func ParseLayerSelector(selector string) (*LayerSelector, error) {
+	s := &LayerSelector{selector: selector}
+	switch {
+	case strings.HasPrefix(selector, createdByPrefix):
+		pattern, err := regexp.Compile(strings.TrimPrefix(selector, createdByPrefix))
+		if err != nil {
+			return nil, fmt.Errorf("invalid layer selector %q: %v", selector, err)
+		}
+		s.createdBy = pattern
+	case strings.Contains(selector, ":"):
+		s.digest = godigest.Digest(selector)
+		if err := s.digest.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid layer selector %q: %v", selector, err)
+		}
+	default:
+		index, err := strconv.Atoi(selector)
+		if err != nil || index < 1 {
+			return nil, fmt.Errorf("invalid layer selector %q: expected a layer number starting at 1, a digest like sha256:<hex>, or created-by:<regular expression>", selector)
+		}
+		s.index = index
+	}
+	return s, nil
+}
+
+func ParseLayerSelectors(selectors []string) ([]*LayerSelector, error) {
+	var parsed []*LayerSelector
+	for _, selector := range selectors {
+		s, err := ParseLayerSelector(selector)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, s)
+	}
+	return parsed, nil
+}
+
+func (s *LayerSelector) String() string {
+	return s.selector
+}
+
+func (s *LayerSelector) needsConfig() bool {
+	return s.createdBy != nil || s.digest != ""
+}
+
+// Image layer as seen by layer selectors
+type selectableLayer struct {
+	index     int // Number of the layer in the image, starting at 1
+	digest    godigest.Digest
+	diffID    godigest.Digest // Digest of the uncompressed contents, empty if not read from the image config
+	createdBy string          // Empty if the image has no history for the layer
+}
+
+func (s *LayerSelector) matches(layer selectableLayer) bool {
+	switch {
+	case s.createdBy != nil:
+		return s.createdBy.MatchString(layer.createdBy)
+	case s.digest != "":
+		return s.digest == layer.digest || s.digest == layer.diffID
+	default:
+		return s.index == layer.index
+	}
+}
+
+// Layers of the image, with their uncompressed digests and the commands that created them from the image config if any selector needs them
+func selectableLayers(ctx context.Context, img imgtypes.Image, selectors []*LayerSelector) ([]selectableLayer, error) {
+	var layers []selectableLayer
+	for i, layerInfo := range img.LayerInfos() {
+		layers = append(layers, selectableLayer{index: i + 1, digest: layerInfo.Digest})
+	}
+
+	needsConfig := false
+	for _, s := range selectors {
+		needsConfig = needsConfig || s.needsConfig()
+	}
+	if !needsConfig {
+		return layers, nil
+	}
+
+	config, err := img.OCIConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.RootFS.DiffIDs) == len(layers) {
+		for i := range layers {
+			layers[i].diffID = config.RootFS.DiffIDs[i]
+		}
+	}
+
+	// History entries of empty layers, like ENV or CMD, have no layer in the image
+	var createdBy []string
+	for _, history := range config.History {
+		if !history.EmptyLayer {
+			createdBy = append(createdBy, history.CreatedBy)
+		}
+	}
+	if len(createdBy) == len(layers) {
+		for i := range layers {
+			layers[i].createdBy = createdBy[i]
+		}
+	}
+	return layers, nil
+}
+
+// Numbers of the image layers, starting at 1, that the include and exclude selectors exclude
+func selectLayers(ctx context.Context, img imgtypes.Image, include []string, exclude []string) (map[int]bool, error) {
+	includeSelectors, err := ParseLayerSelectors(include)
+	if err != nil {
+		return nil, err
+	}
+	excludeSelectors, err := ParseLayerSelectors(exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	layers, err := selectableLayers(ctx, img, append(append([]*LayerSelector{}, includeSelectors...), excludeSelectors...))
+	if err != nil {
+		return nil, err
+	}
+	return excludedLayers(layers, includeSelectors, excludeSelectors)
+}
+
+// Numbers of the layers, starting at 1, that are excluded by the selectors. Without include selectors,
+// all layers are included unless excluded. Fails if a selector does not match any layer, to catch typos.
+func excludedLayers(layers []selectableLayer, include []*LayerSelector, exclude []*LayerSelector) (map[int]bool, error) {
+	for _, s := range append(append([]*LayerSelector{}, include...), exclude...) {
+		found := false
+		for _, layer := range layers {
+			found = found || s.matches(layer)
+		}
+		if !found {
+			return nil, fmt.Errorf("layer selector %q does not match any of the %d layers of the image", s, len(layers))
+		}
+	}
+
+	excluded := map[int]bool{}
+	for _, layer := range layers {
+		if (len(include) > 0 && !matchesAny(include, layer)) || matchesAny(exclude, layer) {
+			excluded[layer.index] = true
+		}
+	}
+	return excluded, nil
+}
+
+func matchesAny(selectors []*LayerSelector, layer selectableLayer) bool {
+	for _, s := range selectors {
+		if s.matches(layer) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package extract
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/internal/testing/mocks"
+	imgtypes "github.com/containers/image/v5/types"
+	"github.com/golang/mock/gomock"
+	godigest "github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDigest = "sha256:ab3f5bd1e2b5ef0eb3e1fa0a8cbb1d7a7f39ec0e7bc1d9c8ba8c8e2b3b1e0f6a"
+
+func TestParseLayerSelector(t *testing.T) {
+	s, err := ParseLayerSelector("3")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, s.index)
+
+	s, err = ParseLayerSelector(testDigest)
+	assert.Nil(t, err)
+	assert.Equal(t, godigest.Digest(testDigest), s.digest)
+
+	s, err = ParseLayerSelector("created-by:pip install")
+	assert.Nil(t, err)
+	assert.True(t, s.createdBy.MatchString("/bin/sh -c pip install -r requirements.txt"))
+
+	for _, invalid := range []string{"0", "layer-1", "sha256:123", "created-by:("} {
+		_, err = ParseLayerSelector(invalid)
+		assert.Error(t, err, invalid)
+		assert.Contains(t, err.Error(), "invalid layer selector", invalid)
+	}
+}
+
+func TestExcludedLayers(t *testing.T) {
+	layers := []selectableLayer{
+		{index: 1, digest: "sha256:1", createdBy: "ADD rootfs.tar.gz /"},
+		{index: 2, digest: "sha256:2", diffID: testDigest, createdBy: "/bin/sh -c yum install -y php"},
+		{index: 3, digest: "sha256:3", createdBy: "/bin/sh -c pip install -r requirements.txt"},
+		{index: 4, digest: "sha256:4", createdBy: "COPY app /opt/app"},
+	}
+	selectors := func(selectors ...string) []*LayerSelector {
+		parsed, err := ParseLayerSelectors(selectors)
+		require.NoError(t, err)
+		return parsed
+	}
+
+	excluded, err := excludedLayers(layers, nil, selectors("1", "created-by:pip install"))
+	assert.Nil(t, err)
+	assert.Equal(t, map[int]bool{1: true, 3: true}, excluded)
+
+	// Layers can be selected by the digest of their uncompressed contents
+	excluded, err = excludedLayers(layers, selectors(testDigest, "created-by:^COPY "), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, map[int]bool{1: true, 3: true}, excluded)
+
+	excluded, err = excludedLayers(layers, selectors("created-by:install"), selectors("2"))
+	assert.Nil(t, err)
+	assert.Equal(t, map[int]bool{1: true, 2: true, 4: true}, excluded)
+
+	_, err = excludedLayers(layers, nil, selectors("5"))
+	assert.Error(t, err)
+	assert.Equal(t, `layer selector "5" does not match any of the 4 layers of the image`, err.Error())
+}
+
+func TestRepackSelectedLayers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	source := mocks.NewMockImageCloser(ctrl)
+	rawSource := mocks.NewMockImageSource(ctrl)
+
+	// The excluded layer is not read
+	blobInfos := []imgtypes.BlobInfo{
+		*createImageLayer(t, rawSource, "opt/php/bin/php", "hello world 1", "sha256:1"),
+		{Digest: "sha256:2"},
+		*createImageLayer(t, rawSource, "opt/app/index.php", "hello world 3", "sha256:3"),
+	}
+	source.EXPECT().LayerInfos().Return(blobInfos).AnyTimes()
+	source.EXPECT().OCIConfig(gomock.Any()).Return(&v1.Image{
+		History: []v1.History{
+			{CreatedBy: "/bin/sh -c yum install -y php"},
+			{CreatedBy: "/bin/sh -c #(nop)  ENV DEBUG=1", EmptyLayer: true},
+			{CreatedBy: "/bin/sh -c yum install -y datadog-agent"},
+			{CreatedBy: "COPY app /opt/app"},
+		},
+	}, nil)
+
+	excluded, err := selectLayers(context.Background(), source, nil, []string{"created-by:datadog"})
+	require.NoError(t, err)
+	assert.Equal(t, map[int]bool{2: true}, excluded)
+
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	layers, _, err := repackImage(&repackOptions{
+		ctx:            context.Background(),
+		imageSource:    source,
+		rawImageSource: rawSource,
+		imageName:      "test-image",
+		layerOutputDir: dir,
+		excludedLayers: excluded,
+	})
+	assert.Nil(t, err)
+	assert.Len(t, layers, 2)
+	validateLambdaLayer(t, &layers[0], "php/bin/php", "hello world 1", "sha256:1")
+	validateLambdaLayer(t, &layers[1], "app/index.php", "hello world 3", "sha256:3")
+}
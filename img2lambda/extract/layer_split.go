@@ -0,0 +1,261 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package extract
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/logging"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/sbom"
+)
+
+// Estimated size of the zip headers of an entry, besides its compressed contents
+// and the name that is stored in both the local and the central directory header
+const zipEntryOverhead = 100
+
+// File in a Lambda layer file, with its estimated size in the zip file
+type zipEntry struct {
+	name  string // Path in the image, like opt/bin/app
+	size  int64
+	index int // Position in the Lambda layer file
+}
+
+// Files that are kept in the same part if possible
+type entryGroup struct {
+	key     string
+	entries []zipEntry
+	size    int64
+}
+
+// Splits the Lambda layer files larger than the maximum size into several Lambda layer files.
+// The parts are named after the split file, like layer-2-part-1.zip, and keep the digest
+// of the image layer, so that repacking the same image layer results in the same parts.
+func splitLargeLayers(layers []*layerContents, maxSize int64, logger *logging.Logger) ([]*layerContents, error) {
+	if maxSize <= 0 {
+		return layers, nil
+	}
+
+	var result []*layerContents
+	for _, layer := range layers {
+		info, err := os.Stat(layer.file)
+		if err != nil {
+			return nil, err
+		}
+		if info.Size() <= maxSize {
+			result = append(result, layer)
+			continue
+		}
+
+		entries, err := readZipEntries(layer.file)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %v", layer.file, err)
+		}
+		parts := partitionEntries(entries, maxSize)
+		if len(parts) < 2 {
+			logger.Warnf("Lambda layer file %s is larger than %d bytes, but its files cannot be split into smaller parts", layer.file, maxSize)
+			result = append(result, layer)
+			continue
+		}
+
+		for i, part := range parts {
+			split, err := writeLayerPart(layer, i+1, part)
+			if err != nil {
+				return nil, err
+			}
+			if partSize(part) > maxSize {
+				logger.Warnf("Lambda layer file %s is larger than %d bytes, because it has a file larger than that", split.file, maxSize)
+			}
+			result = append(result, split)
+		}
+		if err := os.Remove(layer.file); err != nil {
+			return nil, err
+		}
+		logger.Infof("Split Lambda layer file %s (%d bytes) from image layer %s into %d Lambda layer files of at most %d bytes",
+			layer.file, info.Size(), layer.digest, len(parts), maxSize)
+	}
+	return result, nil
+}
+
+func readZipEntries(filename string) ([]zipEntry, error) {
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var entries []zipEntry
+	for i, f := range r.File {
+		entries = append(entries, zipEntry{
+			name:  "opt/" + f.Name,
+			size:  int64(f.CompressedSize64) + 2*int64(len(f.Name)) + zipEntryOverhead,
+			index: i,
+		})
+	}
+	return entries, nil
+}
+
+// Writes the files of the part to a new Lambda layer file next to the layer file
+func writeLayerPart(layer *layerContents, part int, entries []zipEntry) (*layerContents, error) {
+	files := map[string]bool{}
+	for _, entry := range entries {
+		files[entry.name] = true
+	}
+
+	var libraries []string
+	for _, soname := range layer.libraries {
+		if files["opt/lib/"+soname] {
+			libraries = append(libraries, soname)
+		}
+	}
+
+	var packages []sbom.Package
+	for _, pkg := range layer.packages {
+		if files[pkg.Path] {
+			packages = append(packages, pkg)
+		}
+	}
+
+	split := &layerContents{
+		digest:           layer.digest,
+		file:             fmt.Sprintf("%s-part-%d.zip", strings.TrimSuffix(layer.file, ".zip"), part),
+		files:            files,
+		packages:         packages,
+		extensions:       layer.extensions,
+		libraries:        libraries,
+		part:             part,
+		flattenedDigests: layer.flattenedDigests,
+	}
+	// Files pruned from the image layer are counted for its first part
+	if part == 1 {
+		split.pruned = layer.pruned
+		split.prunedBytes = layer.prunedBytes
+	}
+	source := &layerContents{file: layer.file, files: files}
+	if err := rewriteLayerFile(split.file, []*layerContents{source}); err != nil {
+		return nil, err
+	}
+	return split, nil
+}
+
+// Partitions the files into as few parts of at most the maximum size as possible, balancing the sizes of the parts.
+// Files under the same top-level directory are kept together, unless the directory is larger than the maximum size,
+// in which case its subdirectories are kept together instead. The files of each part are in their original order,
+// and the parts are ordered by their first file, so that the same files are always partitioned the same way.
+func partitionEntries(entries []zipEntry, maxSize int64) [][]zipEntry {
+	var groups []entryGroup
+	for _, group := range groupEntries(entries, 1) {
+		groups = append(groups, splitGroup(group, 1, maxSize)...)
+	}
+
+	var total int64
+	for _, group := range groups {
+		total += group.size
+	}
+
+	// Assign the largest groups first, each to the smallest part so far
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].size != groups[j].size {
+			return groups[i].size > groups[j].size
+		}
+		return groups[i].key < groups[j].key
+	})
+
+	count := int((total + maxSize - 1) / maxSize)
+	if count < 1 {
+		count = 1
+	}
+	var parts [][]zipEntry
+	for ; count <= len(groups); count++ {
+		parts = make([][]zipEntry, count)
+		sizes := make([]int64, count)
+		for _, group := range groups {
+			smallest := 0
+			for i := range sizes {
+				if sizes[i] < sizes[smallest] {
+					smallest = i
+				}
+			}
+			parts[smallest] = append(parts[smallest], group.entries...)
+			sizes[smallest] += group.size
+		}
+
+		fits := true
+		for _, size := range sizes {
+			fits = fits && size <= maxSize
+		}
+		if fits {
+			break
+		}
+	}
+	if count > len(groups) {
+		// Some groups are larger than the maximum size on their own
+		parts = nil
+		for _, group := range groups {
+			parts = append(parts, group.entries)
+		}
+	}
+
+	for _, part := range parts {
+		sort.Slice(part, func(i, j int) bool { return part[i].index < part[j].index })
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i][0].index < parts[j][0].index })
+	return parts
+}
+
+// Groups the files by their directory at the given depth under /opt. Files above that depth are in their own group.
+func groupEntries(entries []zipEntry, depth int) []entryGroup {
+	var groups []entryGroup
+	byKey := map[string]int{}
+	for _, entry := range entries {
+		key := groupKey(entry.name, depth)
+		i, ok := byKey[key]
+		if !ok {
+			i = len(groups)
+			byKey[key] = i
+			groups = append(groups, entryGroup{key: key})
+		}
+		groups[i].entries = append(groups[i].entries, entry)
+		groups[i].size += entry.size
+	}
+	return groups
+}
+
+// Path of the directory at the given depth under /opt containing the file, or the path of the file
+func groupKey(name string, depth int) string {
+	components := strings.Split(name, "/")
+	if len(components) > depth+1 {
+		components = components[:depth+1]
+	}
+	return strings.Join(components, "/")
+}
+
+// Splits the group into groups of its subdirectories, until they are no larger than the maximum size or single files.
+// Entries with the same path, which the layer tar may contain more than once, are kept together like a single file.
+func splitGroup(group entryGroup, depth int, maxSize int64) []entryGroup {
+	if group.size <= maxSize || len(group.entries) == 1 {
+		return []entryGroup{group}
+	}
+
+	subgroups := groupEntries(group.entries, depth+1)
+	if len(subgroups) == 1 && subgroups[0].key == group.key {
+		return []entryGroup{group}
+	}
+
+	var groups []entryGroup
+	for _, subgroup := range subgroups {
+		groups = append(groups, splitGroup(subgroup, depth+1, maxSize)...)
+	}
+	return groups
+}
+
+func partSize(entries []zipEntry) int64 {
+	var size int64
+	for _, entry := range entries {
+		size += entry.size
+	}
+	return size
+}
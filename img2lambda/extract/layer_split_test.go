@@ -0,0 +1,125 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package extract
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/internal/testing/mocks"
+	imgtypes "github.com/containers/image/v5/types"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func entryNames(parts [][]zipEntry) [][]string {
+	var names [][]string
+	for _, part := range parts {
+		var partNames []string
+		for _, entry := range part {
+			partNames = append(partNames, entry.name)
+		}
+		names = append(names, partNames)
+	}
+	return names
+}
+
+func TestPartitionEntries(t *testing.T) {
+	entries := []zipEntry{
+		{name: "opt/python/a", size: 40, index: 0},
+		{name: "opt/python/b", size: 40, index: 1},
+		{name: "opt/nodejs/a", size: 30, index: 2},
+		{name: "opt/bin/app", size: 50, index: 3},
+		{name: "opt/lib/libfoo.so", size: 20, index: 4},
+	}
+
+	// Top-level directories are kept together, and the parts are ordered by their first file
+	parts := partitionEntries(entries, 100)
+	assert.Equal(t, [][]string{
+		{"opt/python/a", "opt/python/b", "opt/lib/libfoo.so"},
+		{"opt/nodejs/a", "opt/bin/app"},
+	}, entryNames(parts))
+
+	// Directories larger than the maximum size are split by their subdirectories
+	parts = partitionEntries(entries, 50)
+	assert.Equal(t, [][]string{
+		{"opt/python/a"},
+		{"opt/python/b"},
+		{"opt/nodejs/a", "opt/lib/libfoo.so"},
+		{"opt/bin/app"},
+	}, entryNames(parts))
+
+	// Files larger than the maximum size get their own part
+	parts = partitionEntries(entries, 45)
+	assert.Equal(t, []string{"opt/bin/app"}, entryNames(parts)[3])
+
+	// Everything fits into a single part
+	parts = partitionEntries(entries, 1000)
+	assert.Len(t, parts, 1)
+}
+
+func TestPartitionDuplicateEntries(t *testing.T) {
+	entries := []zipEntry{
+		{name: "opt/bin/app", size: 50, index: 0},
+		{name: "opt/bin/app", size: 60, index: 1},
+		{name: "opt/lib/libfoo.so", size: 20, index: 2},
+	}
+
+	// Entries with the same path are kept in the same part, even if they are larger than the maximum size together
+	parts := partitionEntries(entries, 100)
+	assert.Equal(t, [][]string{
+		{"opt/bin/app", "opt/bin/app"},
+		{"opt/lib/libfoo.so"},
+	}, entryNames(parts))
+}
+
+func TestRepackSplitLargeLayers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	source := mocks.NewMockImageCloser(ctrl)
+	rawSource := mocks.NewMockImageSource(ctrl)
+	source.EXPECT().LayerInfos().Return([]imgtypes.BlobInfo{
+		createImageLayerFiles(t, rawSource, "sha256:1", "opt/bin/app"),
+		createImageLayerFiles(t, rawSource, "sha256:2",
+			"opt/python/a", "opt/python/b", "opt/python/c",
+			"opt/nodejs/a", "opt/nodejs/b", "opt/nodejs/c"),
+	})
+
+	// Each file takes a bit more than 130 bytes in the zip file
+	repacked, _, err := repackImage(&repackOptions{
+		ctx:            context.Background(),
+		imageSource:    source,
+		rawImageSource: rawSource,
+		imageName:      "test-image",
+		layerOutputDir: dir,
+		maxLayerSize:   600,
+	})
+	require.NoError(t, err)
+
+	var files []string
+	for _, layer := range repacked {
+		files = append(files, filepath.Base(layer.File)+": "+layer.Digest)
+	}
+	assert.Equal(t, []string{
+		"layer-1.zip: sha256:1",
+		"layer-2-part-1.zip: sha256:2",
+		"layer-2-part-2.zip: sha256:2",
+	}, files)
+	assert.Equal(t, 0, repacked[0].Part)
+	assert.Equal(t, 1, repacked[1].Part)
+	assert.Equal(t, 2, repacked[2].Part)
+
+	assert.Equal(t, []string{"python/a", "python/b", "python/c"}, zipFileNames(t, filepath.Join(dir, "layer-2-part-1.zip")))
+	assert.Equal(t, []string{"nodejs/a", "nodejs/b", "nodejs/c"}, zipFileNames(t, filepath.Join(dir, "layer-2-part-2.zip")))
+	_, err = os.Stat(filepath.Join(dir, "layer-2.zip"))
+	assert.True(t, os.IsNotExist(err))
+}
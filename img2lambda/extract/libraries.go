@@ -0,0 +1,385 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package extract
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/internal/atomicfile"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/logging"
+	imgtypes "github.com/containers/image/v5/types"
+	"github.com/mholt/archiver"
+)
+
+// Directories of the image that the dynamic linker searches for libraries, in order
+var imageLibraryDirs = []string{
+	"lib64",
+	"usr/lib64",
+	"lib",
+	"usr/lib",
+	"usr/local/lib64",
+	"usr/local/lib",
+	"lib/x86_64-linux-gnu",
+	"usr/lib/x86_64-linux-gnu",
+	"lib/aarch64-linux-gnu",
+	"usr/lib/aarch64-linux-gnu",
+}
+
+// Directories of the function and its layers on the LD_LIBRARY_PATH of Lambda functions
+var lambdaLibraryDirs = []string{"var/task", "var/task/lib", "opt/lib"}
+
+// Libraries that the Lambda execution environment provides to all functions
+var lambdaEnvironmentLibraries = map[string]bool{
+	"ld-linux-x86-64.so.2":  true,
+	"ld-linux-aarch64.so.1": true,
+	"libc.so.6":             true,
+	"libcrypt.so.1":         true,
+	"libdl.so.2":            true,
+	"libgcc_s.so.1":         true,
+	"libm.so.6":             true,
+	"libnsl.so.1":           true,
+	"libpthread.so.0":       true,
+	"libresolv.so.2":        true,
+	"librt.so.1":            true,
+	"libstdc++.so.6":        true,
+	"libutil.so.1":          true,
+	"libz.so.1":             true,
+}
+
+// File of the image that is relevant to bundling libraries: an ELF file or link in a library directory,
+// or a file that is repacked into the function or a layer, with the libraries it needs if it is an ELF file
+type elfFile struct {
+	path     string   // Path in the image, like opt/bin/app or usr/lib64/libfoo.so.1
+	layer    int      // Index of the image layer with the file
+	repacked bool     // Repacked into the function or a layer, rather than in a library directory
+	deleted  bool     // Deleted by a whiteout file in a library directory
+	link     string   // Path in the image that a link in a library directory points to
+	needed   []string // Sonames of the libraries that the ELF file needs (DT_NEEDED)
+	runpath  []string // Directories in the image that the ELF file searches for libraries first (DT_RUNPATH or DT_RPATH)
+}
+
+func isImageLibraryDir(dir string) bool {
+	for _, d := range imageLibraryDirs {
+		if d == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// Records the file if it is relevant to bundling libraries. The contents of ELF files are copied to a
+// temporary file to parse their headers, so the file's reader is replaced to allow repacking it afterwards.
+// Closing the replaced reader removes the temporary file.
+func scanLibraryFile(f *archiver.File, hdr *tar.Header, repacked bool) (*elfFile, error) {
+	name := path.Clean(strings.TrimPrefix(filepath.ToSlash(hdr.Name), "/"))
+	dir, base := path.Split(name)
+	dir = path.Clean(dir)
+	if !repacked && !isImageLibraryDir(dir) {
+		return nil, nil
+	}
+	if !repacked && strings.HasPrefix(base, whiteoutPrefix) {
+		if base == whiteoutOpaque {
+			return nil, nil
+		}
+		return &elfFile{path: path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)), deleted: true}, nil
+	}
+
+	file := &elfFile{path: name, repacked: repacked}
+	switch hdr.Typeflag {
+	case tar.TypeSymlink:
+		if !repacked {
+			if strings.HasPrefix(hdr.Linkname, "/") {
+				file.link = path.Clean(strings.TrimPrefix(hdr.Linkname, "/"))
+			} else {
+				file.link = path.Join(dir, hdr.Linkname)
+			}
+		}
+		return file, nil
+	case tar.TypeLink:
+		if !repacked {
+			file.link = path.Clean(strings.TrimPrefix(filepath.ToSlash(hdr.Linkname), "/"))
+		}
+		return file, nil
+	case tar.TypeReg, tar.TypeRegA:
+	default:
+		if !repacked {
+			return nil, nil
+		}
+		return file, nil
+	}
+
+	header := make([]byte, 4)
+	n, err := io.ReadFull(f.ReadCloser, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	if !bytes.Equal(header[:n], []byte(elf.ELFMAG)) {
+		f.ReadCloser = teeReadCloser{Reader: io.MultiReader(bytes.NewReader(header[:n]), f.ReadCloser), Closer: f.ReadCloser}
+		return file, nil
+	}
+
+	f.ReadCloser = teeReadCloser{Reader: io.MultiReader(bytes.NewReader(header), f.ReadCloser), Closer: f.ReadCloser}
+	tmp, _, err := copyToTempFile(f, "img2lambda-elf-")
+	if err != nil {
+		return nil, err
+	}
+
+	ef, err := elf.NewFile(tmp)
+	if err != nil {
+		// Not a valid ELF file, which the dynamic linker would not load either
+		return file, nil
+	}
+	defer ef.Close()
+
+	file.needed, _ = ef.ImportedLibraries()
+	runpath, _ := ef.DynString(elf.DT_RUNPATH)
+	if len(runpath) == 0 {
+		runpath, _ = ef.DynString(elf.DT_RPATH)
+	}
+	for _, entry := range runpath {
+		for _, dir := range strings.Split(entry, ":") {
+			dir = strings.Replace(dir, "${ORIGIN}", "/"+path.Dir(name), -1)
+			dir = strings.Replace(dir, "$ORIGIN", "/"+path.Dir(name), -1)
+			if strings.HasPrefix(dir, "/") {
+				file.runpath = append(file.runpath, path.Clean(strings.TrimPrefix(dir, "/")))
+			}
+		}
+	}
+	return file, nil
+}
+
+// Library of the image to bundle
+type bundledLibrary struct {
+	soname string
+	file   *elfFile // Regular file with the contents of the library, after following links
+}
+
+// Finds the libraries that the repacked ELF files need, and the libraries that those need, which are neither
+// provided by the Lambda execution environment nor in the library path of the function and its layers.
+// The files are in image layer order, so that files of later layers replace the files of earlier layers.
+func findLibraries(files []elfFile, logger *logging.Logger) []bundledLibrary {
+	image := map[string]*elfFile{}
+	repacked := map[string]*elfFile{}
+	for i := range files {
+		file := &files[i]
+		switch {
+		case file.deleted:
+			delete(image, file.path)
+		case file.repacked:
+			repacked[file.path] = file
+		default:
+			image[file.path] = file
+		}
+	}
+
+	var binaries []*elfFile
+	for _, file := range repacked {
+		if len(file.needed) > 0 {
+			binaries = append(binaries, file)
+		}
+	}
+	sort.Slice(binaries, func(i, j int) bool { return binaries[i].path < binaries[j].path })
+
+	var bundled []bundledLibrary
+	seen := map[string]bool{}
+	var resolve func(needer *elfFile)
+	resolve = func(needer *elfFile) {
+		for _, soname := range needer.needed {
+			if seen[soname] || lambdaEnvironmentLibraries[soname] || inLibraryPath(repacked, soname, needer.runpath) {
+				continue
+			}
+			seen[soname] = true
+
+			library := findImageLibrary(image, soname)
+			if library == nil {
+				logger.Warnf("/%s needs library %s, which is neither in the image nor in the Lambda execution environment", needer.path, soname)
+				continue
+			}
+			bundled = append(bundled, bundledLibrary{soname: soname, file: library})
+			resolve(library)
+		}
+	}
+	for _, binary := range binaries {
+		resolve(binary)
+	}
+	return bundled
+}
+
+// Whether the library is in the function or its layers, in a directory that the dynamic linker searches
+func inLibraryPath(repacked map[string]*elfFile, soname string, runpath []string) bool {
+	for _, dir := range append(append([]string{}, runpath...), lambdaLibraryDirs...) {
+		if _, found := repacked[path.Join(dir, soname)]; found {
+			return true
+		}
+	}
+	return false
+}
+
+// Finds the library in the library directories of the image, following links
+func findImageLibrary(image map[string]*elfFile, soname string) *elfFile {
+	for _, dir := range imageLibraryDirs {
+		file := image[path.Join(dir, soname)]
+		for hops := 0; file != nil && file.link != "" && hops < 10; hops++ {
+			file = image[file.link]
+		}
+		if file != nil && file.link == "" {
+			return file
+		}
+	}
+	return nil
+}
+
+// Reads the image layer, which may be gzip-compressed, and calls walk for each file
+func walkLayer(opts *repackOptions, layerInfo imgtypes.BlobInfo, walk func(f *archiver.File, hdr *tar.Header) error) error {
+	stream, _, err := opts.rawImageSource.GetBlob(opts.ctx, layerInfo, opts.cache)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	r := bufio.NewReader(stream)
+	magic, _ := r.Peek(2)
+	t, closeTar, err := openLayerTar(r, bytes.Equal(magic, []byte{0x1f, 0x8b}))
+	if err != nil {
+		return err
+	}
+	defer closeTar()
+
+	for {
+		if err := opts.ctx.Err(); err != nil {
+			return err
+		}
+		f, err := t.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("opening next file in layer tar: %v", err)
+		}
+		hdr, ok := f.Header.(*tar.Header)
+		if !ok {
+			return fmt.Errorf("expected header to be *tar.Header but was %T", f.Header)
+		}
+		if err := walk(&f, hdr); err != nil {
+			return fmt.Errorf("walking %s in layer tar: %v", hdr.Name, err)
+		}
+	}
+}
+
+// Records the files in the library directories of an image layer that is not repacked
+func scanLayerLibraries(opts *repackOptions, layerInfo imgtypes.BlobInfo, layer int) ([]elfFile, error) {
+	var files []elfFile
+	err := walkLayer(opts, layerInfo, func(f *archiver.File, hdr *tar.Header) error {
+		file, err := scanLibraryFile(f, hdr, false)
+		defer f.Close()
+		if file != nil {
+			file.layer = layer
+			files = append(files, *file)
+		}
+		return err
+	})
+	return files, err
+}
+
+// Writes the libraries to lib/ of a new Lambda layer file, reading each from its image layer again.
+// Returns the contents of the Lambda layer, or nil if there are no libraries to bundle.
+func bundleLibraries(opts *repackOptions, layerInfos []imgtypes.BlobInfo, libraries []bundledLibrary, destination string) (contents *layerContents, retErr error) {
+	if len(libraries) == 0 {
+		return nil, nil
+	}
+
+	// Sonames of the libraries by the image layer and path of their files
+	wanted := map[int]map[string][]string{}
+	for _, library := range libraries {
+		if wanted[library.file.layer] == nil {
+			wanted[library.file.layer] = map[string][]string{}
+		}
+		wanted[library.file.layer][library.file.path] = append(wanted[library.file.layer][library.file.path], library.soname)
+	}
+
+	out, err := atomicfile.Create(destination, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("creating %s: %v", destination, err)
+	}
+	defer func() {
+		if retErr != nil {
+			out.Abort()
+		} else if err := out.Commit(); err != nil {
+			retErr = fmt.Errorf("writing %s: %v", destination, err)
+		}
+	}()
+
+	contents = &layerContents{file: destination, files: map[string]bool{}}
+	w := zip.NewWriter(out)
+	for i, layerInfo := range layerInfos {
+		paths := wanted[i]
+		if paths == nil {
+			continue
+		}
+
+		written := map[string]bool{}
+		err := walkLayer(opts, layerInfo, func(f *archiver.File, hdr *tar.Header) error {
+			name := path.Clean(strings.TrimPrefix(filepath.ToSlash(hdr.Name), "/"))
+			sonames := paths[name]
+			if sonames == nil || (hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA) {
+				return nil
+			}
+			var library io.Reader = f.ReadCloser
+			if len(sonames) > 1 {
+				// The library is written once for each soname, so it is copied to a temporary file to read it again
+				tmp, err := ioutil.TempFile("", "img2lambda-library-")
+				if err != nil {
+					return err
+				}
+				defer tempFileReadCloser{File: tmp}.Close()
+				if _, err := io.Copy(tmp, f.ReadCloser); err != nil {
+					return err
+				}
+				library = tmp
+			}
+			for _, soname := range sonames {
+				if written[soname] {
+					continue
+				}
+				contents.libraries = append(contents.libraries, soname)
+				header := &zip.FileHeader{Name: "lib/" + soname, Method: zip.Deflate}
+				header.SetMode(hdr.FileInfo().Mode())
+				header.Modified = hdr.ModTime
+				dst, err := w.CreateHeader(header)
+				if err != nil {
+					return err
+				}
+				if seeker, ok := library.(io.Seeker); ok {
+					if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+						return err
+					}
+				}
+				if _, err := io.Copy(dst, library); err != nil {
+					return err
+				}
+				written[soname] = true
+				contents.files["opt/lib/"+soname] = true
+			}
+			return nil
+		})
+		if err != nil {
+			w.Close()
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return contents, nil
+}
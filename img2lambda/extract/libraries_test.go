@@ -0,0 +1,254 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package extract
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"debug/elf"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/internal/testing/mocks"
+	imgtypes "github.com/containers/image/v5/types"
+	"github.com/golang/mock/gomock"
+	"github.com/mholt/archiver"
+	godigest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Builds a minimal ELF shared object with a dynamic section listing the needed libraries and the runpath
+func buildELF(t *testing.T, runpath string, needed ...string) []byte {
+	strtab := []byte{0}
+	var dyn []elf.Dyn64
+	for _, name := range needed {
+		dyn = append(dyn, elf.Dyn64{Tag: int64(elf.DT_NEEDED), Val: uint64(len(strtab))})
+		strtab = append(append(strtab, name...), 0)
+	}
+	if runpath != "" {
+		dyn = append(dyn, elf.Dyn64{Tag: int64(elf.DT_RUNPATH), Val: uint64(len(strtab))})
+		strtab = append(append(strtab, runpath...), 0)
+	}
+	dyn = append(dyn, elf.Dyn64{Tag: int64(elf.DT_NULL)})
+	for len(strtab)%8 != 0 {
+		strtab = append(strtab, 0)
+	}
+
+	const headerSize = 64
+	dynOffset := uint64(headerSize + len(strtab))
+	dynSize := uint64(16 * len(dyn))
+	header := elf.Header64{
+		Type:      uint16(elf.ET_DYN),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     dynOffset + dynSize,
+		Ehsize:    headerSize,
+		Phentsize: 56,
+		Shentsize: 64,
+		Shnum:     3,
+	}
+	copy(header.Ident[:], elf.ELFMAG)
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	sections := []elf.Section64{
+		{},
+		{Type: uint32(elf.SHT_STRTAB), Off: headerSize, Size: uint64(len(strtab)), Addralign: 1},
+		{Type: uint32(elf.SHT_DYNAMIC), Off: dynOffset, Size: dynSize, Link: 1, Addralign: 8, Entsize: 16},
+	}
+
+	var b bytes.Buffer
+	for _, data := range []interface{}{header, strtab, dyn, sections} {
+		require.NoError(t, binary.Write(&b, binary.LittleEndian, data))
+	}
+	return b.Bytes()
+}
+
+type layerEntry struct {
+	name     string
+	body     []byte
+	linkname string // Creates a symbolic link if set
+}
+
+// Creates an image layer with the given entries, which may be read several times
+func createImageLayerEntries(t *testing.T, rawSource *mocks.MockImageSource, digest string, entries ...layerEntry) imgtypes.BlobInfo {
+	var contents bytes.Buffer
+	tw := tar.NewWriter(&contents)
+	for _, entry := range entries {
+		hdr := &tar.Header{Name: entry.name, Typeflag: tar.TypeReg, Mode: 0755, Size: int64(len(entry.body))}
+		if entry.linkname != "" {
+			hdr = &tar.Header{Name: entry.name, Typeflag: tar.TypeSymlink, Mode: 0777, Linkname: entry.linkname}
+		}
+		require.NoError(t, tw.WriteHeader(hdr))
+		_, err := tw.Write(entry.body)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+
+	blobInfo := imgtypes.BlobInfo{Digest: godigest.Digest(digest)}
+	rawSource.EXPECT().GetBlob(gomock.Any(), blobInfo, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, info imgtypes.BlobInfo, cache imgtypes.BlobInfoCache) (io.ReadCloser, int64, error) {
+			return ioutil.NopCloser(bytes.NewReader(contents.Bytes())), 0, nil
+		}).AnyTimes()
+	return blobInfo
+}
+
+func newArchiverFile(hdr *tar.Header, contents []byte) archiver.File {
+	return archiver.File{
+		FileInfo:   archiver.FileInfo{FileInfo: hdr.FileInfo()},
+		Header:     hdr,
+		ReadCloser: ioutil.NopCloser(bytes.NewReader(contents)),
+	}
+}
+
+func zipFileContents(t *testing.T, filename string) map[string][]byte {
+	r, err := zip.OpenReader(filename)
+	require.NoError(t, err)
+	defer r.Close()
+
+	contents := map[string][]byte{}
+	for _, f := range r.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		contents[f.Name], err = ioutil.ReadAll(rc)
+		rc.Close()
+		require.NoError(t, err)
+	}
+	return contents
+}
+
+func TestScanLibraryFile(t *testing.T) {
+	contents := buildELF(t, "$ORIGIN/../lib:/usr/local/app/lib", "libfoo.so.1", "libc.so.6")
+	hdr := &tar.Header{Name: "opt/bin/app", Typeflag: tar.TypeReg, Mode: 0755, Size: int64(len(contents))}
+	f := newArchiverFile(hdr, contents)
+
+	file, err := scanLibraryFile(&f, hdr, true)
+	require.NoError(t, err)
+	assert.Equal(t, &elfFile{
+		path:     "opt/bin/app",
+		repacked: true,
+		needed:   []string{"libfoo.so.1", "libc.so.6"},
+		runpath:  []string{"opt/lib", "usr/local/app/lib"},
+	}, file)
+
+	// The file can still be repacked
+	repacked, err := ioutil.ReadAll(f.ReadCloser)
+	require.NoError(t, err)
+	assert.Equal(t, contents, repacked)
+
+	// Closing the file removes the temporary copy of its contents
+	tmp := f.ReadCloser.(tempFileReadCloser).Name()
+	require.NoError(t, f.Close())
+	_, err = os.Stat(tmp)
+	assert.True(t, os.IsNotExist(err))
+
+	hdr = &tar.Header{Name: "usr/lib64/libfoo.so.1", Typeflag: tar.TypeSymlink, Linkname: "libfoo.so.1.2.3"}
+	f = newArchiverFile(hdr, nil)
+	file, err = scanLibraryFile(&f, hdr, false)
+	require.NoError(t, err)
+	assert.Equal(t, &elfFile{path: "usr/lib64/libfoo.so.1", link: "usr/lib64/libfoo.so.1.2.3"}, file)
+
+	hdr = &tar.Header{Name: "usr/lib64/.wh.libfoo.so.1", Typeflag: tar.TypeReg}
+	f = newArchiverFile(hdr, nil)
+	file, err = scanLibraryFile(&f, hdr, false)
+	require.NoError(t, err)
+	assert.Equal(t, &elfFile{path: "usr/lib64/libfoo.so.1", deleted: true}, file)
+
+	// Files outside of library directories are only relevant if they are repacked
+	hdr = &tar.Header{Name: "usr/bin/tool", Typeflag: tar.TypeReg, Size: int64(len(contents))}
+	f = newArchiverFile(hdr, contents)
+	file, err = scanLibraryFile(&f, hdr, false)
+	require.NoError(t, err)
+	assert.Nil(t, file)
+}
+
+func TestRepackBundleLibraries(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	libfoo := buildELF(t, "", "libbar.so.1", "libc.so.6")
+	libbar := buildELF(t, "")
+
+	source := mocks.NewMockImageCloser(ctrl)
+	rawSource := mocks.NewMockImageSource(ctrl)
+	source.EXPECT().LayerInfos().Return([]imgtypes.BlobInfo{
+		createImageLayerEntries(t, rawSource, "sha256:1",
+			layerEntry{name: "usr/lib64/libfoo.so.1.2.3", body: libfoo},
+			layerEntry{name: "usr/lib64/libfoo.so.1", linkname: "libfoo.so.1.2.3"},
+			layerEntry{name: "usr/lib64/libbar.so.1", body: libbar},
+			layerEntry{name: "usr/lib64/libbar.so", linkname: "libbar.so.1"},
+			layerEntry{name: "usr/lib64/libunused.so.1", body: buildELF(t, "")},
+			layerEntry{name: "usr/lib64/libdeleted.so.1", body: buildELF(t, "")}),
+		createImageLayerEntries(t, rawSource, "sha256:2",
+			layerEntry{name: "usr/lib64/.wh.libdeleted.so.1"},
+			layerEntry{name: "opt/bin/app", body: buildELF(t, "", "libfoo.so.1", "libc.so.6", "libpresent.so.1", "libdeleted.so.1", "libbar.so")},
+			layerEntry{name: "opt/lib/libpresent.so.1", body: []byte("not an ELF file")}),
+	})
+
+	repacked, _, err := repackImage(&repackOptions{
+		ctx:             context.Background(),
+		imageSource:     source,
+		rawImageSource:  rawSource,
+		imageName:       "test-image",
+		layerOutputDir:  dir,
+		bundleLibraries: true,
+	})
+	require.NoError(t, err)
+	require.Len(t, repacked, 2)
+
+	librariesFile := filepath.Join(dir, "libraries.zip")
+	digest, err := zipContentDigest(librariesFile)
+	require.NoError(t, err)
+	assert.Equal(t, librariesFile, repacked[0].File)
+	assert.Equal(t, digest, repacked[0].Digest)
+	assert.Equal(t, []string{"libfoo.so.1", "libbar.so.1", "libbar.so"}, repacked[0].BundledLibraries)
+	assert.Equal(t, map[string][]byte{"lib/libfoo.so.1": libfoo, "lib/libbar.so.1": libbar, "lib/libbar.so": libbar}, zipFileContents(t, librariesFile))
+
+	assert.Equal(t, "sha256:2", repacked[1].Digest)
+	assert.Empty(t, repacked[1].BundledLibraries)
+}
+
+func TestRepackBundleLibrariesOfSkippedLayers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	source := mocks.NewMockImageCloser(ctrl)
+	rawSource := mocks.NewMockImageSource(ctrl)
+	source.EXPECT().LayerInfos().Return([]imgtypes.BlobInfo{
+		createImageLayerEntries(t, rawSource, "sha256:1",
+			layerEntry{name: "usr/lib/x86_64-linux-gnu/libfoo.so.1", body: buildELF(t, "")}),
+		createImageLayerEntries(t, rawSource, "sha256:2",
+			layerEntry{name: "var/task/app", body: buildELF(t, "", "libfoo.so.1", "libmissing.so.1")}),
+	})
+
+	repacked, _, err := repackImage(&repackOptions{
+		ctx:             context.Background(),
+		imageSource:     source,
+		rawImageSource:  rawSource,
+		imageName:       "test-image",
+		layerOutputDir:  dir,
+		baseLayerCount:  1,
+		bundleLibraries: true,
+	})
+	require.NoError(t, err)
+	require.Len(t, repacked, 1)
+	assert.Equal(t, []string{"libfoo.so.1"}, repacked[0].BundledLibraries)
+	assert.True(t, strings.HasPrefix(repacked[0].Digest, "sha256:"))
+}
@@ -4,102 +4,373 @@ package extract
 
 import (
 	"archive/tar"
+	"bytes"
 	"compress/gzip"
 	"context"
 	"fmt"
 	"io"
-	"log"
+	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/environment"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/internal/atomicfile"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/logging"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/progress"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/sbom"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/secrets"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/trust"
 	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
 	"github.com/containers/image/v5/image"
+	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/pkg/blobinfocache"
 	"github.com/containers/image/v5/transports/alltransports"
 	imgtypes "github.com/containers/image/v5/types"
 	zglob "github.com/mattn/go-zglob"
 	"github.com/mholt/archiver"
+	godigest "github.com/opencontainers/go-digest"
 	"github.com/pkg/errors"
 )
 
 // Converts container image to Lambda layer and function deployment package archive files
-func RepackImage(imageName string, layerOutputDir string) (layers []types.LambdaLayer, function *types.LambdaDeploymentPackage, retErr error) {
-	log.Printf("Parsing the image %s", imageName)
-
-	// Get image's layer data from image name
-	ref, err := alltransports.ParseImageName(imageName)
+func RepackImage(ctx context.Context, imageName string, extractOpts *types.ExtractOptions) (repacked *types.RepackedImage, retErr error) {
+	opts, err := openRepackOptions(ctx, imageName, extractOpts)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
+	defer func() {
+		if err := opts.imageSource.Close(); err != nil {
+			retErr = errors.Wrapf(retErr, " (close error: %v)", err)
+		}
+	}()
 
-	sys := &imgtypes.SystemContext{}
+	var baseLayerDigests []string
+	for _, layerInfo := range opts.imageSource.LayerInfos()[:opts.baseLayerCount] {
+		baseLayerDigests = append(baseLayerDigests, string(layerInfo.Digest))
+	}
 
-	dockerHost := os.Getenv("DOCKER_HOST")
+	manifestBytes, _, err := opts.imageSource.Manifest(opts.ctx)
+	if err != nil {
+		return nil, err
+	}
+	manifestDigest, err := manifest.Digest(manifestBytes)
+	if err != nil {
+		return nil, err
+	}
 
-	// Support communicating with Docker for Windows over local plain-text TCP socket
-	if dockerHost == "tcp://localhost:2375" || dockerHost == "tcp://127.0.0.1:2375" {
-		sys.DockerDaemonHost = strings.Replace(dockerHost, "tcp://", "http://", -1)
+	layers, function, err := repackImage(opts)
+	if err != nil {
+		return nil, err
 	}
 
-	// Support communicating with Docker Toolbox over encrypted socket
-	if strings.HasPrefix(dockerHost, "tcp://192.168.") && strings.HasSuffix(dockerHost, ":2376") {
-		sys.DockerDaemonHost = strings.Replace(dockerHost, "tcp://", "https://", -1)
+	var environmentName string
+	if opts.environment != nil {
+		environmentName = opts.environment.Environment
 	}
 
-	ctx := context.Background()
+	return &types.RepackedImage{
+		Name:             imageName,
+		ManifestDigest:   string(manifestDigest),
+		Verification:     opts.verification,
+		BaseImage:        extractOpts.BaseImage,
+		BaseLayerDigests: baseLayerDigests,
+		Environment:      environmentName,
+		Layers:           layers,
+		Function:         function,
+		SecretFindings:   opts.secretFindings,
+	}, nil
+}
 
-	cache := blobinfocache.DefaultCache(sys)
+// Opens the image and sets up repacking it with the extract options, skipping the layers of the base image
+// and the layers not selected. The image source must be closed by the caller.
+func openRepackOptions(ctx context.Context, imageName string, extractOpts *types.ExtractOptions) (*repackOptions, error) {
+	extractOpts.Logger.Infof("Parsing the image %s", imageName)
 
-	rawSource, err := ref.NewImageSource(ctx, sys)
+	var allowlist *secrets.Allowlist
+	if extractOpts.SecretsAllowlist != "" {
+		var err error
+		allowlist, err = secrets.LoadAllowlist(extractOpts.SecretsAllowlist)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	env, err := loadEnvironment(extractOpts)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	src, err := image.FromSource(ctx, sys, rawSource)
+	opts, err := openImage(ctx, imageName, extractOpts.SystemContext, &extractOpts.Signatures)
 	if err != nil {
-		if closeErr := rawSource.Close(); closeErr != nil {
-			return nil, nil, errors.Wrapf(err, " (close error: %v)", closeErr)
+		return nil, err
+	}
+	if opts.verification != nil {
+		extractOpts.Logger.Infof("Verified the signatures of image %s with manifest digest %s", imageName, opts.verification.ManifestDigest)
+	}
+	fail := func(err error) (*repackOptions, error) {
+		opts.imageSource.Close()
+		return nil, err
+	}
+
+	opts.logger = extractOpts.Logger
+	opts.progress = extractOpts.Progress
+	opts.layerOutputDir = extractOpts.OutputDir
+	opts.generateSBOM = extractOpts.SBOM
+	opts.secrets = allowlist
+	opts.flattenWhiteouts = extractOpts.FlattenWhiteouts
+	opts.maxLayerSize = extractOpts.MaxLayerSize
+	opts.separateExtensions = extractOpts.SeparateExtensions
+	opts.bundleLibraries = extractOpts.BundleLibraries
+	opts.environment = env
+	opts.keepFiles = extractOpts.KeepFiles
+	opts.runtime = extractOpts.Runtime
+
+	if extractOpts.BaseImage != "" {
+		opts.baseLayerCount, err = countBaseLayers(ctx, opts.imageSource, extractOpts.BaseImage, extractOpts.SystemContext)
+		if err != nil {
+			return fail(err)
+		}
+		extractOpts.Logger.Infof("Skipping the %d layers of base image %s", opts.baseLayerCount, extractOpts.BaseImage)
+	}
+
+	if len(extractOpts.IncludeLayers) > 0 || len(extractOpts.ExcludeLayers) > 0 {
+		opts.excludedLayers, err = selectLayers(ctx, opts.imageSource, extractOpts.IncludeLayers, extractOpts.ExcludeLayers)
+		if err != nil {
+			return fail(err)
 		}
+	}
 
-		return nil, nil, err
+	return opts, nil
+}
+
+// Number of layers at the start of the image that are the layers of the base image.
+// Layers are compared by the digests of their uncompressed contents in the image configs,
+// so the image and the base image can be in different transports.
+func countBaseLayers(ctx context.Context, img imgtypes.Image, baseImageName string, sys *imgtypes.SystemContext) (count int, retErr error) {
+	base, err := openImage(ctx, baseImageName, sys, nil)
+	if err != nil {
+		return 0, fmt.Errorf("opening base image %s: %v", baseImageName, err)
 	}
 	defer func() {
-		if err := src.Close(); err != nil {
-			retErr = errors.Wrapf(retErr, " (close error: %v)", err)
+		if err := base.imageSource.Close(); err != nil && retErr == nil {
+			retErr = err
 		}
 	}()
 
-	return repackImage(&repackOptions{
+	baseConfig, err := base.imageSource.OCIConfig(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("reading config of base image %s: %v", baseImageName, err)
+	}
+	config, err := img.OCIConfig(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(config.RootFS.DiffIDs) != len(img.LayerInfos()) {
+		return 0, fmt.Errorf("image config lists %d layers, but the image has %d layers", len(config.RootFS.DiffIDs), len(img.LayerInfos()))
+	}
+
+	count, err = matchBaseLayers(config.RootFS.DiffIDs, baseConfig.RootFS.DiffIDs)
+	if err != nil {
+		return 0, fmt.Errorf("image is not built from base image %s: %v", baseImageName, err)
+	}
+	return count, nil
+}
+
+func matchBaseLayers(diffIDs []godigest.Digest, baseDiffIDs []godigest.Digest) (int, error) {
+	if len(baseDiffIDs) > len(diffIDs) {
+		return 0, fmt.Errorf("base image has %d layers, but the image only has %d layers", len(baseDiffIDs), len(diffIDs))
+	}
+	for i, baseDiffID := range baseDiffIDs {
+		if diffIDs[i] != baseDiffID {
+			return 0, fmt.Errorf("layer %d of the image is %s, but %s in the base image", i+1, diffIDs[i], baseDiffID)
+		}
+	}
+	return len(baseDiffIDs), nil
+}
+
+// Opens the image for reading its layers. The caller must close the returned image source.
+// Without a system context, the Docker daemon is located with the DOCKER_HOST environment variable.
+// If signature checks are configured, the image is only opened if its manifest passes them.
+func openImage(ctx context.Context, imageName string, sys *imgtypes.SystemContext, signatures *types.SignatureOptions) (*repackOptions, error) {
+	// Get image's layer data from image name
+	ref, err := alltransports.ParseImageName(imageName)
+	if err != nil {
+		return nil, err
+	}
+
+	if sys == nil {
+		sys = defaultSystemContext()
+	}
+
+	cache := blobinfocache.DefaultCache(sys)
+
+	rawSource, err := ref.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify and parse the same manifest, so that the verified manifest is the one that is converted
+	unparsed := image.UnparsedInstance(rawSource, nil)
+	verification, err := trust.Verify(ctx, unparsed, signatures)
+	if err != nil {
+		return nil, closeAfterError(rawSource, err)
+	}
+
+	img, err := image.FromUnparsedImage(ctx, sys, unparsed)
+	if err != nil {
+		return nil, closeAfterError(rawSource, err)
+	}
+
+	return &repackOptions{
 		ctx:            ctx,
 		cache:          cache,
-		imageSource:    src,
+		imageSource:    &imageCloser{Image: img, src: rawSource},
 		rawImageSource: rawSource,
 		imageName:      imageName,
-		layerOutputDir: layerOutputDir,
-	})
+		verification:   verification,
+	}, nil
+}
+
+// Closes the image source when the image is closed, like the images returned by image.FromSource
+type imageCloser struct {
+	imgtypes.Image
+	src imgtypes.ImageSource
+}
+
+func (i *imageCloser) Close() error {
+	return i.src.Close()
+}
+
+func closeAfterError(src imgtypes.ImageSource, err error) error {
+	if closeErr := src.Close(); closeErr != nil {
+		return errors.Wrapf(err, " (close error: %v)", closeErr)
+	}
+	return err
+}
+
+func defaultSystemContext() *imgtypes.SystemContext {
+	sys := &imgtypes.SystemContext{}
+
+	dockerHost := os.Getenv("DOCKER_HOST")
+
+	// Support communicating with Docker for Windows over local plain-text TCP socket
+	if dockerHost == "tcp://localhost:2375" || dockerHost == "tcp://127.0.0.1:2375" {
+		sys.DockerDaemonHost = strings.Replace(dockerHost, "tcp://", "http://", -1)
+	}
+
+	// Support communicating with Docker Toolbox over encrypted socket
+	if strings.HasPrefix(dockerHost, "tcp://192.168.") && strings.HasSuffix(dockerHost, ":2376") {
+		sys.DockerDaemonHost = strings.Replace(dockerHost, "tcp://", "https://", -1)
+	}
+
+	return sys
 }
 
 type repackOptions struct {
-	ctx            context.Context
-	cache          imgtypes.BlobInfoCache
-	imageSource    imgtypes.ImageCloser
-	rawImageSource imgtypes.ImageSource
-	imageName      string
-	layerOutputDir string
+	ctx                context.Context
+	cache              imgtypes.BlobInfoCache
+	imageSource        imgtypes.ImageCloser
+	rawImageSource     imgtypes.ImageSource
+	imageName          string
+	layerOutputDir     string
+	generateSBOM       bool
+	flattenWhiteouts   bool
+	baseLayerCount     int                            // Number of layers at the start of the image from the base image, which are not repacked
+	excludedLayers     map[int]bool                   // Numbers of the layers, starting at 1, that are not repacked
+	maxLayerSize       int64                          // Lambda layer files larger than this are split, unless zero
+	separateExtensions bool                           // Move the files under /opt/extensions into a dedicated Lambda layer
+	bundleLibraries    bool                           // Bundle the libraries of the image that repacked ELF files need into a Lambda layer
+	environment        *environment.Manifest          // Files that the execution environment provides are not repacked, unless nil
+	keepFiles          []string                       // Patterns of files that are repacked even if the execution environment provides them
+	runtime            string                         // Runtime of the function, whose module directories are pruned
+	imagePackages      map[string]environment.Package // Packages of the selected image layers by module directory, like python/boto3
+	secrets            *secrets.Allowlist
+	secretFindings     []secrets.Finding // Set by repackImage to the findings that the allowlist does not allow
+	logger             *logging.Logger
+	progress           *progress.Reporter
+	verification       *types.SignatureVerification
+}
+
+// Files and packages found while repacking a single image layer
+type repackedLayer struct {
+	lambdaLayerCreated  bool
+	functionFileCount   int
+	layerFiles          []string
+	whiteouts           []whiteout
+	extensions          []extensionFile
+	elfFiles            []elfFile // Only set if libraries are bundled
+	prunedLayerFiles    []string  // Files not repacked into the Lambda layer because the execution environment provides them
+	prunedLayerBytes    int64
+	prunedFunction      int // Number of files not repacked into the function deployment package
+	prunedFunctionBytes int64
+	layerPackages       []sbom.Package
+	functionPackages    []sbom.Package
+	secretFindings      []secrets.Finding
+}
+
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// Reads the contents of a file of an image layer from a temporary file, which is removed when closed
+type tempFileReadCloser struct {
+	*os.File
+	source io.Closer // Reader of the image layer file, if any
+}
+
+func (t tempFileReadCloser) Close() error {
+	t.File.Close()
+	os.Remove(t.File.Name())
+	if t.source == nil {
+		return nil
+	}
+	return t.source.Close()
+}
+
+// Copies the contents of the file to a temporary file, and replaces the file's reader to read them from there,
+// so that large files can be read more than once without buffering them in memory. Returns the temporary file
+// and its size. Closing the replaced reader removes the temporary file.
+func copyToTempFile(f *archiver.File, prefix string) (*os.File, int64, error) {
+	tmp, err := ioutil.TempFile("", prefix)
+	if err != nil {
+		return nil, 0, err
+	}
+	contents := tempFileReadCloser{File: tmp, source: f.ReadCloser}
+	size, err := io.Copy(tmp, f.ReadCloser)
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		contents.Close()
+		return nil, 0, err
+	}
+	f.ReadCloser = contents
+	return tmp, size, nil
 }
 
 func repackImage(opts *repackOptions) (layers []types.LambdaLayer, function *types.LambdaDeploymentPackage, retErr error) {
 
 	layerInfos := opts.imageSource.LayerInfos()
 
-	log.Printf("Image %s has %d layers", opts.imageName, len(layerInfos))
+	opts.logger.Infof("Image %s has %d layers", opts.imageName, len(layerInfos))
 
 	// Unpack and inspect each image layer, copy relevant files to new Lambda layer or to a Lambda deployment package
 	if err := os.MkdirAll(opts.layerOutputDir, 0755); err != nil {
 		return nil, nil, err
 	}
 
+	// Archives are written to temporary files and only renamed to their destination when complete.
+	// When repacking fails or is cancelled, the files completed so far are removed too.
+	var outputs []string
+	defer func() {
+		if retErr != nil {
+			removeOutputs(outputs, opts.logger)
+		}
+	}()
+
 	function = &types.LambdaDeploymentPackage{FileCount: 0, File: filepath.Join(opts.layerOutputDir, "function.zip")}
 	functionZip, functionFile, err := startZipFile(function.File)
 	if err != nil {
@@ -109,23 +380,67 @@ func repackImage(opts *repackOptions) (layers []types.LambdaLayer, function *typ
 		if err := functionZip.Close(); err != nil {
 			retErr = errors.Wrapf(err, " (zip close error: %v)", err)
 		}
-		if err := functionFile.Close(); err != nil {
-			retErr = errors.Wrapf(err, " (file close error: %v)", err)
+		if retErr != nil {
+			functionFile.Abort()
+		} else if err := functionFile.Commit(); err != nil {
+			retErr = fmt.Errorf("writing %s: %v", function.File, err)
 		}
 	}()
 
 	lambdaLayerNum := 1
+	var contents []*layerContents
+	var elfFiles []elfFile
+	var functionPackages []sbom.Package
+	var secretFindings []secrets.Finding
+	suppressedSecrets := 0
+	prunedFiles := 0
+	var prunedBytes int64
+
+	if opts.environment != nil && len(opts.environment.Packages) > 0 {
+		if err := scanImagePackages(opts, layerInfos); err != nil {
+			return nil, function, err
+		}
+	}
+
+	for i, layerInfo := range layerInfos {
+		if err := opts.ctx.Err(); err != nil {
+			return nil, function, err
+		}
+
+		skipped := true
+		switch {
+		case i < opts.baseLayerCount:
+			opts.logger.Infof("Skipping image layer %s of the base image", string(layerInfo.Digest))
+		case opts.excludedLayers[i+1]:
+			opts.logger.Infof("Skipping image layer %d/%d %s (not selected)", i+1, len(layerInfos), string(layerInfo.Digest))
+		default:
+			skipped = false
+		}
+		if skipped {
+			// Libraries of skipped layers are still in the image
+			if opts.bundleLibraries {
+				files, err := scanLayerLibraries(opts, layerInfo, i)
+				if err != nil {
+					return nil, function, fmt.Errorf("reading libraries of image layer %s: %v", layerInfo.Digest, err)
+				}
+				elfFiles = append(elfFiles, files...)
+			}
+			continue
+		}
 
-	for _, layerInfo := range layerInfos {
 		lambdaLayerFilename := filepath.Join(opts.layerOutputDir, fmt.Sprintf("layer-%d.zip", lambdaLayerNum))
 
+		// Blob sizes are compressed sizes, so progress is counted on the blob stream before decompression
+		task := opts.progress.Start(fmt.Sprintf("Repacking image layer %d/%d", i+1, len(layerInfos)), layerInfo.Size)
+		defer task.Done()
+
 		layerStream, _, err := opts.rawImageSource.GetBlob(opts.ctx, layerInfo, opts.cache)
 		if err != nil {
 			return nil, function, err
 		}
 		defer layerStream.Close()
 
-		layerFileCreated, layerFunctionFileCount, err := repackLayer(lambdaLayerFilename, functionZip, layerStream, false)
+		repacked, err := repackLayer(lambdaLayerFilename, functionZip, task.Reader(layerStream), false, opts, task)
 		if err != nil {
 			tarErr := err
 
@@ -136,62 +451,198 @@ func repackImage(opts *repackOptions) (layers []types.LambdaLayer, function *typ
 			}
 			defer layerStream.Close()
 
-			layerFileCreated, layerFunctionFileCount, err = repackLayer(lambdaLayerFilename, functionZip, layerStream, true)
+			task.Reset()
+			repacked, err = repackLayer(lambdaLayerFilename, functionZip, task.Reader(layerStream), true, opts, task)
 			if err != nil {
 				return nil, function, fmt.Errorf("could not read layer with tar nor tar.gz: %v, %v", err, tarErr)
 			}
 		}
+		task.Done()
+
+		function.FileCount += repacked.functionFileCount
+		function.PrunedFiles += repacked.prunedFunction
+		function.PrunedBytes += repacked.prunedFunctionBytes
+		prunedFiles += len(repacked.prunedLayerFiles) + repacked.prunedFunction
+		prunedBytes += repacked.prunedLayerBytes + repacked.prunedFunctionBytes
+		for _, file := range repacked.elfFiles {
+			file.layer = i
+			elfFiles = append(elfFiles, file)
+		}
+		functionPackages = append(functionPackages, repacked.functionPackages...)
+
+		for _, finding := range repacked.secretFindings {
+			finding.LayerDigest = string(layerInfo.Digest)
+			if opts.secrets.Allows(finding) {
+				suppressedSecrets++
+			} else {
+				secretFindings = append(secretFindings, finding)
+			}
+		}
 
-		function.FileCount += layerFunctionFileCount
-
-		if layerFunctionFileCount == 0 {
-			log.Printf("Did not extract any Lambda function files from image layer %s (no relevant files found)", string(layerInfo.Digest))
+		if repacked.functionFileCount == 0 {
+			opts.logger.Infof("Did not extract any Lambda function files from image layer %s (no relevant files found)", string(layerInfo.Digest))
 		}
 
-		if layerFileCreated {
-			log.Printf("Created Lambda layer file %s from image layer %s", lambdaLayerFilename, string(layerInfo.Digest))
+		if repacked.lambdaLayerCreated {
+			opts.logger.Infof("Created Lambda layer file %s from image layer %s", lambdaLayerFilename, string(layerInfo.Digest))
+			outputs = append(outputs, lambdaLayerFilename)
 			lambdaLayerNum++
-			layers = append(layers, types.LambdaLayer{Digest: string(layerInfo.Digest), File: lambdaLayerFilename})
+			contents = append(contents, newLayerContents(string(layerInfo.Digest), lambdaLayerFilename, repacked))
 		} else {
-			log.Printf("Did not create a Lambda layer file from image layer %s (no relevant files found)", string(layerInfo.Digest))
+			opts.logger.Infof("Did not create a Lambda layer file from image layer %s (no relevant files found)", string(layerInfo.Digest))
+			contents = append(contents, newLayerContents(string(layerInfo.Digest), "", repacked))
 		}
 	}
 
-	log.Printf("Extracted %d Lambda function files for image %s", function.FileCount, opts.imageName)
+	if opts.environment != nil {
+		opts.logger.Infof("Pruned %d files (%d bytes) that the %s execution environment provides", prunedFiles, prunedBytes, opts.environment.Environment)
+	}
+
+	// Lambda layers are extracted on top of each other, so files of earlier layers that later image layers
+	// replace or delete need to be removed from the earlier Lambda layers
+	if opts.baseLayerCount > 0 {
+		for _, c := range contents {
+			for _, w := range c.whiteouts {
+				opts.logger.Warnf("Image layer %s deletes %s, which cannot be applied to the Lambda layers of the base image if they contain it", c.digest, "/"+w.target)
+			}
+		}
+	}
+
+	contents, err = resolveLayerConflicts(contents, opts.flattenWhiteouts, opts.logger)
+	if err != nil {
+		return nil, function, err
+	}
+
+	if err := checkExtensions(contents, opts.logger); err != nil {
+		return nil, function, err
+	}
+	if opts.separateExtensions {
+		extensionsFilename := filepath.Join(opts.layerOutputDir, "extensions.zip")
+		outputs = append(outputs, extensionsFilename)
+		contents, err = separateExtensions(contents, extensionsFilename, opts.logger)
+		if err != nil {
+			return nil, function, err
+		}
+	}
+
+	if opts.bundleLibraries {
+		librariesFilename := filepath.Join(opts.layerOutputDir, "libraries.zip")
+		outputs = append(outputs, librariesFilename)
+		bundled, err := bundleLibraries(opts, layerInfos, findLibraries(elfFiles, opts.logger), librariesFilename)
+		if err != nil {
+			return nil, function, fmt.Errorf("bundling libraries: %v", err)
+		}
+		if bundled != nil {
+			if bundled.digest, err = zipContentDigest(bundled.file); err != nil {
+				return nil, function, err
+			}
+			opts.logger.Infof("Bundled %d libraries of the image into Lambda layer file %s: %s", len(bundled.libraries), bundled.file, strings.Join(bundled.libraries, ", "))
+			contents = append([]*layerContents{bundled}, contents...)
+		} else {
+			opts.logger.Infof("Did not bundle any libraries of the image (no missing libraries found)")
+		}
+	}
+
+	contents, err = splitLargeLayers(contents, opts.maxLayerSize, opts.logger)
+	for _, c := range contents {
+		outputs = append(outputs, c.file)
+	}
+	if err != nil {
+		return nil, function, err
+	}
+
+	for _, c := range contents {
+		layer := types.LambdaLayer{
+			Digest:           c.digest,
+			File:             c.file,
+			Part:             c.part,
+			FlattenedDigests: c.flattenedDigests,
+			Extensions:       lambdaExtensions(c),
+			BundledLibraries: c.libraries,
+			PrunedFiles:      len(c.pruned),
+			PrunedBytes:      c.prunedBytes,
+		}
+
+		if opts.generateSBOM {
+			sbomName := strings.Replace(layer.Digest, ":", "-", -1)
+			if layer.Part > 0 {
+				sbomName += fmt.Sprintf("-part-%d", layer.Part)
+			}
+			layer.SBOMFile = filepath.Join(opts.layerOutputDir, sbomName+".cdx.json")
+			err = sbom.WriteCycloneDX(layer.SBOMFile, sbom.Subject{
+				Name:             filepath.Base(layer.File),
+				ImageName:        opts.imageName,
+				ImageLayerDigest: layer.Digest,
+			}, c.packages)
+			if err != nil {
+				return nil, function, fmt.Errorf("writing SBOM for image layer %s: %v", layer.Digest, err)
+			}
+			outputs = append(outputs, layer.SBOMFile)
+			opts.logger.Infof("Wrote SBOM %s for Lambda layer file %s (%d packages)", layer.SBOMFile, layer.File, len(sbom.Dedupe(c.packages)))
+		}
+
+		layers = append(layers, layer)
+	}
+
+	opts.logger.Infof("Extracted %d Lambda function files for image %s", function.FileCount, opts.imageName)
 	if function.FileCount > 0 {
-		log.Printf("Created Lambda function deployment package %s", function.File)
+		opts.logger.Infof("Created Lambda function deployment package %s", function.File)
+
+		if opts.generateSBOM {
+			function.SBOMFile = filepath.Join(opts.layerOutputDir, "function.cdx.json")
+			err = sbom.WriteCycloneDX(function.SBOMFile, sbom.Subject{
+				Name:      filepath.Base(function.File),
+				ImageName: opts.imageName,
+			}, functionPackages)
+			if err != nil {
+				return nil, function, fmt.Errorf("writing SBOM for function deployment package: %v", err)
+			}
+			outputs = append(outputs, function.SBOMFile)
+			opts.logger.Infof("Wrote SBOM %s for Lambda function deployment package %s (%d packages)", function.SBOMFile, function.File, len(sbom.Dedupe(functionPackages)))
+		}
+	}
+	opts.logger.Infof("Created %d Lambda layer files for image %s", len(layers), opts.imageName)
+
+	if suppressedSecrets > 0 {
+		opts.logger.Infof("Suppressed %d potential secrets matching the secrets allowlist", suppressedSecrets)
 	}
-	log.Printf("Created %d Lambda layer files for image %s", len(layers), opts.imageName)
+
+	// Publishing fails on the findings, so that dry-runs and comparisons still show the files
+	for _, finding := range secretFindings {
+		opts.logger.Warnf("Found potential secret: %s", finding)
+	}
+	opts.secretFindings = secretFindings
 
 	return layers, function, retErr
 }
 
-// Converts container image layer archive (tar) to Lambda layer archive (zip).
-// Filters files from the source and only writes a new archive if at least
-// one file in the source matches the filter (i.e. does not create empty archives).
-func repackLayer(outputFilename string, functionZip *archiver.Zip, layerContents io.Reader, isGzip bool) (lambdaLayerCreated bool, functionFileCount int, retError error) {
-	t := archiver.NewTar()
-	contentsReader := layerContents
-	var err error
-
-	if isGzip {
-		gzr, err := gzip.NewReader(layerContents)
-		if err != nil {
-			return false, 0, fmt.Errorf("could not create gzip reader for layer: %v", err)
+func removeOutputs(outputs []string, logger *logging.Logger) {
+	for _, output := range outputs {
+		if err := os.Remove(output); err == nil {
+			logger.Infof("Removed %s of the failed run", output)
+		} else if !os.IsNotExist(err) {
+			logger.Warnf("Could not remove %s of the failed run: %v", output, err)
 		}
-		defer gzr.Close()
-		contentsReader = gzr
 	}
+}
 
-	err = t.Open(contentsReader, 0)
+// Converts container image layer archive (tar) to Lambda layer archive (zip).
+// Filters files from the source and only writes a new archive if at least
+// one file in the source matches the filter (i.e. does not create empty archives).
+// Files are scanned for secrets as they are repacked, and package metadata files
+// are parsed for the SBOM if requested.
+func repackLayer(outputFilename string, functionZip *archiver.Zip, layerContents io.Reader, isGzip bool, opts *repackOptions, task *progress.Task) (result *repackedLayer, retError error) {
+	t, closeTar, err := openLayerTar(layerContents, isGzip)
 	if err != nil {
-		return false, 0, fmt.Errorf("opening layer tar: %v", err)
+		return nil, err
 	}
-	defer t.Close()
+	defer closeTar()
+
+	result = &repackedLayer{}
 
 	// Walk the files in the tar
 	var z *archiver.Zip
-	var out *os.File
+	var out *atomicfile.File
 	defer func() {
 		if z != nil {
 			if err := z.Close(); err != nil {
@@ -199,13 +650,31 @@ func repackLayer(outputFilename string, functionZip *archiver.Zip, layerContents
 			}
 		}
 		if out != nil {
-			if err := out.Close(); err != nil {
-				retError = errors.Wrapf(err, " (file close error: %v)", err)
+			if retError != nil {
+				out.Abort()
+			} else if err := out.Commit(); err != nil {
+				retError = fmt.Errorf("writing %s: %v", outputFilename, err)
 			}
 		}
 	}()
 
+	// Reader of the current file after scanning it for packages or libraries, which may read a temporary file
+	var opened io.Closer
+	defer func() {
+		if opened != nil {
+			opened.Close()
+		}
+	}()
+
 	for {
+		if opened != nil {
+			opened.Close()
+			opened = nil
+		}
+		if err := opts.ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		// Get next file in tar
 		f, err := t.Read()
 		if err == io.EOF {
@@ -213,57 +682,231 @@ func repackLayer(outputFilename string, functionZip *archiver.Zip, layerContents
 		}
 
 		if err != nil {
-			return false, 0, fmt.Errorf("opening next file in layer tar: %v", err)
+			return nil, fmt.Errorf("opening next file in layer tar: %v", err)
+		}
+
+		hdr, ok := f.Header.(*tar.Header)
+		if !ok {
+			return nil, fmt.Errorf("expected header to be *tar.Header but was %T", f.Header)
+		}
+		if w, ok := parseWhiteout(hdr.Name); ok {
+			result.whiteouts = append(result.whiteouts, w)
 		}
 
 		// Determine if this file should be repacked into a Lambda layer
-		repack, err := shouldRepackLayerFileToLambdaLayer(f)
+		repackToLayer, err := shouldRepackLayerFileToLambdaLayer(f)
+		if err != nil {
+			return nil, fmt.Errorf("filtering file in layer tar: %v", err)
+		}
+
+		// Determine if this file should be repacked into a Lambda function package
+		repackToFunction, err := shouldRepackLayerFileToLambdaFunction(f)
 		if err != nil {
-			return false, 0, fmt.Errorf("filtering file in layer tar: %v", err)
+			return nil, fmt.Errorf("filtering file in layer tar: %v", err)
 		}
-		if repack {
+
+		logRepackDecision(opts.logger, f, repackToLayer, repackToFunction, outputFilename)
+
+		if opts.environment != nil && (repackToLayer || repackToFunction) {
+			pruned, err := isEnvironmentFile(&f, hdr, opts)
+			opened = f.ReadCloser
+			if err != nil {
+				return nil, fmt.Errorf("reading %s in layer tar: %v", f.Name(), err)
+			}
+			if pruned {
+				name := path.Clean(filepath.ToSlash(hdr.Name))
+				opts.logger.Debugf("Pruning /%s, which the %s execution environment provides", name, opts.environment.Environment)
+				if repackToLayer {
+					result.prunedLayerFiles = append(result.prunedLayerFiles, name)
+					result.prunedLayerBytes += hdr.Size
+				} else {
+					result.prunedFunction++
+					result.prunedFunctionBytes += hdr.Size
+				}
+				continue
+			}
+		}
+
+		if opts.generateSBOM && (repackToLayer || repackToFunction) {
+			packages, err := detectLayerFilePackages(&f, opts.logger)
+			opened = f.ReadCloser
+			if err != nil {
+				return nil, fmt.Errorf("walking %s in layer tar: %v", f.Name(), err)
+			}
+			if repackToLayer {
+				result.layerPackages = append(result.layerPackages, packages...)
+			} else {
+				result.functionPackages = append(result.functionPackages, packages...)
+			}
+		}
+
+		if repackToLayer && isExtensionPath(path.Clean(filepath.ToSlash(hdr.Name))) {
+			extension, err := checkExtensionFile(&f, hdr)
+			if err != nil {
+				return nil, fmt.Errorf("reading %s in layer tar: %v", f.Name(), err)
+			}
+			result.extensions = append(result.extensions, *extension)
+		}
+
+		if opts.bundleLibraries {
+			file, err := scanLibraryFile(&f, hdr, repackToLayer || repackToFunction)
+			opened = f.ReadCloser
+			if err != nil {
+				return nil, fmt.Errorf("reading %s in layer tar: %v", f.Name(), err)
+			}
+			if file != nil {
+				result.elfFiles = append(result.elfFiles, *file)
+			}
+		}
+
+		var contentScanner *secrets.ContentScanner
+		if repackToLayer || repackToFunction {
+			filename, err := getLayerFileName(f)
+			if err != nil {
+				return nil, fmt.Errorf("scanning file in layer tar: %v", err)
+			}
+			result.secretFindings = append(result.secretFindings, secrets.ScanName(filename)...)
+
+			if f.Mode().IsRegular() {
+				contentScanner = secrets.NewContentScanner(filename)
+				f.ReadCloser = teeReadCloser{Reader: io.TeeReader(f.ReadCloser, contentScanner), Closer: f.ReadCloser}
+			}
+		}
+
+		if repackToLayer {
 			if z == nil {
 				z, out, err = startZipFile(outputFilename)
 				if err != nil {
-					return false, 0, fmt.Errorf("starting zip file: %v", err)
+					return nil, fmt.Errorf("starting zip file: %v", err)
 				}
 			}
 
 			err = repackLayerFile(f, z)
+			result.layerFiles = append(result.layerFiles, path.Clean(filepath.ToSlash(hdr.Name)))
 		}
 
 		if err != nil {
-			return false, 0, fmt.Errorf("walking %s in layer tar: %v", f.Name(), err)
+			return nil, fmt.Errorf("walking %s in layer tar: %v", f.Name(), err)
+		}
+
+		if repackToFunction {
+			err = repackLayerFile(f, functionZip)
+			result.functionFileCount++
 		}
 
-		// Determine if this file should be repacked into a Lambda function package
-		repack, err = shouldRepackLayerFileToLambdaFunction(f)
 		if err != nil {
-			return false, 0, fmt.Errorf("filtering file in layer tar: %v", err)
+			return nil, fmt.Errorf("walking %s in layer tar: %v", f.Name(), err)
 		}
-		if repack {
-			err = repackLayerFile(f, functionZip)
-			functionFileCount++
+
+		if repackToLayer || repackToFunction {
+			task.AddFile()
 		}
 
+		if contentScanner != nil {
+			result.secretFindings = append(result.secretFindings, contentScanner.Findings()...)
+		}
+	}
+
+	result.lambdaLayerCreated = (z != nil)
+	return result, nil
+}
+
+// Parses package metadata from the file for the SBOM. The file contents are buffered in memory,
+// or in a temporary file for Java archives, so the file's reader is replaced to allow repacking it afterwards.
+func detectLayerFilePackages(f *archiver.File, logger *logging.Logger) ([]sbom.Package, error) {
+	hdr, ok := f.Header.(*tar.Header)
+	if !ok {
+		return nil, fmt.Errorf("expected header to be *tar.Header but was %T", f.Header)
+	}
+
+	if !f.Mode().IsRegular() {
+		return nil, nil
+	}
+	if sbom.IsJar(hdr.Name) {
+		return detectJarPackages(f, hdr.Name, logger)
+	}
+	if sbom.IsRPMDatabase(hdr.Name) {
+		logger.Warnf("RPM database %s is not read, so its packages are not listed in the SBOM", hdr.Name)
+		return nil, nil
+	}
+	if hdr.Size > sbom.MaxMetadataFileSize || !sbom.IsMetadataFile(hdr.Name) {
+		return nil, nil
+	}
+
+	contents, err := ioutil.ReadAll(f.ReadCloser)
+	if err != nil {
+		return nil, err
+	}
+	f.ReadCloser = ioutil.NopCloser(bytes.NewReader(contents))
+
+	packages, err := sbom.Parse(hdr.Name, contents)
+	if err != nil {
+		// Unparseable metadata should not prevent the image from being converted
+		logger.Warnf("Could not detect packages for the SBOM: %v", err)
+		return nil, nil
+	}
+	return packages, nil
+}
+
+// Parses the Maven metadata of a Java archive, which can be large, from a temporary copy of it
+func detectJarPackages(f *archiver.File, filename string, logger *logging.Logger) ([]sbom.Package, error) {
+	tmp, size, err := copyToTempFile(f, "img2lambda-jar-")
+	if err != nil {
+		return nil, err
+	}
+
+	packages, err := sbom.ParseJar(filename, tmp, size)
+	if err != nil {
+		logger.Warnf("Could not detect packages for the SBOM: %v", err)
+		return nil, nil
+	}
+	return packages, nil
+}
+
+// Opens the container image layer archive for reading. The returned function
+// closes the archive and its gzip reader.
+func openLayerTar(layerContents io.Reader, isGzip bool) (*archiver.Tar, func(), error) {
+	t := archiver.NewTar()
+	contentsReader := layerContents
+	var gzr *gzip.Reader
+
+	if isGzip {
+		var err error
+		gzr, err = gzip.NewReader(layerContents)
 		if err != nil {
-			return false, 0, fmt.Errorf("walking %s in layer tar: %v", f.Name(), err)
+			return nil, nil, fmt.Errorf("could not create gzip reader for layer: %v", err)
 		}
+		contentsReader = gzr
 	}
 
-	return (z != nil), functionFileCount, nil
+	closeTar := func() {
+		t.Close()
+		if gzr != nil {
+			gzr.Close()
+		}
+	}
+
+	err := t.Open(contentsReader, 0)
+	if err != nil {
+		closeTar()
+		return nil, nil, fmt.Errorf("opening layer tar: %v", err)
+	}
+
+	return t, closeTar, nil
 }
 
-func startZipFile(destination string) (zip *archiver.Zip, zipFile *os.File, err error) {
+// Starts writing a zip archive to a temporary file, which the caller must commit or abort
+func startZipFile(destination string) (zip *archiver.Zip, zipFile *atomicfile.File, err error) {
 	z := archiver.NewZip()
 
-	out, err := os.Create(destination)
+	out, err := atomicfile.Create(destination, 0644)
 	if err != nil {
 		return nil, nil, fmt.Errorf("creating %s: %v", destination, err)
 	}
 
 	err = z.Create(out)
 	if err != nil {
+		out.Abort()
 		return nil, nil, fmt.Errorf("creating zip: %v", err)
 	}
 
@@ -288,6 +931,24 @@ func getLayerFileName(f archiver.File) (name string, err error) {
 	return header.Name, nil
 }
 
+// Logs why the file is or is not repacked, to help debug the filters
+func logRepackDecision(logger *logging.Logger, f archiver.File, repackToLayer bool, repackToFunction bool, layerFilename string) {
+	hdr := f.Header.(*tar.Header)
+
+	switch {
+	case repackToLayer:
+		logger.Debugf("Repacking %s into Lambda layer file %s (file under /opt)", hdr.Name, layerFilename)
+	case repackToFunction:
+		logger.Debugf("Repacking %s into the Lambda function deployment package (file under /var/task)", hdr.Name)
+	case f.IsDir() || hdr.Typeflag == tar.TypeDir:
+		logger.Debugf("Skipping %s (directory)", hdr.Name)
+	case strings.HasPrefix(f.Name(), ".wh."):
+		logger.Debugf("Skipping %s (whiteout file)", hdr.Name)
+	default:
+		logger.Debugf("Skipping %s (not under /opt or /var/task)", hdr.Name)
+	}
+}
+
 func shouldRepackLayerFileToLambdaLayer(f archiver.File) (should bool, err error) {
 	filename, err := getLayerFileName(f)
 	if err != nil {
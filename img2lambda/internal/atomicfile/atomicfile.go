@@ -0,0 +1,77 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package atomicfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// File written to a temporary file next to its destination, and renamed to its destination
+// when committed, so that the destination never holds a partially written file
+type File struct {
+	*os.File
+	destination string
+	done        bool
+}
+
+func Create(destination string, perm os.FileMode) (*File, error) {
+	f, err := ioutil.TempFile(filepath.Dir(destination), "."+filepath.Base(destination)+".tmp-")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+
+	return &File{File: f, destination: destination}, nil
+}
+
+// Closes the file and renames it to its destination
+func (f *File) Commit() error {
+	if f.done {
+		return nil
+	}
+	f.done = true
+
+	if err := f.File.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := os.Rename(f.Name(), f.destination); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// Closes and removes the temporary file, unless the file was already committed
+func (f *File) Abort() {
+	if f.done {
+		return
+	}
+	f.done = true
+
+	f.File.Close()
+	os.Remove(f.Name())
+}
+
+// Like ioutil.WriteFile, but the file is either fully written or not written at all
+func WriteFile(filename string, data []byte, perm os.FileMode) error {
+	f, err := Create(filename, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Abort()
+		return err
+	}
+
+	return f.Commit()
+}
@@ -0,0 +1,87 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package atomicfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	destination := filepath.Join(dir, "layer-1.zip")
+	f, err := Create(destination, 0644)
+	assert.Nil(t, err)
+
+	_, err = f.Write([]byte("hello world"))
+	assert.Nil(t, err)
+
+	// Nothing is written to the destination until the file is committed
+	_, err = os.Stat(destination)
+	assert.True(t, os.IsNotExist(err))
+
+	err = f.Commit()
+	assert.Nil(t, err)
+	f.Abort()
+
+	contents, err := ioutil.ReadFile(destination)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello world", string(contents))
+
+	info, err := os.Stat(destination)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestAbort(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	destination := filepath.Join(dir, "function.zip")
+	err = ioutil.WriteFile(destination, []byte("previous run"), 0644)
+	assert.Nil(t, err)
+
+	f, err := Create(destination, 0644)
+	assert.Nil(t, err)
+	_, err = f.Write([]byte("partial"))
+	assert.Nil(t, err)
+	f.Abort()
+
+	// The temporary file is removed and the existing file is left alone
+	contents, err := ioutil.ReadFile(destination)
+	assert.Nil(t, err)
+	assert.Equal(t, "previous run", string(contents))
+
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	destination := filepath.Join(dir, "report.json")
+	err = WriteFile(destination, []byte("{}"), 0644)
+	assert.Nil(t, err)
+
+	contents, err := ioutil.ReadFile(destination)
+	assert.Nil(t, err)
+	assert.Equal(t, "{}", string(contents))
+
+	err = WriteFile(filepath.Join(dir, "missing", "report.json"), []byte("{}"), 0644)
+	assert.Error(t, err)
+}
@@ -4,3 +4,5 @@ package testing
 
 //go:generate mockgen.sh github.com/aws/aws-sdk-go/service/lambda/lambdaiface LambdaAPI mocks/lambda_mocks.go
 //go:generate mockgen.sh github.com/containers/image/v5/types ImageCloser,ImageSource mocks/image_mocks.go
+//go:generate mockgen.sh github.com/aws/aws-sdk-go/service/signer/signeriface SignerAPI mocks/signer_mocks.go
+//go:generate mockgen.sh github.com/aws/aws-sdk-go/service/s3/s3iface S3API mocks/s3_mocks.go
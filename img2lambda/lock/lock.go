@@ -0,0 +1,201 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+// Package lock pins an image to the Lambda layer versions published from it in img2lambda.lock,
+// and detects when the image or the layer versions no longer match the lock.
+package lock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/extract"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/internal/atomicfile"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/logging"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/version"
+)
+
+// Name of the lock file in the output directory
+const FileName = "img2lambda.lock"
+
+// Locks the layer versions published from the image
+func New(image *types.RepackedImage, sourceImageName string, published *types.PublishedLayers) (*types.Lock, error) {
+	lock := &types.Lock{
+		ToolVersion:    version.Version,
+		Image:          sourceImageName,
+		ImageReference: image.Name,
+		ManifestDigest: image.ManifestDigest,
+		Layers:         []types.LockedLayer{},
+	}
+	for _, layer := range published.Layers {
+		region, err := arnRegion(layer.Arn)
+		if err != nil {
+			return nil, err
+		}
+		lock.Layers = append(lock.Layers, types.LockedLayer{
+			ImageLayerDigest: layer.Layer.Digest,
+			Part:             layer.Layer.Part,
+			Versions: map[string]types.LockedLayerVersion{
+				region: {Arn: layer.Arn, CodeSha256: layer.CodeSha256, CodeSize: layer.CodeSize},
+			},
+		})
+	}
+	return lock, nil
+}
+
+// Region of a layer version ARN, like arn:aws:lambda:us-east-1:123456789012:layer:my-layer:1
+func arnRegion(arn string) (string, error) {
+	fields := strings.Split(arn, ":")
+	if len(fields) != 8 || fields[0] != "arn" || fields[2] != "lambda" || fields[5] != "layer" || fields[3] == "" {
+		return "", fmt.Errorf("%q is not a layer version ARN", arn)
+	}
+	return fields[3], nil
+}
+
+func Read(filename string) (*types.Lock, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	lock := &types.Lock{}
+	if err := json.Unmarshal(contents, lock); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", filename, err)
+	}
+	return lock, nil
+}
+
+// Writes the lock to img2lambda.lock in the directory. If the directory has a lock of the same image and
+// image layers already, the layer versions of the other regions are kept, so that publishing an image to
+// several regions results in a lock of all of them. Locks of other images are replaced.
+func Write(dir string, lock *types.Lock, logger *logging.Logger) (string, error) {
+	lockPath := filepath.Join(dir, FileName)
+
+	existing, err := Read(lockPath)
+	switch {
+	case err == nil && sameLayers(existing, lock):
+		for i, layer := range lock.Layers {
+			for region, version := range existing.Layers[i].Versions {
+				if _, ok := layer.Versions[region]; !ok {
+					layer.Versions[region] = version
+				}
+			}
+		}
+	case err == nil:
+		logger.Infof("Replacing %s, which locks image manifest digest %s", lockPath, existing.ManifestDigest)
+	case !os.IsNotExist(err):
+		return "", err
+	}
+
+	contents, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := atomicfile.WriteFile(lockPath, contents, 0644); err != nil {
+		return "", err
+	}
+	return lockPath, nil
+}
+
+func sameLayers(a *types.Lock, b *types.Lock) bool {
+	if a.ManifestDigest != b.ManifestDigest || len(a.Layers) != len(b.Layers) {
+		return false
+	}
+	for i := range a.Layers {
+		if a.Layers[i].ImageLayerDigest != b.Layers[i].ImageLayerDigest || a.Layers[i].Part != b.Layers[i].Part {
+			return false
+		}
+	}
+	return true
+}
+
+// Checks that the image still has the locked manifest digest, and that every locked layer version
+// still exists with the locked CodeSha256. Returns the differences, which are empty if the lock matches.
+func Verify(ctx context.Context, lock *types.Lock, imageName string, opts *types.LockVerifyOptions) ([]types.LockDrift, error) {
+	if opts.LambdaClients == nil {
+		return nil, errors.New("Lambda clients are required to verify the layer versions")
+	}
+
+	var drift []types.LockDrift
+	manifestDigest, err := extract.ImageManifestDigest(ctx, imageName, &types.ExtractOptions{
+		SystemContext: opts.SystemContext,
+		Signatures:    opts.Signatures,
+		Logger:        opts.Logger,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if manifestDigest != lock.ManifestDigest {
+		drift = append(drift, types.LockDrift{
+			Message: fmt.Sprintf("image %s has manifest digest %s, but manifest digest %s is locked", imageName, manifestDigest, lock.ManifestDigest),
+		})
+	}
+
+	count := 0
+	for _, layer := range lock.Layers {
+		var regions []string
+		for region := range layer.Versions {
+			regions = append(regions, region)
+		}
+		sort.Strings(regions)
+
+		for _, region := range regions {
+			locked := layer.Versions[region]
+			message, err := checkLayerVersion(ctx, opts.LambdaClients(region), locked)
+			if err != nil {
+				return nil, fmt.Errorf("getting layer version %s: %v", locked.Arn, err)
+			}
+			if message != "" {
+				drift = append(drift, types.LockDrift{ImageLayerDigest: layer.ImageLayerDigest, Arn: locked.Arn, Message: message})
+			}
+			count++
+		}
+	}
+
+	opts.Logger.Infof("Checked image %s and %d locked layer versions", imageName, count)
+	return drift, nil
+}
+
+// Describes how the published layer version differs from the locked one, or returns an empty message if it does not
+func checkLayerVersion(ctx context.Context, client lambdaiface.LambdaAPI, locked types.LockedLayerVersion) (string, error) {
+	i := strings.LastIndex(locked.Arn, ":")
+	if _, err := arnRegion(locked.Arn); err != nil {
+		return "", err
+	}
+	versionNumber, err := strconv.ParseInt(locked.Arn[i+1:], 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("%q is not a layer version ARN", locked.Arn)
+	}
+
+	resp, err := client.GetLayerVersionWithContext(ctx, &lambda.GetLayerVersionInput{
+		LayerName:     aws.String(locked.Arn[:i]),
+		VersionNumber: aws.Int64(versionNumber),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == lambda.ErrCodeResourceNotFoundException {
+		return "layer version does not exist", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var codeSha256 string
+	if resp.Content != nil {
+		codeSha256 = aws.StringValue(resp.Content.CodeSha256)
+	}
+	if codeSha256 != locked.CodeSha256 {
+		return fmt.Sprintf("layer version has CodeSha256 %s, but %s is locked", codeSha256, locked.CodeSha256), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package lock
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/internal/testing/mocks"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testImage          = "oci-archive:../converter/testdata/oci-image.tar"
+	testManifestDigest = "sha256:bfc30393df02b201127353d1c1ccb8507a9a2482cda6815620d27553abd2704a"
+)
+
+func publishedLayers(arns ...string) *types.PublishedLayers {
+	published := &types.PublishedLayers{}
+	for i, arn := range arns {
+		published.Layers = append(published.Layers, types.PublishedLayer{
+			Layer:      types.LambdaLayer{Digest: []string{"sha256:1", "sha256:2"}[i]},
+			Arn:        arn,
+			CodeSha256: []string{"hash1", "hash2"}[i],
+			CodeSize:   int64(i + 1),
+		})
+	}
+	return published
+}
+
+func TestWriteMergesRegions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	image := &types.RepackedImage{Name: "docker-daemon:my-image:latest", ManifestDigest: "sha256:abc"}
+	east, err := New(image, "my-image", publishedLayers(
+		"arn:aws:lambda:us-east-1:123456789012:layer:one:1",
+		"arn:aws:lambda:us-east-1:123456789012:layer:two:1",
+	))
+	require.NoError(t, err)
+	lockPath, err := Write(dir, east, nil)
+	require.NoError(t, err)
+
+	west, err := New(image, "my-image", publishedLayers(
+		"arn:aws:lambda:us-west-2:123456789012:layer:one:3",
+		"arn:aws:lambda:us-west-2:123456789012:layer:two:3",
+	))
+	require.NoError(t, err)
+	_, err = Write(dir, west, nil)
+	require.NoError(t, err)
+
+	lock, err := Read(lockPath)
+	require.NoError(t, err)
+	assert.Equal(t, "my-image", lock.Image)
+	assert.Equal(t, "docker-daemon:my-image:latest", lock.ImageReference)
+	assert.Equal(t, "sha256:abc", lock.ManifestDigest)
+	require.Len(t, lock.Layers, 2)
+	assert.Equal(t, "sha256:2", lock.Layers[1].ImageLayerDigest)
+	assert.Equal(t, map[string]types.LockedLayerVersion{
+		"us-east-1": {Arn: "arn:aws:lambda:us-east-1:123456789012:layer:two:1", CodeSha256: "hash2", CodeSize: 2},
+		"us-west-2": {Arn: "arn:aws:lambda:us-west-2:123456789012:layer:two:3", CodeSha256: "hash2", CodeSize: 2},
+	}, lock.Layers[1].Versions)
+
+	// Another image replaces the lock
+	changed, err := New(&types.RepackedImage{Name: "docker-daemon:my-image:latest", ManifestDigest: "sha256:def"}, "my-image", publishedLayers(
+		"arn:aws:lambda:us-west-2:123456789012:layer:one:4",
+	))
+	require.NoError(t, err)
+	_, err = Write(dir, changed, nil)
+	require.NoError(t, err)
+
+	lock, err = Read(lockPath)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:def", lock.ManifestDigest)
+	require.Len(t, lock.Layers, 1)
+	assert.Len(t, lock.Layers[0].Versions, 1)
+}
+
+func TestNewRejectsInvalidArn(t *testing.T) {
+	_, err := New(&types.RepackedImage{}, "my-image", publishedLayers("my-layer:1"))
+	assert.Error(t, err)
+}
+
+func TestVerify(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	east := mocks.NewMockLambdaAPI(ctrl)
+	west := mocks.NewMockLambdaAPI(ctrl)
+	east.EXPECT().
+		GetLayerVersionWithContext(gomock.Any(), gomock.Eq(&lambda.GetLayerVersionInput{
+			LayerName:     aws.String("arn:aws:lambda:us-east-1:123456789012:layer:one"),
+			VersionNumber: aws.Int64(1),
+		})).
+		Return(&lambda.GetLayerVersionOutput{Content: &lambda.LayerVersionContentOutput{CodeSha256: aws.String("hash1")}}, nil)
+	east.EXPECT().
+		GetLayerVersionWithContext(gomock.Any(), gomock.Eq(&lambda.GetLayerVersionInput{
+			LayerName:     aws.String("arn:aws:lambda:us-east-1:123456789012:layer:two"),
+			VersionNumber: aws.Int64(1),
+		})).
+		Return(nil, awserr.New(lambda.ErrCodeResourceNotFoundException, "not found", nil))
+	west.EXPECT().
+		GetLayerVersionWithContext(gomock.Any(), gomock.Any()).
+		Return(&lambda.GetLayerVersionOutput{Content: &lambda.LayerVersionContentOutput{CodeSha256: aws.String("other")}}, nil)
+
+	lock := &types.Lock{
+		ManifestDigest: testManifestDigest,
+		Layers: []types.LockedLayer{
+			{ImageLayerDigest: "sha256:1", Versions: map[string]types.LockedLayerVersion{
+				"us-east-1": {Arn: "arn:aws:lambda:us-east-1:123456789012:layer:one:1", CodeSha256: "hash1"},
+				"us-west-2": {Arn: "arn:aws:lambda:us-west-2:123456789012:layer:one:3", CodeSha256: "hash1"},
+			}},
+			{ImageLayerDigest: "sha256:2", Versions: map[string]types.LockedLayerVersion{
+				"us-east-1": {Arn: "arn:aws:lambda:us-east-1:123456789012:layer:two:1", CodeSha256: "hash2"},
+			}},
+		},
+	}
+	opts := &types.LockVerifyOptions{
+		LambdaClients: func(region string) lambdaiface.LambdaAPI {
+			if region == "us-west-2" {
+				return west
+			}
+			return east
+		},
+	}
+
+	drift, err := Verify(context.Background(), lock, testImage, opts)
+	require.NoError(t, err)
+	assert.Equal(t, []types.LockDrift{
+		{ImageLayerDigest: "sha256:1", Arn: "arn:aws:lambda:us-west-2:123456789012:layer:one:3", Message: "layer version has CodeSha256 other, but hash1 is locked"},
+		{ImageLayerDigest: "sha256:2", Arn: "arn:aws:lambda:us-east-1:123456789012:layer:two:1", Message: "layer version does not exist"},
+	}, drift)
+}
+
+func TestVerifyImageDigest(t *testing.T) {
+	lock := &types.Lock{ManifestDigest: "sha256:abc", Layers: []types.LockedLayer{}}
+	drift, err := Verify(context.Background(), lock, testImage, &types.LockVerifyOptions{
+		LambdaClients: func(region string) lambdaiface.LambdaAPI { return nil },
+	})
+	require.NoError(t, err)
+	require.Len(t, drift, 1)
+	assert.Contains(t, drift[0].Message, "has manifest digest "+testManifestDigest)
+
+	lock.ManifestDigest = testManifestDigest
+	drift, err = Verify(context.Background(), lock, testImage, &types.LockVerifyOptions{
+		LambdaClients: func(region string) lambdaiface.LambdaAPI { return nil },
+	})
+	require.NoError(t, err)
+	assert.Empty(t, drift)
+}
@@ -0,0 +1,133 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// Valid log output formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Leveled logger writing either plain text lines (like the standard library's log package)
+// or JSON objects. A nil *Logger logs text at info level to stderr.
+type Logger struct {
+	mu     sync.Mutex
+	out    io.Writer
+	level  Level
+	format string
+	now    func() time.Time
+}
+
+var defaultLogger = New(os.Stderr, LevelInfo, FormatText)
+
+func New(out io.Writer, level Level, format string) *Logger {
+	return &Logger{out: out, level: level, format: format, now: time.Now}
+}
+
+// Logger for the given log options: quiet only logs warnings and errors, verbose logs debug messages too
+func NewFromOptions(format string, quiet bool, verbose bool) (*Logger, error) {
+	if format != FormatText && format != FormatJSON {
+		return nil, fmt.Errorf("log format must be one of '%s', '%s'", FormatText, FormatJSON)
+	}
+	if quiet && verbose {
+		return nil, fmt.Errorf("quiet and verbose options cannot be used together")
+	}
+
+	level := LevelInfo
+	if quiet {
+		level = LevelWarn
+	} else if verbose {
+		level = LevelDebug
+	}
+
+	return New(os.Stderr, level, format), nil
+}
+
+func (l *Logger) Debugf(format string, v ...interface{}) {
+	l.logf(LevelDebug, format, v...)
+}
+
+func (l *Logger) Infof(format string, v ...interface{}) {
+	l.logf(LevelInfo, format, v...)
+}
+
+func (l *Logger) Warnf(format string, v ...interface{}) {
+	l.logf(LevelWarn, format, v...)
+}
+
+func (l *Logger) Errorf(format string, v ...interface{}) {
+	l.logf(LevelError, format, v...)
+}
+
+func (l *Logger) logf(level Level, format string, v ...interface{}) {
+	if l == nil {
+		l = defaultLogger
+	}
+	if level < l.level {
+		return
+	}
+
+	msg := fmt.Sprintf(format, v...)
+	timestamp := l.now()
+
+	var line []byte
+	if l.format == FormatJSON {
+		entry := struct {
+			Time    string `json:"time"`
+			Level   string `json:"level"`
+			Message string `json:"msg"`
+		}{
+			Time:    timestamp.UTC().Format(time.RFC3339Nano),
+			Level:   level.String(),
+			Message: msg,
+		}
+		var err error
+		line, err = json.Marshal(entry)
+		if err != nil {
+			return
+		}
+		line = append(line, '\n')
+	} else {
+		prefix := ""
+		if level != LevelInfo {
+			prefix = strings.ToUpper(level.String()) + ": "
+		}
+		line = []byte(timestamp.Format("2006/01/02 15:04:05") + " " + prefix + strings.TrimSuffix(msg, "\n") + "\n")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(line)
+}
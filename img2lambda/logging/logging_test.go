@@ -0,0 +1,80 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package logging
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLogger(out *bytes.Buffer, level Level, format string) *Logger {
+	logger := New(out, level, format)
+	logger.now = func() time.Time {
+		return time.Date(2019, 6, 1, 12, 30, 0, 0, time.UTC)
+	}
+	return logger
+}
+
+func TestTextFormat(t *testing.T) {
+	var out bytes.Buffer
+	logger := newTestLogger(&out, LevelInfo, FormatText)
+
+	logger.Debugf("hidden")
+	logger.Infof("Published layer %d", 1)
+	logger.Warnf("careful\n")
+	logger.Errorf("failed")
+
+	assert.Equal(t, "2019/06/01 12:30:00 Published layer 1\n"+
+		"2019/06/01 12:30:00 WARN: careful\n"+
+		"2019/06/01 12:30:00 ERROR: failed\n", out.String())
+}
+
+func TestJSONFormat(t *testing.T) {
+	var out bytes.Buffer
+	logger := newTestLogger(&out, LevelDebug, FormatJSON)
+
+	logger.Debugf("file %s", "opt/bin/php")
+	logger.Infof("done")
+
+	assert.Equal(t, `{"time":"2019-06-01T12:30:00Z","level":"debug","msg":"file opt/bin/php"}`+"\n"+
+		`{"time":"2019-06-01T12:30:00Z","level":"info","msg":"done"}`+"\n", out.String())
+}
+
+func TestQuietLevel(t *testing.T) {
+	var out bytes.Buffer
+	logger := newTestLogger(&out, LevelWarn, FormatText)
+
+	logger.Infof("hidden")
+	logger.Warnf("shown")
+
+	assert.Equal(t, "2019/06/01 12:30:00 WARN: shown\n", out.String())
+}
+
+func TestNewFromOptions(t *testing.T) {
+	logger, err := NewFromOptions(FormatText, false, false)
+	assert.Nil(t, err)
+	assert.Equal(t, LevelInfo, logger.level)
+
+	logger, err = NewFromOptions(FormatJSON, true, false)
+	assert.Nil(t, err)
+	assert.Equal(t, LevelWarn, logger.level)
+	assert.Equal(t, FormatJSON, logger.format)
+
+	logger, err = NewFromOptions(FormatText, false, true)
+	assert.Nil(t, err)
+	assert.Equal(t, LevelDebug, logger.level)
+
+	_, err = NewFromOptions("xml", false, false)
+	assert.Error(t, err)
+
+	_, err = NewFromOptions(FormatText, true, true)
+	assert.Error(t, err)
+}
+
+func TestNilLogger(t *testing.T) {
+	var logger *Logger
+	assert.NotPanics(t, func() { logger.Debugf("ignored") })
+}
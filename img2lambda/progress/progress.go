@@ -0,0 +1,211 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/logging"
+)
+
+const (
+	barWidth = 30
+
+	// How often progress is redrawn on a terminal, or logged otherwise
+	terminalInterval = 100 * time.Millisecond
+	logInterval      = 10 * time.Second
+)
+
+// Reports the progress of long-running tasks like downloading image layers and uploading Lambda layers.
+// On an interactive terminal, progress is drawn as a progress bar. Otherwise, progress is logged periodically.
+// A nil *Reporter does not report anything.
+type Reporter struct {
+	mu       sync.Mutex
+	logger   *logging.Logger
+	terminal io.Writer
+	interval time.Duration
+	now      func() time.Time
+}
+
+// Reporter drawing progress bars to the given terminal, or logging progress if terminal is nil
+func New(logger *logging.Logger, terminal io.Writer) *Reporter {
+	interval := logInterval
+	if terminal != nil {
+		interval = terminalInterval
+	}
+	return &Reporter{logger: logger, terminal: terminal, interval: interval, now: time.Now}
+}
+
+// Whether the given file is an interactive terminal
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// Progress of one task, in bytes processed out of an expected total and files processed.
+// A total of zero or less means the size of the task is unknown.
+// A nil *Task ignores all updates.
+type Task struct {
+	reporter    *Reporter
+	description string
+	total       int64
+	bytes       int64
+	files       int
+	started     time.Time
+	lastReport  time.Time
+	done        bool
+}
+
+func (r *Reporter) Start(description string, total int64) *Task {
+	if r == nil {
+		return nil
+	}
+
+	now := r.now()
+	task := &Task{reporter: r, description: description, total: total, started: now, lastReport: now}
+	if r.terminal != nil {
+		r.mu.Lock()
+		task.draw()
+		r.mu.Unlock()
+	}
+	return task
+}
+
+func (t *Task) AddBytes(n int64) {
+	if t == nil {
+		return
+	}
+	t.reporter.mu.Lock()
+	defer t.reporter.mu.Unlock()
+	t.bytes += n
+	t.update()
+}
+
+func (t *Task) AddFile() {
+	if t == nil {
+		return
+	}
+	t.reporter.mu.Lock()
+	defer t.reporter.mu.Unlock()
+	t.files++
+	t.update()
+}
+
+// Starts counting from zero again, for example when a download is retried
+func (t *Task) Reset() {
+	if t == nil {
+		return
+	}
+	t.reporter.mu.Lock()
+	defer t.reporter.mu.Unlock()
+	t.bytes = 0
+	t.files = 0
+}
+
+func (t *Task) Done() {
+	if t == nil {
+		return
+	}
+	t.reporter.mu.Lock()
+	defer t.reporter.mu.Unlock()
+	if t.done {
+		return
+	}
+	t.done = true
+
+	if t.reporter.terminal != nil {
+		t.draw()
+		fmt.Fprint(t.reporter.terminal, "\n")
+	} else if t.reporter.now().Sub(t.started) >= t.reporter.interval {
+		// Only log completion of tasks that were slow enough to log progress along the way
+		t.reporter.logger.Infof("%s: %s", t.description, t.status())
+	}
+}
+
+// Reader counting the bytes read from r towards this task
+func (t *Task) Reader(r io.ReadCloser) io.ReadCloser {
+	if t == nil {
+		return r
+	}
+	return &countingReader{ReadCloser: r, task: t}
+}
+
+type countingReader struct {
+	io.ReadCloser
+	task *Task
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.task.AddBytes(int64(n))
+	return n, err
+}
+
+// Reports progress if the reporting interval has passed; the reporter lock must be held
+func (t *Task) update() {
+	if t.done {
+		return
+	}
+	now := t.reporter.now()
+	if now.Sub(t.lastReport) < t.reporter.interval {
+		return
+	}
+	t.lastReport = now
+
+	if t.reporter.terminal != nil {
+		t.draw()
+	} else {
+		t.reporter.logger.Infof("%s: %s", t.description, t.status())
+	}
+}
+
+func (t *Task) draw() {
+	bar := strings.Repeat(" ", barWidth)
+	if t.total > 0 {
+		filled := int(float64(barWidth) * float64(min(t.bytes, t.total)) / float64(t.total))
+		bar = strings.Repeat("=", filled) + strings.Repeat(" ", barWidth-filled)
+	}
+	fmt.Fprintf(t.reporter.terminal, "\r\033[K%s [%s] %s", t.description, bar, t.status())
+}
+
+func (t *Task) status() string {
+	var status string
+	if t.total > 0 {
+		status = fmt.Sprintf("%s / %s (%d%%)", FormatBytes(t.bytes), FormatBytes(t.total), 100*min(t.bytes, t.total)/t.total)
+	} else {
+		status = FormatBytes(t.bytes)
+	}
+	if t.files > 0 {
+		status += fmt.Sprintf(", %d files", t.files)
+	}
+	return status
+}
+
+func min(a int64, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Formats a byte count for humans, for example 1.5 MiB
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
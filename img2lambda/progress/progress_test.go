@@ -0,0 +1,112 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package progress
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func TestLogProgress(t *testing.T) {
+	var out bytes.Buffer
+	logger := logging.New(&out, logging.LevelInfo, logging.FormatJSON)
+	clock := &fakeClock{now: time.Date(2019, 6, 1, 12, 30, 0, 0, time.UTC)}
+
+	reporter := New(logger, nil)
+	reporter.now = clock.Now
+
+	task := reporter.Start("Repacking image layer 1/2", 4*1024*1024)
+	task.AddBytes(1024 * 1024)
+	assert.Empty(t, out.String())
+
+	task.AddFile()
+	clock.Advance(logInterval)
+	task.AddBytes(1024 * 1024)
+	assert.Contains(t, out.String(), "Repacking image layer 1/2: 2.0 MiB / 4.0 MiB (50%), 1 files")
+
+	out.Reset()
+	task.AddBytes(2 * 1024 * 1024)
+	task.Done()
+	assert.Contains(t, out.String(), "Repacking image layer 1/2: 4.0 MiB / 4.0 MiB (100%), 1 files")
+}
+
+func TestFastTaskIsNotLogged(t *testing.T) {
+	var out bytes.Buffer
+	logger := logging.New(&out, logging.LevelInfo, logging.FormatText)
+
+	task := New(logger, nil).Start("Uploading Lambda layer 1/1", 100)
+	task.AddBytes(100)
+	task.Done()
+
+	assert.Empty(t, out.String())
+}
+
+func TestTerminalProgressBar(t *testing.T) {
+	var terminal bytes.Buffer
+	clock := &fakeClock{now: time.Date(2019, 6, 1, 12, 30, 0, 0, time.UTC)}
+
+	reporter := New(nil, &terminal)
+	reporter.now = clock.Now
+
+	task := reporter.Start("Uploading Lambda layer 1/1", 2048)
+	r := task.Reader(ioutil.NopCloser(strings.NewReader(strings.Repeat("x", 1024))))
+	_, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	task.Done()
+
+	lines := strings.Split(terminal.String(), "\r\033[K")
+	assert.Len(t, lines, 3)
+	assert.Equal(t, "Uploading Lambda layer 1/1 ["+strings.Repeat(" ", 30)+"] 0 B / 2.0 KiB (0%)", lines[1])
+	assert.Equal(t, "Uploading Lambda layer 1/1 ["+strings.Repeat("=", 15)+strings.Repeat(" ", 15)+"] 1.0 KiB / 2.0 KiB (50%)\n", lines[2])
+}
+
+func TestUnknownTotal(t *testing.T) {
+	var terminal bytes.Buffer
+	task := New(nil, &terminal).Start("Repacking image layer 1/1", -1)
+	task.AddBytes(10)
+	task.Reset()
+	task.AddBytes(5)
+	task.Done()
+
+	assert.True(t, strings.HasSuffix(terminal.String(), "] 5 B\n"))
+}
+
+func TestNilReporter(t *testing.T) {
+	var reporter *Reporter
+	task := reporter.Start("ignored", 10)
+	assert.Nil(t, task)
+
+	r := ioutil.NopCloser(strings.NewReader("abc"))
+	assert.Equal(t, r, task.Reader(r))
+	assert.NotPanics(t, func() {
+		task.AddBytes(1)
+		task.AddFile()
+		task.Reset()
+		task.Done()
+	})
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512 B", FormatBytes(512))
+	assert.Equal(t, "1.5 KiB", FormatBytes(1536))
+	assert.Equal(t, "250.0 MiB", FormatBytes(250*1024*1024))
+	assert.Equal(t, "1.0 GiB", FormatBytes(1024*1024*1024))
+}
@@ -3,38 +3,80 @@
 package publish
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
-	"log"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	yaml "gopkg.in/yaml.v2"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/lambda"
 	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/internal/atomicfile"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/progress"
 	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/version"
 )
 
-func PublishLambdaLayers(opts *types.PublishOptions, layers []types.LambdaLayer) (string, string, error) {
+// Publishes the Lambda layers, reusing existing layer versions with the same contents.
+// The layer ARNs are written to layers.json and layers.yaml, and the provenance of each
+// layer version to provenance.json, if a results directory is given.
+func PublishLambdaLayers(ctx context.Context, opts *types.PublishOptions, layers []types.LambdaLayer) (*types.PublishedLayers, error) {
 	layerArns := []string{}
+	results := &types.PublishedLayers{Layers: []types.PublishedLayer{}, BaseLayerArns: opts.BaseLayerArns}
+	provenance := []types.LayerProvenance{}
 
-	for _, layer := range layers {
-		layerName := opts.LayerPrefix + "-" + strings.Replace(layer.Digest, ":", "-", -1)
+	templates, err := ParseLayerTemplates(opts.LayerNameTemplate, opts.Description)
+	if err != nil {
+		return nil, err
+	}
 
-		var layerDescription, licenseInfo *string
+	if err := CheckLayerCount(len(opts.PrependLayerArns) + len(opts.BaseLayerArns) + len(layers) + len(opts.AppendLayerArns)); err != nil {
+		return nil, err
+	}
 
-		if opts.Description == "" {
-			// if no description is passed from commandline, use the default description
-			layerDescription = aws.String("created by img2lambda from image " + opts.SourceImageName)
-		} else {
-			layerDescription = aws.String(opts.Description)
+	buildTime := opts.BuildTime
+	if buildTime.IsZero() {
+		buildTime = time.Now()
+	}
+	timestamp := buildTime.UTC().Format(time.RFC3339)
+
+	// Check that the layers have different names before publishing any of them
+	layerNames := map[string]bool{}
+	for i, layer := range layers {
+		templateData := newLayerTemplateData(opts.LayerPrefix, opts.SourceImageName, opts.ManifestDigest, layer.Digest, layer.Part, i+1, version.Version, timestamp)
+		layerName, err := templates.Name(templateData)
+		if err != nil {
+			return nil, err
+		}
+		if layerNames[layerName] {
+			return nil, fmt.Errorf("several layers would be published as layer %s: the layer name template must name each layer differently, for example with {{.Digest}} and {{.Part}}", layerName)
+		}
+		layerNames[layerName] = true
+	}
+
+	for i, layer := range layers {
+		templateData := newLayerTemplateData(opts.LayerPrefix, opts.SourceImageName, opts.ManifestDigest, layer.Digest, layer.Part, i+1, version.Version, timestamp)
+		layerName, err := templates.Name(templateData)
+		if err != nil {
+			return nil, err
+		}
+		description, err := templates.Description(templateData)
+		if err != nil {
+			return nil, err
 		}
 
+		layerDescription := aws.String(description)
+		var licenseInfo *string
 		if opts.LicenseInfo != "" {
 			licenseInfo = aws.String(opts.LicenseInfo)
 		}
@@ -43,85 +85,224 @@ func PublishLambdaLayers(opts *types.PublishOptions, layers []types.LambdaLayer)
 			opts.CompatibleRuntimes = append(opts.CompatibleRuntimes, "provided")
 		}
 
-		layerContents, err := ioutil.ReadFile(layer.File)
-		if err != nil {
-			return "", "", err
+		publishArgs := &lambda.PublishLayerVersionInput{
+			CompatibleRuntimes: aws.StringSlice(opts.CompatibleRuntimes),
+			Description:        layerDescription,
+			LayerName:          aws.String(layerName),
+			LicenseInfo:        licenseInfo,
 		}
+		published := types.PublishedLayer{Layer: layer, Name: layerName}
+
+		if layer.Signed != nil {
+			// Each signing job writes a different signed zip file, so signed layers
+			// are not matched to existing layer versions but always published from S3
+			publishArgs.Content = &lambda.LayerVersionContentInput{
+				S3Bucket: aws.String(layer.Signed.S3Bucket),
+				S3Key:    aws.String(layer.Signed.S3Key),
+			}
 
-		found, existingArn, err := matchExistingLambdaLayer(layerName, layerContents, &opts.LambdaClient)
-		if err != nil {
-			return "", "", err
-		}
+			resp, err := opts.LambdaClient.PublishLayerVersionWithContext(ctx, publishArgs)
+			if err != nil {
+				logPublishedBeforeError(opts, results, len(layers))
+				return nil, err
+			}
 
-		if found {
-			layerArns = append(layerArns, existingArn)
-			log.Printf("Matched Lambda layer file %s (image layer %s) to existing Lambda layer: %s", layer.File, layer.Digest, existingArn)
+			layerArns = append(layerArns, *resp.LayerVersionArn)
+			published.Arn = *resp.LayerVersionArn
+			published.Version = aws.Int64Value(resp.Version)
+			if resp.Content != nil {
+				published.CodeSha256 = aws.StringValue(resp.Content.CodeSha256)
+				published.CodeSize = aws.Int64Value(resp.Content.CodeSize)
+			}
+			opts.Logger.Infof("Published signed Lambda layer file s3://%s/%s (image layer %s) to Lambda: %s",
+				layer.Signed.S3Bucket, layer.Signed.S3Key, layer.Digest, *resp.LayerVersionArn)
 		} else {
-			publishArgs := &lambda.PublishLayerVersionInput{
-				CompatibleRuntimes: aws.StringSlice(opts.CompatibleRuntimes),
-				Content:            &lambda.LayerVersionContentInput{ZipFile: layerContents},
-				Description:        layerDescription,
-				LayerName:          aws.String(layerName),
-				LicenseInfo:        licenseInfo,
+			layerContents, err := ioutil.ReadFile(layer.File)
+			if err != nil {
+				return nil, err
 			}
+			published.CodeSha256 = CodeSha256(layerContents)
+			published.CodeSize = int64(len(layerContents))
 
-			resp, err := opts.LambdaClient.PublishLayerVersion(publishArgs)
+			found, existingArn, existingVersion, err := matchExistingLambdaLayer(ctx, layerName, layerContents, &opts.LambdaClient)
 			if err != nil {
-				return "", "", err
+				logPublishedBeforeError(opts, results, len(layers))
+				return nil, err
 			}
 
-			layerArns = append(layerArns, *resp.LayerVersionArn)
-			log.Printf("Published Lambda layer file %s (image layer %s) to Lambda: %s", layer.File, layer.Digest, *resp.LayerVersionArn)
+			if found {
+				layerArns = append(layerArns, existingArn)
+				published.Matched = true
+				published.Arn = existingArn
+				published.Version = existingVersion
+				opts.Logger.Infof("Matched Lambda layer file %s (image layer %s) to existing Lambda layer: %s", layer.File, layer.Digest, existingArn)
+			} else {
+				publishArgs.Content = &lambda.LayerVersionContentInput{ZipFile: layerContents}
+
+				task := opts.Progress.Start(fmt.Sprintf("Uploading Lambda layer %d/%d", i+1, len(layers)), int64(len(layerContents)))
+				resp, err := opts.LambdaClient.PublishLayerVersionWithContext(ctx, publishArgs, UploadProgress(task))
+				task.Done()
+				if err != nil {
+					logPublishedBeforeError(opts, results, len(layers))
+					return nil, err
+				}
+
+				layerArns = append(layerArns, *resp.LayerVersionArn)
+				published.Arn = *resp.LayerVersionArn
+				published.Version = aws.Int64Value(resp.Version)
+				opts.Logger.Infof("Published Lambda layer file %s (image layer %s) to Lambda: %s", layer.File, layer.Digest, *resp.LayerVersionArn)
+			}
 		}
 
-		err = os.Remove(layer.File)
-		if err != nil {
-			return "", "", err
+		results.Layers = append(results.Layers, published)
+		provenance = append(provenance, types.LayerProvenance{
+			LayerName:        layerName,
+			LayerVersionArn:  published.Arn,
+			Matched:          published.Matched,
+			Image:            opts.SourceImageName,
+			ManifestDigest:   opts.ManifestDigest,
+			ImageLayerDigest: layer.Digest,
+			Part:             layer.Part,
+			ToolVersion:      version.Version,
+			BuildTimestamp:   timestamp,
+		})
+
+		if !opts.KeepLayerFiles {
+			if err := os.Remove(layer.File); err != nil {
+				return nil, err
+			}
 		}
 	}
 
+	// Lambda extracts the layers of a function in the order they are listed
+	layerArns = append(append(append(append([]string{}, opts.PrependLayerArns...), opts.BaseLayerArns...), layerArns...), opts.AppendLayerArns...)
+	results.LayerArns = layerArns
+
+	if opts.ResultsDir == "" {
+		return results, nil
+	}
+
 	jsonArns, err := json.MarshalIndent(layerArns, "", "  ")
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
 	jsonResultsPath := filepath.Join(opts.ResultsDir, "layers.json")
-	jsonFile, err := os.Create(jsonResultsPath)
+	err = atomicfile.WriteFile(jsonResultsPath, jsonArns, 0644)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
-	defer jsonFile.Close()
 
-	_, err = jsonFile.Write(jsonArns)
+	yamlArns, err := yaml.Marshal(layerArns)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
-	yamlArns, err := yaml.Marshal(layerArns)
+	yamlResultsPath := filepath.Join(opts.ResultsDir, "layers.yaml")
+	err = atomicfile.WriteFile(yamlResultsPath, yamlArns, 0644)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
-	yamlResultsPath := filepath.Join(opts.ResultsDir, "layers.yaml")
-	yamlFile, err := os.Create(yamlResultsPath)
+	opts.Logger.Infof("Lambda layer ARNs (%d total) are written to %s and %s", len(layerArns), jsonResultsPath, yamlResultsPath)
+
+	jsonProvenance, err := json.MarshalIndent(provenance, "", "  ")
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
-	defer yamlFile.Close()
 
-	_, err = yamlFile.Write(yamlArns)
+	provenancePath := filepath.Join(opts.ResultsDir, "provenance.json")
+	err = atomicfile.WriteFile(provenancePath, jsonProvenance, 0644)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
-	log.Printf("Lambda layer ARNs (%d total) are written to %s and %s", len(layerArns), jsonResultsPath, yamlResultsPath)
+	opts.Logger.Infof("Provenance of the Lambda layer versions is written to %s", provenancePath)
+
+	results.JSONResultsFile = jsonResultsPath
+	results.YAMLResultsFile = yamlResultsPath
+	results.ProvenanceFile = provenancePath
+	return results, nil
+}
+
+// Maximum number of layers of a Lambda function
+const MaxFunctionLayers = 5
+
+// Fails if a function could not use the given number of layers
+func CheckLayerCount(count int) error {
+	if count > MaxFunctionLayers {
+		return fmt.Errorf("the image would be converted to %d Lambda layers including the additional layers, but Lambda functions can only use %d layers (exclude image layers, or flatten them into fewer layers)", count, MaxFunctionLayers)
+	}
+	return nil
+}
 
-	return jsonResultsPath, yamlResultsPath, nil
+// Fails if the string is not a layer version ARN
+func ValidateLayerArn(arn string) error {
+	if !strings.HasPrefix(arn, "arn:") || !strings.Contains(arn, ":layer:") {
+		return fmt.Errorf("%q is not a layer version ARN", arn)
+	}
+	return nil
 }
 
-func matchExistingLambdaLayer(layerName string, layerContents []byte, lambdaClient *lambdaiface.LambdaAPI) (bool, string, error) {
+// Reads the layer version ARNs from a layers.json results file
+func ReadLayerArns(filename string) ([]string, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var layerArns []string
+	if err := json.Unmarshal(contents, &layerArns); err != nil {
+		return nil, fmt.Errorf("parsing %s: expected a JSON list of layer version ARNs: %v", filename, err)
+	}
+	for _, arn := range layerArns {
+		if err := ValidateLayerArn(arn); err != nil {
+			return nil, fmt.Errorf("parsing %s: %v", filename, err)
+		}
+	}
+	return layerArns, nil
+}
+
+// Name of the Lambda layer published for the given image layer
+func LayerName(layerPrefix string, digest string) string {
+	return layerPrefix + "-" + strings.Replace(digest, ":", "-", -1)
+}
+
+// Base64-encoded SHA-256 hash of the layer zip file, as reported by Lambda
+func CodeSha256(layerContents []byte) string {
 	hash := sha256.Sum256(layerContents)
-	hashStr := base64.StdEncoding.EncodeToString(hash[:])
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// Counts the request body bytes sent to AWS towards the task. The body is
+// counted again from zero if the request is retried.
+func UploadProgress(task *progress.Task) request.Option {
+	return func(r *request.Request) {
+		if task == nil {
+			return
+		}
+		r.Handlers.Send.PushFront(func(r *request.Request) {
+			task.Reset()
+			if r.HTTPRequest.Body != nil && r.HTTPRequest.Body != http.NoBody {
+				r.HTTPRequest.Body = task.Reader(r.HTTPRequest.Body)
+			}
+		})
+	}
+}
+
+// When publishing stops early, for example when it is interrupted, lists the layer versions that were already published
+func logPublishedBeforeError(opts *types.PublishOptions, results *types.PublishedLayers, total int) {
+	if len(results.Layers) == 0 {
+		return
+	}
+	opts.Logger.Warnf("Stopped after publishing %d of %d Lambda layers:", len(results.Layers), total)
+	for _, published := range results.Layers {
+		opts.Logger.Warnf("  %s (image layer %s)", published.Arn, published.Layer.Digest)
+	}
+}
+
+func matchExistingLambdaLayer(ctx context.Context, layerName string, layerContents []byte, lambdaClient *lambdaiface.LambdaAPI) (bool, string, int64, error) {
+	hashStr := CodeSha256(layerContents)
 
 	var marker *string
 	client := *lambdaClient
@@ -132,9 +313,9 @@ func matchExistingLambdaLayer(layerName string, layerContents []byte, lambdaClie
 			Marker:    marker,
 		}
 
-		resp, err := client.ListLayerVersions(listArgs)
+		resp, err := client.ListLayerVersionsWithContext(ctx, listArgs)
 		if err != nil {
-			return false, "", err
+			return false, "", 0, err
 		}
 
 		for _, layerVersion := range resp.LayerVersions {
@@ -143,13 +324,13 @@ func matchExistingLambdaLayer(layerName string, layerContents []byte, lambdaClie
 				VersionNumber: layerVersion.Version,
 			}
 
-			layerResp, err := client.GetLayerVersion(getArgs)
+			layerResp, err := client.GetLayerVersionWithContext(ctx, getArgs)
 			if err != nil {
-				return false, "", err
+				return false, "", 0, err
 			}
 
 			if *layerResp.Content.CodeSha256 == hashStr && *layerResp.Content.CodeSize == int64(len(layerContents)) {
-				return true, *layerResp.LayerVersionArn, nil
+				return true, *layerResp.LayerVersionArn, aws.Int64Value(layerResp.Version), nil
 			}
 		}
 
@@ -160,5 +341,5 @@ func matchExistingLambdaLayer(layerName string, layerContents []byte, lambdaClie
 		marker = resp.NextMarker
 	}
 
-	return false, "", nil
+	return false, "", 0, nil
 }
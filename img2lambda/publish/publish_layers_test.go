@@ -3,13 +3,16 @@
 package publish
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
 	"testing"
+	"time"
 
 	yaml "gopkg.in/yaml.v2"
 
@@ -17,6 +20,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/lambda"
 	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/internal/testing/mocks"
 	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/version"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 )
@@ -41,6 +45,16 @@ func parseYAMLResult(t *testing.T, resultsFilename string) []string {
 	return resultArns
 }
 
+func parseProvenance(t *testing.T, provenanceFilename string) []types.LayerProvenance {
+	provenanceContents, err := ioutil.ReadFile(provenanceFilename)
+	assert.Nil(t, err)
+	var provenance []types.LayerProvenance
+	err = json.Unmarshal(provenanceContents, &provenance)
+	assert.Nil(t, err)
+	os.Remove(provenanceFilename)
+	return provenance
+}
+
 func mockLayer(t *testing.T, n int) types.LambdaLayer {
 	tmpFile, err := ioutil.TempFile("", "")
 	assert.Nil(t, err)
@@ -99,9 +113,9 @@ func mockPublishNoExistingLayers(t *testing.T, lambdaClient *mocks.MockLambdaAPI
 	}
 
 	gomock.InOrder(
-		lambdaClient.EXPECT().ListLayerVersions(gomock.Eq(expectedListInput1)).Return(expectedListOutput1, nil),
-		lambdaClient.EXPECT().ListLayerVersions(gomock.Eq(expectedListInput2)).Return(expectedListOutput2, nil),
-		lambdaClient.EXPECT().PublishLayerVersion(gomock.Eq(expectedPublishInput)).Return(expectedPublishOutput, nil),
+		lambdaClient.EXPECT().ListLayerVersionsWithContext(gomock.Any(), gomock.Eq(expectedListInput1)).Return(expectedListOutput1, nil),
+		lambdaClient.EXPECT().ListLayerVersionsWithContext(gomock.Any(), gomock.Eq(expectedListInput2)).Return(expectedListOutput2, nil),
+		lambdaClient.EXPECT().PublishLayerVersionWithContext(gomock.Any(), gomock.Eq(expectedPublishInput), gomock.Any()).Return(expectedPublishOutput, nil),
 	)
 }
 
@@ -152,9 +166,9 @@ func mockPublishNoMatchingLayers(t *testing.T, lambdaClient *mocks.MockLambdaAPI
 	}
 
 	gomock.InOrder(
-		lambdaClient.EXPECT().ListLayerVersions(gomock.Eq(expectedListInput)).Return(expectedListOutput, nil),
-		lambdaClient.EXPECT().GetLayerVersion(gomock.Eq(expectedGetInput)).Return(expectedGetOutput, nil),
-		lambdaClient.EXPECT().PublishLayerVersion(gomock.Eq(expectedPublishInput)).Return(expectedPublishOutput, nil),
+		lambdaClient.EXPECT().ListLayerVersionsWithContext(gomock.Any(), gomock.Eq(expectedListInput)).Return(expectedListOutput, nil),
+		lambdaClient.EXPECT().GetLayerVersionWithContext(gomock.Any(), gomock.Eq(expectedGetInput)).Return(expectedGetOutput, nil),
+		lambdaClient.EXPECT().PublishLayerVersionWithContext(gomock.Any(), gomock.Eq(expectedPublishInput), gomock.Any()).Return(expectedPublishOutput, nil),
 	)
 }
 
@@ -194,8 +208,8 @@ func mockMatchingLayer(t *testing.T, lambdaClient *mocks.MockLambdaAPI, n int) {
 	}
 
 	gomock.InOrder(
-		lambdaClient.EXPECT().ListLayerVersions(gomock.Eq(expectedListInput)).Return(expectedListOutput, nil),
-		lambdaClient.EXPECT().GetLayerVersion(gomock.Eq(expectedGetInput)).Return(expectedGetOutput, nil),
+		lambdaClient.EXPECT().ListLayerVersionsWithContext(gomock.Any(), gomock.Eq(expectedListInput)).Return(expectedListOutput, nil),
+		lambdaClient.EXPECT().GetLayerVersionWithContext(gomock.Any(), gomock.Eq(expectedGetInput)).Return(expectedGetOutput, nil),
 	)
 }
 
@@ -217,15 +231,19 @@ func TestNoLayers(t *testing.T) {
 
 	layers := []types.LambdaLayer{}
 
-	jsonResultsFilename, yamlResultsFilename, err := PublishLambdaLayers(opts, layers)
+	results, err := PublishLambdaLayers(context.Background(), opts, layers)
 	assert.Nil(t, err)
+	assert.Len(t, results.Layers, 0)
 
-	resultArns := parseJSONResult(t, jsonResultsFilename)
+	resultArns := parseJSONResult(t, results.JSONResultsFile)
 	assert.Len(t, resultArns, 0)
 
-	resultArns = parseYAMLResult(t, yamlResultsFilename)
+	resultArns = parseYAMLResult(t, results.YAMLResultsFile)
 	assert.Len(t, resultArns, 0)
 
+	provenance := parseProvenance(t, results.ProvenanceFile)
+	assert.Len(t, provenance, 0)
+
 	os.Remove(dir)
 }
 
@@ -242,6 +260,8 @@ func TestPublishSuccess(t *testing.T) {
 		LambdaClient:    lambdaClient,
 		LayerPrefix:     "test-prefix",
 		SourceImageName: "test-image",
+		ManifestDigest:  "sha256:manifest",
+		BuildTime:       time.Date(2020, 6, 18, 12, 0, 0, 0, time.UTC),
 		ResultsDir:      dir,
 	}
 
@@ -251,24 +271,359 @@ func TestPublishSuccess(t *testing.T) {
 	mockPublishNoMatchingLayers(t, lambdaClient, 2)
 	mockMatchingLayer(t, lambdaClient, 3)
 
-	jsonResultsFilename, yamlResultsFilename, err := PublishLambdaLayers(opts, layers)
+	results, err := PublishLambdaLayers(context.Background(), opts, layers)
 	assert.Nil(t, err)
 
-	resultArns := parseJSONResult(t, jsonResultsFilename)
+	assert.Len(t, results.Layers, 3)
+	assert.False(t, results.Layers[0].Matched)
+	assert.Equal(t, "sha256:1", results.Layers[0].Layer.Digest)
+	assert.Equal(t, "arn:aws:lambda:us-east-2:123456789012:layer:example-layer-1:1", results.Layers[0].Arn)
+	assert.Equal(t, int64(13), results.Layers[0].CodeSize)
+	assert.False(t, results.Layers[1].Matched)
+	assert.True(t, results.Layers[2].Matched)
+	assert.Equal(t, "T/q7q052MgJGLfH1mBGUQSFYjwVn9VvOWBoOmevPZgY=", results.Layers[2].CodeSha256)
+	assert.Equal(t, "arn:aws:lambda:us-east-2:123456789012:layer:example-layer-3:1", results.Layers[2].Arn)
+
+	resultArns := parseJSONResult(t, results.JSONResultsFile)
 	assert.Len(t, resultArns, 3)
 	assert.Equal(t, "arn:aws:lambda:us-east-2:123456789012:layer:example-layer-1:1", resultArns[0])
 	assert.Equal(t, "arn:aws:lambda:us-east-2:123456789012:layer:example-layer-2:1", resultArns[1])
 	assert.Equal(t, "arn:aws:lambda:us-east-2:123456789012:layer:example-layer-3:1", resultArns[2])
 
-	resultArns = parseYAMLResult(t, yamlResultsFilename)
+	resultArns = parseYAMLResult(t, results.YAMLResultsFile)
 	assert.Len(t, resultArns, 3)
 	assert.Equal(t, "arn:aws:lambda:us-east-2:123456789012:layer:example-layer-1:1", resultArns[0])
 	assert.Equal(t, "arn:aws:lambda:us-east-2:123456789012:layer:example-layer-2:1", resultArns[1])
 	assert.Equal(t, "arn:aws:lambda:us-east-2:123456789012:layer:example-layer-3:1", resultArns[2])
 
+	provenance := parseProvenance(t, results.ProvenanceFile)
+	assert.Len(t, provenance, 3)
+	assert.Equal(t, types.LayerProvenance{
+		LayerName:        "test-prefix-sha256-1",
+		LayerVersionArn:  "arn:aws:lambda:us-east-2:123456789012:layer:example-layer-1:1",
+		Image:            "test-image",
+		ManifestDigest:   "sha256:manifest",
+		ImageLayerDigest: "sha256:1",
+		ToolVersion:      version.Version,
+		BuildTimestamp:   "2020-06-18T12:00:00Z",
+	}, provenance[0])
+	assert.True(t, provenance[2].Matched)
+
 	os.Remove(dir)
 }
 
+func TestPublishWithBaseLayers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lambdaClient := mocks.NewMockLambdaAPI(ctrl)
+
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	baseLayerArns := []string{
+		"arn:aws:lambda:us-east-2:123456789012:layer:base-runtime:3",
+		"arn:aws:lambda:us-east-2:123456789012:layer:base-libs:7",
+	}
+	opts := &types.PublishOptions{
+		LambdaClient:    lambdaClient,
+		LayerPrefix:     "test-prefix",
+		SourceImageName: "test-image",
+		ResultsDir:      dir,
+		BaseLayerArns:   baseLayerArns,
+	}
+
+	mockPublishNoExistingLayers(t, lambdaClient, 1)
+
+	results, err := PublishLambdaLayers(context.Background(), opts, []types.LambdaLayer{mockLayer(t, 1)})
+	assert.Nil(t, err)
+	assert.Len(t, results.Layers, 1)
+	assert.Equal(t, baseLayerArns, results.BaseLayerArns)
+
+	// The base image layers are listed before the layers of the image
+	expectedArns := append(baseLayerArns, "arn:aws:lambda:us-east-2:123456789012:layer:example-layer-1:1")
+
+	// The results file of the image can be read as the base layers of another image
+	layerArns, err := ReadLayerArns(results.JSONResultsFile)
+	assert.Nil(t, err)
+	assert.Equal(t, expectedArns, layerArns)
+
+	assert.Equal(t, expectedArns, parseJSONResult(t, results.JSONResultsFile))
+	assert.Equal(t, expectedArns, parseYAMLResult(t, results.YAMLResultsFile))
+
+	// Provenance is only recorded for the layers published from the image
+	assert.Len(t, parseProvenance(t, results.ProvenanceFile), 1)
+}
+
+func TestPublishWithAdditionalLayers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lambdaClient := mocks.NewMockLambdaAPI(ctrl)
+
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	opts := &types.PublishOptions{
+		LambdaClient:     lambdaClient,
+		LayerPrefix:      "test-prefix",
+		SourceImageName:  "test-image",
+		ResultsDir:       dir,
+		PrependLayerArns: []string{"arn:aws:lambda:us-east-2:123456789012:layer:monitoring-extension:12"},
+		BaseLayerArns:    []string{"arn:aws:lambda:us-east-2:123456789012:layer:base-runtime:3"},
+		AppendLayerArns:  []string{"arn:aws:lambda:us-east-2:123456789012:layer:config:1"},
+	}
+
+	mockPublishNoExistingLayers(t, lambdaClient, 1)
+
+	results, err := PublishLambdaLayers(context.Background(), opts, []types.LambdaLayer{mockLayer(t, 1)})
+	assert.Nil(t, err)
+
+	expectedArns := []string{
+		"arn:aws:lambda:us-east-2:123456789012:layer:monitoring-extension:12",
+		"arn:aws:lambda:us-east-2:123456789012:layer:base-runtime:3",
+		"arn:aws:lambda:us-east-2:123456789012:layer:example-layer-1:1",
+		"arn:aws:lambda:us-east-2:123456789012:layer:config:1",
+	}
+	assert.Equal(t, expectedArns, results.LayerArns)
+	assert.Equal(t, expectedArns, parseJSONResult(t, results.JSONResultsFile))
+	assert.Equal(t, expectedArns, parseYAMLResult(t, results.YAMLResultsFile))
+}
+
+func TestPublishTooManyLayers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Nothing is published
+	lambdaClient := mocks.NewMockLambdaAPI(ctrl)
+
+	opts := &types.PublishOptions{
+		LambdaClient:    lambdaClient,
+		LayerPrefix:     "test-prefix",
+		SourceImageName: "test-image",
+		PrependLayerArns: []string{
+			"arn:aws:lambda:us-east-2:123456789012:layer:extension-1:1",
+			"arn:aws:lambda:us-east-2:123456789012:layer:extension-2:1",
+			"arn:aws:lambda:us-east-2:123456789012:layer:extension-3:1",
+		},
+	}
+
+	layers := mockLayers(t)
+	for _, layer := range layers {
+		defer os.Remove(layer.File)
+	}
+
+	_, err := PublishLambdaLayers(context.Background(), opts, layers)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "the image would be converted to 6 Lambda layers including the additional layers, but Lambda functions can only use 5 layers")
+}
+
+func TestReadLayerArnsInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "layers.json")
+	assert.Nil(t, ioutil.WriteFile(filename, []byte(`{"layers": []}`), 0644))
+	_, err = ReadLayerArns(filename)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "expected a JSON list of layer version ARNs")
+
+	assert.Nil(t, ioutil.WriteFile(filename, []byte(`["base-runtime"]`), 0644))
+	_, err = ReadLayerArns(filename)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `"base-runtime" is not a layer version ARN`)
+}
+
+func TestPublishLayerNameTemplate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lambdaClient := mocks.NewMockLambdaAPI(ctrl)
+
+	opts := &types.PublishOptions{
+		LambdaClient:      lambdaClient,
+		LayerPrefix:       "test-prefix",
+		LayerNameTemplate: "{{.Namespace}}-{{.Index}}-{{.ShortDigest}}",
+		SourceImageName:   "test-image",
+		ManifestDigest:    "sha256:manifest",
+		Description:       "{{.Image}}@{{.ManifestDigest}} layer {{.Digest}}",
+	}
+
+	layer := mockLayer(t, 1)
+	layerName := aws.String("test-prefix-1-1")
+
+	lambdaClient.EXPECT().
+		ListLayerVersionsWithContext(gomock.Any(), gomock.Eq(&lambda.ListLayerVersionsInput{LayerName: layerName})).
+		Return(&lambda.ListLayerVersionsOutput{}, nil)
+
+	expectedPublishInput := &lambda.PublishLayerVersionInput{
+		CompatibleRuntimes: []*string{aws.String("provided")},
+		Content:            &lambda.LayerVersionContentInput{ZipFile: []byte("hello world 1")},
+		Description:        aws.String("test-image@sha256:manifest layer sha256:1"),
+		LayerName:          layerName,
+	}
+	lambdaClient.EXPECT().
+		PublishLayerVersionWithContext(gomock.Any(), gomock.Eq(expectedPublishInput), gomock.Any()).
+		Return(&lambda.PublishLayerVersionOutput{LayerVersionArn: aws.String("arn:aws:lambda:us-east-2:123456789012:layer:test-prefix-1-1:1")}, nil)
+
+	results, err := PublishLambdaLayers(context.Background(), opts, []types.LambdaLayer{layer})
+	assert.Nil(t, err)
+	assert.Equal(t, "test-prefix-1-1", results.Layers[0].Name)
+}
+
+func TestPublishInvalidLayerName(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lambdaClient := mocks.NewMockLambdaAPI(ctrl)
+
+	opts := &types.PublishOptions{
+		LambdaClient:      lambdaClient,
+		LayerPrefix:       "test-prefix",
+		LayerNameTemplate: "{{.Namespace}}-{{.Image}}",
+		SourceImageName:   "test-image:latest",
+	}
+
+	layer := mockLayer(t, 1)
+	defer os.Remove(layer.File)
+
+	// Nothing is published
+	_, err := PublishLambdaLayers(context.Background(), opts, []types.LambdaLayer{layer})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid layer name "test-prefix-test-image:latest"`)
+}
+
+func TestPublishDuplicateLayerNames(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lambdaClient := mocks.NewMockLambdaAPI(ctrl)
+
+	opts := &types.PublishOptions{
+		LambdaClient:      lambdaClient,
+		LayerPrefix:       "test-prefix",
+		LayerNameTemplate: "{{.Namespace}}-{{.ShortDigest}}",
+		SourceImageName:   "test-image",
+	}
+
+	// Two parts of the same image layer
+	part1 := mockLayer(t, 1)
+	defer os.Remove(part1.File)
+	part1.Part = 1
+	part2 := mockLayer(t, 2)
+	defer os.Remove(part2.File)
+	part2.Digest = part1.Digest
+	part2.Part = 2
+
+	// Nothing is published
+	_, err := PublishLambdaLayers(context.Background(), opts, []types.LambdaLayer{part1, part2})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "several layers would be published as layer test-prefix-1")
+}
+
+func TestPublishWithoutResultsFiles(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lambdaClient := mocks.NewMockLambdaAPI(ctrl)
+
+	opts := &types.PublishOptions{
+		LambdaClient:    lambdaClient,
+		LayerPrefix:     "test-prefix",
+		SourceImageName: "test-image",
+	}
+
+	layers := []types.LambdaLayer{mockLayer(t, 1)}
+	mockPublishNoExistingLayers(t, lambdaClient, 1)
+
+	results, err := PublishLambdaLayers(context.Background(), opts, layers)
+	assert.Nil(t, err)
+
+	assert.Len(t, results.Layers, 1)
+	assert.Equal(t, "arn:aws:lambda:us-east-2:123456789012:layer:example-layer-1:1", results.Layers[0].Arn)
+	assert.Empty(t, results.JSONResultsFile)
+	assert.Empty(t, results.YAMLResultsFile)
+}
+
+func TestPublishKeepLayerFiles(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lambdaClient := mocks.NewMockLambdaAPI(ctrl)
+
+	opts := &types.PublishOptions{
+		LambdaClient:    lambdaClient,
+		LayerPrefix:     "test-prefix",
+		SourceImageName: "test-image",
+		KeepLayerFiles:  true,
+	}
+
+	layers := []types.LambdaLayer{mockLayer(t, 1), mockLayer(t, 3)}
+	defer os.Remove(layers[0].File)
+	defer os.Remove(layers[1].File)
+
+	mockPublishNoExistingLayers(t, lambdaClient, 1)
+	mockMatchingLayer(t, lambdaClient, 3)
+
+	_, err := PublishLambdaLayers(context.Background(), opts, layers)
+	assert.Nil(t, err)
+
+	for _, layer := range layers {
+		_, err = os.Stat(layer.File)
+		assert.Nil(t, err)
+	}
+}
+
+func TestPublishSignedLayer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lambdaClient := mocks.NewMockLambdaAPI(ctrl)
+
+	opts := &types.PublishOptions{
+		LambdaClient:    lambdaClient,
+		LayerPrefix:     "test-prefix",
+		SourceImageName: "test-image",
+	}
+
+	layer := mockLayer(t, 1)
+	layer.Signed = &types.SignedArtifact{SigningJobID: "job-1", S3Bucket: "signing-bucket", S3Key: "test-prefix/signed/job-1.zip"}
+
+	// Signed layers are published from S3 without matching existing layer versions
+	expectedPublishInput := &lambda.PublishLayerVersionInput{
+		CompatibleRuntimes: []*string{aws.String("provided")},
+		Content: &lambda.LayerVersionContentInput{
+			S3Bucket: aws.String("signing-bucket"),
+			S3Key:    aws.String("test-prefix/signed/job-1.zip"),
+		},
+		Description: aws.String("created by img2lambda from image test-image"),
+		LayerName:   aws.String("test-prefix-sha256-1"),
+	}
+	lambdaClient.EXPECT().PublishLayerVersionWithContext(gomock.Any(), gomock.Eq(expectedPublishInput)).Return(&lambda.PublishLayerVersionOutput{
+		LayerVersionArn: aws.String("arn:aws:lambda:us-east-2:123456789012:layer:example-layer-1:1"),
+		Version:         aws.Int64(1),
+		Content: &lambda.LayerVersionContentOutput{
+			CodeSha256: aws.String("signed-sha256"),
+			CodeSize:   aws.Int64(123),
+		},
+	}, nil)
+
+	results, err := PublishLambdaLayers(context.Background(), opts, []types.LambdaLayer{layer})
+	assert.Nil(t, err)
+
+	assert.Len(t, results.Layers, 1)
+	assert.Equal(t, "arn:aws:lambda:us-east-2:123456789012:layer:example-layer-1:1", results.Layers[0].Arn)
+	assert.Equal(t, "signed-sha256", results.Layers[0].CodeSha256)
+	assert.Equal(t, int64(123), results.Layers[0].CodeSize)
+	assert.Equal(t, layer.Signed, results.Layers[0].Layer.Signed)
+
+	_, err = os.Stat(layer.File)
+	assert.True(t, os.IsNotExist(err))
+}
+
 func TestPublishError(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -295,7 +650,7 @@ func TestPublishError(t *testing.T) {
 		LayerVersions: []*lambda.LayerVersionsListItem{},
 	}
 
-	lambdaClient.EXPECT().ListLayerVersions(gomock.Eq(expectedListInput)).Return(expectedListOutput, nil)
+	lambdaClient.EXPECT().ListLayerVersionsWithContext(gomock.Any(), gomock.Eq(expectedListInput)).Return(expectedListOutput, nil)
 
 	expectedInput1 := &lambda.PublishLayerVersionInput{
 		CompatibleRuntimes: []*string{aws.String("provided")},
@@ -305,13 +660,12 @@ func TestPublishError(t *testing.T) {
 	}
 
 	lambdaClient.EXPECT().
-		PublishLayerVersion(gomock.Eq(expectedInput1)).
+		PublishLayerVersionWithContext(gomock.Any(), gomock.Eq(expectedInput1), gomock.Any()).
 		Return(nil, errors.New("Access denied"))
 
-	jsonResultsFilename, yamlResultsFilename, err := PublishLambdaLayers(opts, layers)
+	results, err := PublishLambdaLayers(context.Background(), opts, layers)
 	assert.Error(t, err)
-	assert.Equal(t, "", jsonResultsFilename)
-	assert.Equal(t, "", yamlResultsFilename)
+	assert.Nil(t, results)
 
 	os.Remove(layers[0].File)
 	os.Remove(layers[1].File)
@@ -0,0 +1,144 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package publish
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// Description of published layer versions when no description template is given
+const DefaultDescriptionTemplate = "created by img2lambda from image {{.Image}}"
+
+const (
+	maxLayerNameLength   = 140
+	maxDescriptionLength = 256
+)
+
+var layerNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// Values available in layer name and description templates, like {{.Namespace}}-{{.ShortDigest}}
+type LayerTemplateData struct {
+	Namespace      string // Layer namespace
+	Image          string // Source image reference
+	ManifestDigest string // Manifest digest of the source image
+	Digest         string // Image layer digest, like sha256:<hex>
+	DigestHex      string // Hex part of the image layer digest
+	ShortDigest    string // First 12 characters of the hex part of the image layer digest
+	Part           int    // Number of the part, starting at 1, if the image layer was split into several Lambda layers, otherwise 0
+	Index          int    // Number of the Lambda layer, starting at 1
+	ToolVersion    string // Version of img2lambda
+	Timestamp      string // Time of the build in RFC 3339 format
+}
+
+func newLayerTemplateData(namespace string, image string, manifestDigest string, digest string, part int, index int, toolVersion string, timestamp string) *LayerTemplateData {
+	hex := digest
+	if i := strings.Index(digest, ":"); i >= 0 {
+		hex = digest[i+1:]
+	}
+	short := hex
+	if len(short) > 12 {
+		short = short[:12]
+	}
+	return &LayerTemplateData{
+		Namespace:      namespace,
+		Image:          image,
+		ManifestDigest: manifestDigest,
+		Digest:         digest,
+		DigestHex:      hex,
+		ShortDigest:    short,
+		Part:           part,
+		Index:          index,
+		ToolVersion:    toolVersion,
+		Timestamp:      timestamp,
+	}
+}
+
+// Templates for the names and descriptions of published layers
+type LayerTemplates struct {
+	name        *template.Template
+	description *template.Template // Nil if the description is literal text
+	literal     string
+}
+
+// Parses the layer name and description templates. Without a name template, layers are named
+// <namespace>-sha256-<hex>, or <namespace>-sha256-<hex>-part<N> for parts of split image layers. Without a description template, DefaultDescriptionTemplate is used.
+// Descriptions without template actions, or that cannot be parsed as a template, are used as literal text.
+func ParseLayerTemplates(nameTemplate string, descriptionTemplate string) (*LayerTemplates, error) {
+	templates := &LayerTemplates{}
+
+	if nameTemplate != "" {
+		name, err := template.New("layer name").Option("missingkey=error").Parse(nameTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid layer name template: %v", err)
+		}
+		templates.name = name
+	}
+
+	if descriptionTemplate == "" {
+		descriptionTemplate = DefaultDescriptionTemplate
+	}
+	templates.literal = descriptionTemplate
+	if strings.Contains(descriptionTemplate, "{{") {
+		if description, err := template.New("layer description").Option("missingkey=error").Parse(descriptionTemplate); err == nil {
+			templates.description = description
+		}
+	}
+
+	// Catch references to unknown variables before publishing anything
+	example := newLayerTemplateData("img2lambda", "image", "sha256:0", "sha256:0", 0, 1, "version", "2006-01-02T15:04:05Z")
+	if _, err := templates.Name(example); err != nil {
+		return nil, err
+	}
+	if _, err := templates.Description(example); err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+// Name of the Lambda layer published for an image layer
+func (t *LayerTemplates) Name(data *LayerTemplateData) (string, error) {
+	if t.name == nil {
+		name := LayerName(data.Namespace, data.Digest)
+		if data.Part > 0 {
+			name += fmt.Sprintf("-part%d", data.Part)
+		}
+		return name, nil
+	}
+
+	name, err := execute(t.name, data)
+	if err != nil {
+		return "", fmt.Errorf("invalid layer name template: %v", err)
+	}
+	if !layerNamePattern.MatchString(name) || len(name) > maxLayerNameLength {
+		return "", fmt.Errorf("layer name template results in invalid layer name %q: layer names must be 1 to %d letters, numbers, hyphens and underscores", name, maxLayerNameLength)
+	}
+	return name, nil
+}
+
+// Description of the layer version published for an image layer
+func (t *LayerTemplates) Description(data *LayerTemplateData) (string, error) {
+	description := t.literal
+	if t.description != nil {
+		var err error
+		description, err = execute(t.description, data)
+		if err != nil {
+			return "", fmt.Errorf("invalid layer description template: %v", err)
+		}
+	}
+	if len(description) > maxDescriptionLength {
+		return "", fmt.Errorf("layer description %q is longer than %d characters", description, maxDescriptionLength)
+	}
+	return description, nil
+}
+
+func execute(tmpl *template.Template, data *LayerTemplateData) (string, error) {
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package publish
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testTemplateData = newLayerTemplateData("my-app", "my-image:1.0",
+	"sha256:e0b3e4b4b3e8d1f1d6c6c58f8d0d2c6d48e0b0e9a8b3b0f1c6c1f8c3a4b5c6d7",
+	"sha256:233b6ec1f7cabde7a8b5cf241a8a736fc06e89d17f5b9ffe1930a6c110657e4e",
+	0, 2, "1.2.0", "2020-06-18T12:00:00Z")
+
+func TestDefaultLayerTemplates(t *testing.T) {
+	templates, err := ParseLayerTemplates("", "")
+	assert.Nil(t, err)
+
+	name, err := templates.Name(testTemplateData)
+	assert.Nil(t, err)
+	assert.Equal(t, "my-app-sha256-233b6ec1f7cabde7a8b5cf241a8a736fc06e89d17f5b9ffe1930a6c110657e4e", name)
+
+	description, err := templates.Description(testTemplateData)
+	assert.Nil(t, err)
+	assert.Equal(t, "created by img2lambda from image my-image:1.0", description)
+}
+
+func TestDefaultLayerTemplatesPart(t *testing.T) {
+	templates, err := ParseLayerTemplates("", "")
+	assert.Nil(t, err)
+
+	data := *testTemplateData
+	data.Part = 3
+	name, err := templates.Name(&data)
+	assert.Nil(t, err)
+	assert.Equal(t, "my-app-sha256-233b6ec1f7cabde7a8b5cf241a8a736fc06e89d17f5b9ffe1930a6c110657e4e-part3", name)
+}
+
+func TestLayerTemplates(t *testing.T) {
+	templates, err := ParseLayerTemplates("{{.Namespace}}-{{.ShortDigest}}", "{{.Image}} layer {{.Index}} ({{.Digest}}), img2lambda {{.ToolVersion}} at {{.Timestamp}}")
+	assert.Nil(t, err)
+
+	name, err := templates.Name(testTemplateData)
+	assert.Nil(t, err)
+	assert.Equal(t, "my-app-233b6ec1f7ca", name)
+
+	description, err := templates.Description(testTemplateData)
+	assert.Nil(t, err)
+	assert.Equal(t, "my-image:1.0 layer 2 (sha256:233b6ec1f7cabde7a8b5cf241a8a736fc06e89d17f5b9ffe1930a6c110657e4e), img2lambda 1.2.0 at 2020-06-18T12:00:00Z", description)
+}
+
+func TestInvalidLayerTemplates(t *testing.T) {
+	_, err := ParseLayerTemplates("{{.Namespace", "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid layer name template")
+
+	_, err = ParseLayerTemplates("{{.Unknown}}", "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid layer name template")
+
+	_, err = ParseLayerTemplates("", "{{.Unknown}}")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid layer description template")
+
+	_, err = ParseLayerTemplates("{{.Namespace}}/{{.Index}}", "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid layer name")
+
+	_, err = ParseLayerTemplates("{{.Namespace}}-{{.ManifestDigest}}", "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid layer name")
+
+	_, err = ParseLayerTemplates("", strings.Repeat("x", 257))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "longer than 256 characters")
+}
+
+func TestLiteralDescription(t *testing.T) {
+	for _, literal := range []string{
+		`built from {"app": "my-image"}`,
+		"uses {{ as a delimiter",
+		"100% {not a template}",
+	} {
+		templates, err := ParseLayerTemplates("", literal)
+		assert.Nil(t, err, literal)
+		description, err := templates.Description(testTemplateData)
+		assert.Nil(t, err, literal)
+		assert.Equal(t, literal, description)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package report
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/internal/atomicfile"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/publish"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
+)
+
+// Describes the repacked image and, unless this was a dry-run, the published layers.
+// Without published layers, the Lambda layer files must still exist to compute their hashes.
+func NewReport(image *types.RepackedImage, published *types.PublishedLayers) (*types.Report, error) {
+	report := &types.Report{
+		Image:          image.Name,
+		ManifestDigest: image.ManifestDigest,
+		Verification:   image.Verification,
+		BaseImage:      image.BaseImage,
+		Environment:    image.Environment,
+		SecretFindings: image.SecretFindings,
+		Published:      published != nil,
+		Layers:         []types.ReportLayer{},
+	}
+
+	if image.Function != nil && image.Function.FileCount > 0 {
+		report.Function = types.ReportFunction{
+			File:        image.Function.File,
+			SBOMFile:    image.Function.SBOMFile,
+			FileCount:   image.Function.FileCount,
+			Signed:      image.Function.Signed,
+			PrunedFiles: image.Function.PrunedFiles,
+			PrunedBytes: image.Function.PrunedBytes,
+		}
+	}
+
+	for _, layer := range image.Layers {
+		report.Extensions = append(report.Extensions, layer.Extensions...)
+	}
+
+	if published != nil {
+		report.BaseLayerArns = published.BaseLayerArns
+		report.LayerArns = published.LayerArns
+		for _, layer := range published.Layers {
+			status := types.LayerStatusPublished
+			if layer.Matched {
+				status = types.LayerStatusMatched
+			}
+
+			report.Layers = append(report.Layers, types.ReportLayer{
+				ImageLayerDigest: layer.Layer.Digest,
+				LayerName:        layer.Name,
+				File:             layer.Layer.File,
+				SBOMFile:         layer.Layer.SBOMFile,
+				CodeSha256:       layer.CodeSha256,
+				CodeSize:         layer.CodeSize,
+				Status:           status,
+				Arn:              layer.Arn,
+				Version:          layer.Version,
+				Signed:           layer.Layer.Signed,
+				Part:             layer.Layer.Part,
+				FlattenedDigests: layer.Layer.FlattenedDigests,
+				Extensions:       extensionNames(layer.Layer),
+				BundledLibraries: layer.Layer.BundledLibraries,
+				PrunedFiles:      layer.Layer.PrunedFiles,
+				PrunedBytes:      layer.Layer.PrunedBytes,
+			})
+		}
+		return report, nil
+	}
+
+	for _, layer := range image.Layers {
+		contents, err := ioutil.ReadFile(layer.File)
+		if err != nil {
+			return nil, err
+		}
+
+		report.Layers = append(report.Layers, types.ReportLayer{
+			ImageLayerDigest: layer.Digest,
+			File:             layer.File,
+			SBOMFile:         layer.SBOMFile,
+			CodeSha256:       publish.CodeSha256(contents),
+			CodeSize:         int64(len(contents)),
+			Status:           types.LayerStatusNotPublished,
+			Signed:           layer.Signed,
+			Part:             layer.Part,
+			FlattenedDigests: layer.FlattenedDigests,
+			Extensions:       extensionNames(layer),
+			BundledLibraries: layer.BundledLibraries,
+			PrunedFiles:      layer.PrunedFiles,
+			PrunedBytes:      layer.PrunedBytes,
+		})
+	}
+	return report, nil
+}
+
+func extensionNames(layer types.LambdaLayer) []string {
+	var names []string
+	for _, extension := range layer.Extensions {
+		names = append(names, extension.Name)
+	}
+	return names
+}
+
+// Writes the report of this run to report.json in the given directory
+func WriteReport(dir string, report *types.Report) (string, error) {
+	contents, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	reportPath := filepath.Join(dir, "report.json")
+	if err := atomicfile.WriteFile(reportPath, contents, 0644); err != nil {
+		return "", err
+	}
+
+	return reportPath, nil
+}
@@ -0,0 +1,148 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package report
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRunReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	layerFile := filepath.Join(dir, "layer-1.zip")
+	err = ioutil.WriteFile(layerFile, []byte("hello world 3"), 0644)
+	assert.Nil(t, err)
+
+	image := &types.RepackedImage{
+		Name:           "docker-daemon:test-image:latest",
+		ManifestDigest: "sha256:abc",
+		Layers:         []types.LambdaLayer{{Digest: "sha256:1", File: layerFile}},
+		Function:       &types.LambdaDeploymentPackage{FileCount: 2, File: filepath.Join(dir, "function.zip")},
+	}
+
+	report, err := NewReport(image, nil)
+	assert.Nil(t, err)
+
+	reportPath, err := WriteReport(dir, report)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, "report.json"), reportPath)
+
+	contents, err := ioutil.ReadFile(reportPath)
+	assert.Nil(t, err)
+	var written types.Report
+	err = json.Unmarshal(contents, &written)
+	assert.Nil(t, err)
+	assert.Equal(t, *report, written)
+
+	assert.Equal(t, "docker-daemon:test-image:latest", report.Image)
+	assert.Equal(t, "sha256:abc", report.ManifestDigest)
+	assert.False(t, report.Published)
+	assert.Equal(t, 2, report.Function.FileCount)
+	assert.Equal(t, []types.ReportLayer{{
+		ImageLayerDigest: "sha256:1",
+		File:             layerFile,
+		CodeSha256:       "T/q7q052MgJGLfH1mBGUQSFYjwVn9VvOWBoOmevPZgY=",
+		CodeSize:         13,
+		Status:           types.LayerStatusNotPublished,
+	}}, report.Layers)
+}
+
+func TestPublishedReport(t *testing.T) {
+	image := &types.RepackedImage{
+		Name:           "docker-daemon:test-image:latest",
+		ManifestDigest: "sha256:abc",
+		Layers: []types.LambdaLayer{
+			{Digest: "sha256:1", File: "layer-1.zip"},
+			{Digest: "sha256:2", File: "layer-2.zip"},
+		},
+		Function: &types.LambdaDeploymentPackage{FileCount: 0, File: "function.zip"},
+	}
+
+	published := &types.PublishedLayers{
+		Layers: []types.PublishedLayer{
+			{
+				Layer:      image.Layers[0],
+				CodeSha256: "hash1",
+				CodeSize:   10,
+				Matched:    true,
+				Arn:        "arn:aws:lambda:us-east-1:123456789012:layer:img2lambda-sha256-1:3",
+				Version:    3,
+			},
+			{
+				Layer:      image.Layers[1],
+				CodeSha256: "hash2",
+				CodeSize:   20,
+				Arn:        "arn:aws:lambda:us-east-1:123456789012:layer:img2lambda-sha256-2:1",
+				Version:    1,
+			},
+		},
+	}
+
+	report, err := NewReport(image, published)
+	assert.Nil(t, err)
+
+	assert.True(t, report.Published)
+	assert.Equal(t, types.ReportFunction{}, report.Function)
+	assert.Len(t, report.Layers, 2)
+	assert.Equal(t, types.LayerStatusMatched, report.Layers[0].Status)
+	assert.Equal(t, int64(3), report.Layers[0].Version)
+	assert.Equal(t, "layer-1.zip", report.Layers[0].File)
+	assert.Equal(t, types.LayerStatusPublished, report.Layers[1].Status)
+	assert.Equal(t, "arn:aws:lambda:us-east-1:123456789012:layer:img2lambda-sha256-2:1", report.Layers[1].Arn)
+	assert.Equal(t, "hash2", report.Layers[1].CodeSha256)
+}
+
+func TestReportExtensions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	layerFile := filepath.Join(dir, "extensions.zip")
+	err = ioutil.WriteFile(layerFile, []byte("hello world 3"), 0644)
+	assert.Nil(t, err)
+
+	extension := types.LambdaExtension{Name: "my-extension", Path: "/opt/extensions/my-extension", ImageLayerDigest: "sha256:1"}
+	image := &types.RepackedImage{
+		Name:   "docker-daemon:test-image:latest",
+		Layers: []types.LambdaLayer{{Digest: "sha256:2", File: layerFile, Extensions: []types.LambdaExtension{extension}}},
+	}
+
+	report, err := NewReport(image, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []types.LambdaExtension{extension}, report.Extensions)
+	assert.Equal(t, []string{"my-extension"}, report.Layers[0].Extensions)
+}
+
+func TestReportPrunedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	layerFile := filepath.Join(dir, "layer-1.zip")
+	err = ioutil.WriteFile(layerFile, []byte("hello world 4"), 0644)
+	assert.Nil(t, err)
+
+	image := &types.RepackedImage{
+		Name:        "docker-daemon:test-image:latest",
+		Environment: "python",
+		Layers:      []types.LambdaLayer{{Digest: "sha256:1", File: layerFile, PrunedFiles: 2, PrunedBytes: 300}},
+		Function:    &types.LambdaDeploymentPackage{FileCount: 1, File: filepath.Join(dir, "function.zip"), PrunedFiles: 1, PrunedBytes: 100},
+	}
+
+	report, err := NewReport(image, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "python", report.Environment)
+	assert.Equal(t, 2, report.Layers[0].PrunedFiles)
+	assert.Equal(t, int64(300), report.Layers[0].PrunedBytes)
+	assert.Equal(t, 1, report.Function.PrunedFiles)
+	assert.Equal(t, int64(100), report.Function.PrunedBytes)
+}
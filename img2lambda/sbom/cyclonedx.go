@@ -0,0 +1,102 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package sbom
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/internal/atomicfile"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/version"
+)
+
+// Subset of the CycloneDX 1.3 JSON format (https://cyclonedx.org/docs/1.3/json/)
+type cycloneDXDocument struct {
+	BOMFormat   string               `json:"bomFormat"`
+	SpecVersion string               `json:"specVersion"`
+	Version     int                  `json:"version"`
+	Metadata    cycloneDXMetadata    `json:"metadata"`
+	Components  []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string             `json:"timestamp"`
+	Tools     []cycloneDXTool    `json:"tools"`
+	Component cycloneDXComponent `json:"component"`
+}
+
+type cycloneDXTool struct {
+	Vendor  string `json:"vendor"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type cycloneDXComponent struct {
+	Type       string              `json:"type"`
+	Name       string              `json:"name"`
+	Group      string              `json:"group,omitempty"`
+	Version    string              `json:"version,omitempty"`
+	PURL       string              `json:"purl,omitempty"`
+	Properties []cycloneDXProperty `json:"properties,omitempty"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Describes the Lambda artifact (layer or function deployment package) that an SBOM is written for
+type Subject struct {
+	Name             string // File name of the Lambda artifact
+	ImageName        string // Source container image
+	ImageLayerDigest string // Source container image layer; empty for function deployment packages
+}
+
+// Writes a CycloneDX JSON SBOM listing the given packages
+func WriteCycloneDX(filename string, subject Subject, packages []Package) error {
+	doc := cycloneDXDocument{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: "1.3",
+		Version:     1,
+		Metadata: cycloneDXMetadata{
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Tools: []cycloneDXTool{
+				{Vendor: "Amazon Web Services", Name: "img2lambda", Version: version.Version},
+			},
+			Component: cycloneDXComponent{
+				Type: "file",
+				Name: subject.Name,
+				Properties: []cycloneDXProperty{
+					{Name: "img2lambda:image", Value: subject.ImageName},
+				},
+			},
+		},
+		Components: []cycloneDXComponent{},
+	}
+
+	if subject.ImageLayerDigest != "" {
+		doc.Metadata.Component.Version = subject.ImageLayerDigest
+		doc.Metadata.Component.Properties = append(doc.Metadata.Component.Properties,
+			cycloneDXProperty{Name: "img2lambda:image-layer-digest", Value: subject.ImageLayerDigest})
+	}
+
+	for _, p := range Dedupe(packages) {
+		doc.Components = append(doc.Components, cycloneDXComponent{
+			Type:    "library",
+			Name:    p.Name,
+			Group:   p.Namespace,
+			Version: p.Version,
+			PURL:    p.PURL(),
+			Properties: []cycloneDXProperty{
+				{Name: "img2lambda:metadata-file", Value: p.Path},
+			},
+		})
+	}
+
+	contents, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.WriteFile(filename, contents, 0644)
+}
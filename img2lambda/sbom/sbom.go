@@ -0,0 +1,325 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package sbom
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Largest metadata file that will be buffered in memory to detect packages
+const MaxMetadataFileSize = 64 * 1024 * 1024
+
+// Package ecosystems, named after their package URL types
+const (
+	TypePyPI  = "pypi"
+	TypeNpm   = "npm"
+	TypeGem   = "gem"
+	TypeMaven = "maven"
+	TypeDeb   = "deb"
+)
+
+// A software package detected from metadata files in a container image layer
+type Package struct {
+	Type      string
+	Namespace string
+	Name      string
+	Version   string
+	Path      string // Path of the metadata file in the container image layer
+}
+
+// Package URL (https://github.com/package-url/purl-spec) identifying the package
+func (p Package) PURL() string {
+	purl := "pkg:" + p.Type + "/"
+	if p.Namespace != "" {
+		purl += escapePURLSegment(p.Namespace) + "/"
+	}
+	purl += escapePURLSegment(p.Name)
+	if p.Version != "" {
+		purl += "@" + escapePURLSegment(p.Version)
+	}
+	return purl
+}
+
+// '@' separates the version in package URLs, so it must be encoded in the other segments
+func escapePURLSegment(segment string) string {
+	return strings.Replace(url.PathEscape(segment), "@", "%40", -1)
+}
+
+var gemspecNameRegexp = regexp.MustCompile(`\.name\s*=\s*["']([^"']+)["']`)
+var gemspecVersionRegexp = regexp.MustCompile(`\.version\s*=\s*["']([^"']+)["']`)
+
+// Determines if the given layer file contains package metadata that can be parsed by Parse
+func IsMetadataFile(filename string) bool {
+	dir, base := path.Split(filename)
+	dir = strings.TrimSuffix(dir, "/")
+
+	switch {
+	case base == "METADATA" && strings.HasSuffix(dir, ".dist-info"):
+		return true
+	case base == "PKG-INFO" && strings.HasSuffix(dir, ".egg-info"):
+		return true
+	case base == "package.json":
+		return true
+	case strings.HasSuffix(base, ".gemspec") && path.Base(dir) == "specifications":
+		return true
+	case base == "pom.properties":
+		return true
+	case base == "status" && path.Base(dir) == "dpkg":
+		return true
+	case path.Base(dir) == "status.d" && path.Base(path.Dir(dir)) == "dpkg":
+		return true
+	}
+
+	return false
+}
+
+// Parses the packages described by a metadata file found in a container image layer
+func Parse(filename string, contents []byte) ([]Package, error) {
+	base := path.Base(filename)
+
+	var packages []Package
+	var err error
+
+	switch {
+	case base == "METADATA" || base == "PKG-INFO":
+		packages = parsePythonMetadata(contents)
+	case base == "package.json":
+		packages, err = parsePackageJSON(contents)
+	case strings.HasSuffix(base, ".gemspec"):
+		packages = parseGemspec(contents)
+	case base == "pom.properties":
+		packages = parsePomProperties(contents)
+	default:
+		packages = parseDpkgStatus(contents)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("parsing package metadata %s: %v", filename, err)
+	}
+
+	for i := range packages {
+		packages[i].Path = filename
+	}
+	return packages, nil
+}
+
+// Sorts packages by package URL and removes duplicates
+func Dedupe(packages []Package) []Package {
+	seen := make(map[string]bool)
+	var result []Package
+	for _, p := range packages {
+		purl := p.PURL()
+		if seen[purl] {
+			continue
+		}
+		seen[purl] = true
+		result = append(result, p)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].PURL() < result[j].PURL()
+	})
+	return result
+}
+
+// Parses RFC 822 style headers. Blank lines either end parsing or are reported as an empty key (end of stanza).
+func parseHeaders(contents []byte, stopAtBlankLine bool, fn func(key string, value string)) {
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			if stopAtBlankLine {
+				return
+			}
+			fn("", "")
+			continue
+		}
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			continue // continuation line
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		fn(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+}
+
+func parsePythonMetadata(contents []byte) []Package {
+	p := Package{Type: TypePyPI}
+	parseHeaders(contents, true, func(key string, value string) {
+		switch key {
+		case "Name":
+			p.Name = value
+		case "Version":
+			p.Version = value
+		}
+	})
+
+	if p.Name == "" {
+		return nil
+	}
+	return []Package{p}
+}
+
+func parsePackageJSON(contents []byte) ([]Package, error) {
+	var manifest struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(contents, &manifest); err != nil {
+		return nil, err
+	}
+
+	// package.json files without a version are usually not published packages
+	if manifest.Name == "" || manifest.Version == "" {
+		return nil, nil
+	}
+
+	p := Package{Type: TypeNpm, Name: manifest.Name, Version: manifest.Version}
+	if strings.HasPrefix(p.Name, "@") && strings.Contains(p.Name, "/") {
+		parts := strings.SplitN(p.Name, "/", 2)
+		p.Namespace = parts[0]
+		p.Name = parts[1]
+	}
+	return []Package{p}, nil
+}
+
+func parseGemspec(contents []byte) []Package {
+	name := gemspecNameRegexp.FindSubmatch(contents)
+	if name == nil {
+		return nil
+	}
+
+	p := Package{Type: TypeGem, Name: string(name[1])}
+	if version := gemspecVersionRegexp.FindSubmatch(contents); version != nil {
+		p.Version = string(version[1])
+	}
+	return []Package{p}
+}
+
+func parsePomProperties(contents []byte) []Package {
+	p := Package{Type: TypeMaven}
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		switch strings.TrimSpace(parts[0]) {
+		case "groupId":
+			p.Namespace = strings.TrimSpace(parts[1])
+		case "artifactId":
+			p.Name = strings.TrimSpace(parts[1])
+		case "version":
+			p.Version = strings.TrimSpace(parts[1])
+		}
+	}
+
+	if p.Name == "" {
+		return nil
+	}
+	return []Package{p}
+}
+
+// Determines if the given layer file is an RPM database (Berkeley DB, SQLite or NDB), which is not parsed,
+// so that the packages missing from the SBOM can be reported
+func IsRPMDatabase(filename string) bool {
+	switch path.Base(filename) {
+	case "Packages", "rpmdb.sqlite", "Packages.db":
+		return path.Base(path.Dir(filename)) == "rpm"
+	}
+	return false
+}
+
+// Determines if the given layer file is a Java archive that can be parsed by ParseJar
+func IsJar(filename string) bool {
+	return strings.HasSuffix(path.Base(filename), ".jar")
+}
+
+// Parses the packages described by the Maven metadata in a Java archive found in a container image layer.
+// Only the META-INF/maven/**/pom.properties entries are read, so the archive is not buffered in memory.
+func ParseJar(filename string, r io.ReaderAt, size int64) ([]Package, error) {
+	packages, err := parseJar(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("parsing package metadata %s: %v", filename, err)
+	}
+
+	for i := range packages {
+		packages[i].Path = filename
+	}
+	return packages, nil
+}
+
+func parseJar(r io.ReaderAt, size int64) ([]Package, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	var packages []Package
+	for _, zf := range zr.File {
+		if !strings.HasPrefix(zf.Name, "META-INF/maven/") || path.Base(zf.Name) != "pom.properties" {
+			continue
+		}
+
+		rc, err := zf.Open()
+		if err != nil {
+			return nil, err
+		}
+		properties, err := ioutil.ReadAll(io.LimitReader(rc, MaxMetadataFileSize))
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		packages = append(packages, parsePomProperties(properties)...)
+	}
+	return packages, nil
+}
+
+func parseDpkgStatus(contents []byte) []Package {
+	var packages []Package
+	current := Package{Type: TypeDeb, Namespace: "debian"}
+	installed := true
+
+	flush := func() {
+		if current.Name != "" && installed {
+			packages = append(packages, current)
+		}
+		current = Package{Type: TypeDeb, Namespace: "debian"}
+		installed = true
+	}
+
+	parseHeaders(contents, false, func(key string, value string) {
+		switch key {
+		case "":
+			flush()
+		case "Package":
+			current.Name = value
+		case "Version":
+			current.Version = value
+		case "Status":
+			installed = strings.HasSuffix(value, " installed")
+		}
+	})
+	flush()
+
+	return packages
+}
@@ -0,0 +1,137 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package sbom
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsMetadataFile(t *testing.T) {
+	assert.True(t, IsMetadataFile("opt/python/requests-2.24.0.dist-info/METADATA"))
+	assert.True(t, IsMetadataFile("opt/python/six.egg-info/PKG-INFO"))
+	assert.True(t, IsMetadataFile("var/task/node_modules/left-pad/package.json"))
+	assert.True(t, IsMetadataFile("opt/ruby/gems/2.7.0/specifications/rack-2.2.3.gemspec"))
+	assert.True(t, IsMetadataFile("opt/var/lib/dpkg/status"))
+	assert.True(t, IsMetadataFile("opt/var/lib/dpkg/status.d/libc6"))
+
+	assert.False(t, IsMetadataFile("opt/python/requests/METADATA"))
+	assert.False(t, IsMetadataFile("opt/ruby/rack.gemspec"))
+	assert.False(t, IsMetadataFile("var/task/status"))
+	assert.False(t, IsMetadataFile("var/task/hello.py"))
+
+	// Java archives are parsed by ParseJar, without buffering them in memory
+	assert.False(t, IsMetadataFile("opt/java/lib/jackson-core-2.11.0.jar"))
+	assert.True(t, IsJar("opt/java/lib/jackson-core-2.11.0.jar"))
+	assert.False(t, IsJar("opt/java/lib/META-INF/MANIFEST.MF"))
+
+	// RPM databases are only recognized to report that they are not read
+	assert.False(t, IsMetadataFile("opt/var/lib/rpm/Packages"))
+	assert.True(t, IsRPMDatabase("opt/var/lib/rpm/Packages"))
+	assert.True(t, IsRPMDatabase("opt/usr/lib/sysimage/rpm/rpmdb.sqlite"))
+	assert.False(t, IsRPMDatabase("opt/python/Packages"))
+}
+
+func TestParsePythonMetadata(t *testing.T) {
+	contents := "Metadata-Version: 2.1\nName: requests\nVersion: 2.24.0\nSummary: Python HTTP for Humans.\n\nName: not-a-header\n"
+
+	packages, err := Parse("opt/python/requests-2.24.0.dist-info/METADATA", []byte(contents))
+	assert.Nil(t, err)
+	assert.Len(t, packages, 1)
+	assert.Equal(t, "pkg:pypi/requests@2.24.0", packages[0].PURL())
+	assert.Equal(t, "opt/python/requests-2.24.0.dist-info/METADATA", packages[0].Path)
+}
+
+func TestParsePackageJSON(t *testing.T) {
+	packages, err := Parse("var/task/node_modules/@aws/foo/package.json", []byte(`{"name": "@aws/foo", "version": "1.0.0"}`))
+	assert.Nil(t, err)
+	assert.Len(t, packages, 1)
+	assert.Equal(t, "pkg:npm/%40aws/foo@1.0.0", packages[0].PURL())
+
+	// Unversioned package.json files are not packages
+	packages, err = Parse("var/task/test/package.json", []byte(`{"name": "test"}`))
+	assert.Nil(t, err)
+	assert.Len(t, packages, 0)
+
+	_, err = Parse("var/task/package.json", []byte(`{`))
+	assert.NotNil(t, err)
+}
+
+func TestParseGemspec(t *testing.T) {
+	contents := "Gem::Specification.new do |s|\n  s.name = \"rack\".freeze\n  s.version = \"2.2.3\"\nend\n"
+
+	packages, err := Parse("opt/ruby/gems/2.7.0/specifications/rack-2.2.3.gemspec", []byte(contents))
+	assert.Nil(t, err)
+	assert.Len(t, packages, 1)
+	assert.Equal(t, "pkg:gem/rack@2.2.3", packages[0].PURL())
+}
+
+func TestParseJar(t *testing.T) {
+	var jar bytes.Buffer
+	zw := zip.NewWriter(&jar)
+	w, err := zw.Create("META-INF/maven/com.fasterxml.jackson.core/jackson-core/pom.properties")
+	assert.Nil(t, err)
+	_, err = w.Write([]byte("#Generated by Maven\nversion=2.11.0\ngroupId=com.fasterxml.jackson.core\nartifactId=jackson-core\n"))
+	assert.Nil(t, err)
+	_, err = zw.Create("com/fasterxml/jackson/core/JsonParser.class")
+	assert.Nil(t, err)
+	assert.Nil(t, zw.Close())
+
+	packages, err := ParseJar("opt/java/lib/jackson-core-2.11.0.jar", bytes.NewReader(jar.Bytes()), int64(jar.Len()))
+	assert.Nil(t, err)
+	assert.Len(t, packages, 1)
+	assert.Equal(t, "pkg:maven/com.fasterxml.jackson.core/jackson-core@2.11.0", packages[0].PURL())
+	assert.Equal(t, "opt/java/lib/jackson-core-2.11.0.jar", packages[0].Path)
+
+	_, err = ParseJar("opt/java/lib/broken.jar", strings.NewReader("hello world"), 11)
+	assert.NotNil(t, err)
+}
+
+func TestParseDpkgStatus(t *testing.T) {
+	contents := "Package: libc6\nStatus: install ok installed\nVersion: 2.28-10\nDescription: GNU C Library\n multi-line description\n\n" +
+		"Package: removed\nStatus: deinstall ok config-files\nVersion: 1.0\n\n" +
+		"Package: zlib1g\nStatus: install ok installed\nVersion: 1:1.2.11.dfsg-1\n"
+
+	packages, err := Parse("opt/var/lib/dpkg/status", []byte(contents))
+	assert.Nil(t, err)
+	assert.Len(t, packages, 2)
+	assert.Equal(t, "pkg:deb/debian/libc6@2.28-10", packages[0].PURL())
+	assert.Equal(t, "pkg:deb/debian/zlib1g@1:1.2.11.dfsg-1", packages[1].PURL())
+}
+
+func TestWriteCycloneDX(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	packages := []Package{
+		{Type: TypePyPI, Name: "six", Version: "1.15.0", Path: "opt/python/six-1.15.0.dist-info/METADATA"},
+		{Type: TypeGem, Name: "rack", Version: "2.2.3", Path: "opt/ruby/specifications/rack-2.2.3.gemspec"},
+		{Type: TypePyPI, Name: "six", Version: "1.15.0", Path: "opt/python/six-1.15.0.dist-info/METADATA"},
+	}
+
+	filename := filepath.Join(dir, "sha256-1.cdx.json")
+	err = WriteCycloneDX(filename, Subject{Name: "layer-1.zip", ImageName: "test-image", ImageLayerDigest: "sha256:1"}, packages)
+	assert.Nil(t, err)
+
+	contents, err := ioutil.ReadFile(filename)
+	assert.Nil(t, err)
+	var doc cycloneDXDocument
+	err = json.Unmarshal(contents, &doc)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "CycloneDX", doc.BOMFormat)
+	assert.Equal(t, "layer-1.zip", doc.Metadata.Component.Name)
+	assert.Equal(t, "sha256:1", doc.Metadata.Component.Version)
+	assert.Len(t, doc.Components, 2)
+	assert.Equal(t, "pkg:gem/rack@2.2.3", doc.Components[0].PURL)
+	assert.Equal(t, "pkg:pypi/six@1.15.0", doc.Components[1].PURL)
+}
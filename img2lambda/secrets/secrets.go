@@ -0,0 +1,216 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package secrets
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	zglob "github.com/mattn/go-zglob"
+)
+
+// Number of bytes carried over between writes, so that secrets split across writes are still found
+const scanOverlap = 256
+
+// A potential secret found in a file that would be packaged into a Lambda layer or function
+type Finding struct {
+	Rule        string `json:"rule"`
+	Description string `json:"description"`
+	Path        string `json:"path"` // Path of the file in the container image layer
+	LayerDigest string `json:"imageLayerDigest"`
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s (rule %s) in image layer %s", f.Path, f.Description, f.Rule, f.LayerDigest)
+}
+
+// Fails if any of the findings is not allowed by the allowlist, which may be nil
+func Check(findings []Finding, allowlist *Allowlist) error {
+	var lines []string
+	for _, finding := range findings {
+		if !allowlist.Allows(finding) {
+			lines = append(lines, finding.String())
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return fmt.Errorf("found %d potential secrets in files packaged for Lambda (add false positives to a secrets allowlist file):\n  %s",
+		len(lines), strings.Join(lines, "\n  "))
+}
+
+type nameRule struct {
+	id          string
+	description string
+	match       func(filename string) bool
+}
+
+type contentRule struct {
+	id          string
+	description string
+	pattern     *regexp.Regexp
+	files       func(filename string) bool // Files the rule applies to, or nil for all files
+}
+
+var nameRules = []nameRule{
+	{
+		id:          "dotenv-file",
+		description: "environment file",
+		match: func(filename string) bool {
+			base := path.Base(filename)
+			return base == ".env" || strings.HasPrefix(base, ".env.")
+		},
+	},
+	{
+		id:          "git-directory",
+		description: "file in a git directory",
+		match: func(filename string) bool {
+			return strings.HasPrefix(filename, ".git/") || strings.Contains(filename, "/.git/")
+		},
+	},
+}
+
+var contentRules = []contentRule{
+	{
+		id:          "aws-access-key-id",
+		description: "AWS access key ID",
+		pattern:     regexp.MustCompile(`\b(AKIA|ASIA)[A-Z0-9]{16}\b`),
+	},
+	{
+		id:          "aws-secret-access-key",
+		description: "AWS secret access key",
+		pattern:     regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?[A-Za-z0-9/+=]{40}`),
+	},
+	{
+		id:          "private-key",
+		description: "private key",
+		pattern:     regexp.MustCompile(`-----BEGIN ((RSA|DSA|EC|OPENSSH|PGP|ENCRYPTED) )?PRIVATE KEY( BLOCK)?-----`),
+	},
+	{
+		id:          "npm-token",
+		description: "npm auth token",
+		pattern:     regexp.MustCompile(`\bnpm_[A-Za-z0-9]{36}\b`),
+	},
+	{
+		id:          "npm-token",
+		description: "npm auth token",
+		pattern:     regexp.MustCompile(`_authToken\s*=\s*\S+`),
+		files: func(filename string) bool {
+			return path.Base(filename) == ".npmrc"
+		},
+	},
+}
+
+// Checks the file name against the name-based rules
+func ScanName(filename string) []Finding {
+	var findings []Finding
+	for _, rule := range nameRules {
+		if rule.match(filename) {
+			findings = append(findings, Finding{Rule: rule.id, Description: rule.description, Path: filename})
+		}
+	}
+	return findings
+}
+
+// Scans file contents as they are written to it, for use with io.TeeReader
+type ContentScanner struct {
+	filename string
+	tail     []byte
+	found    map[string]bool
+	findings []Finding
+}
+
+func NewContentScanner(filename string) *ContentScanner {
+	return &ContentScanner{filename: filename, found: make(map[string]bool)}
+}
+
+func (s *ContentScanner) Write(p []byte) (int, error) {
+	buf := append(s.tail, p...)
+
+	for _, rule := range contentRules {
+		if rule.files != nil && !rule.files(s.filename) {
+			continue
+		}
+		if !s.found[rule.id] && rule.pattern.Match(buf) {
+			s.found[rule.id] = true
+			s.findings = append(s.findings, Finding{Rule: rule.id, Description: rule.description, Path: s.filename})
+		}
+	}
+
+	if len(buf) > scanOverlap {
+		buf = buf[len(buf)-scanOverlap:]
+	}
+	s.tail = append([]byte{}, buf...)
+
+	return len(p), nil
+}
+
+// Findings in the contents written so far, at most one per rule
+func (s *ContentScanner) Findings() []Finding {
+	return s.findings
+}
+
+// Suppresses findings that are known to be safe. Each line of an allowlist file
+// is a glob matching file paths in the image (for example 'opt/app/.env.example'),
+// optionally preceded by a rule ID to only suppress that rule. Lines starting with # are ignored.
+type Allowlist struct {
+	entries []allowlistEntry
+}
+
+type allowlistEntry struct {
+	rule string
+	glob string
+}
+
+func LoadAllowlist(filename string) (*Allowlist, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("opening secrets allowlist: %v", err)
+	}
+	defer file.Close()
+
+	allowlist := &Allowlist{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		switch len(fields) {
+		case 1:
+			allowlist.entries = append(allowlist.entries, allowlistEntry{glob: fields[0]})
+		case 2:
+			allowlist.entries = append(allowlist.entries, allowlistEntry{rule: fields[0], glob: fields[1]})
+		default:
+			return nil, fmt.Errorf("invalid secrets allowlist entry %q: expected '[rule] <path glob>'", line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading secrets allowlist: %v", err)
+	}
+
+	return allowlist, nil
+}
+
+// Determines if the finding is suppressed by an allowlist entry. A nil allowlist suppresses nothing.
+func (a *Allowlist) Allows(finding Finding) bool {
+	if a == nil {
+		return false
+	}
+
+	for _, entry := range a.entries {
+		if entry.rule != "" && entry.rule != finding.Rule {
+			continue
+		}
+		if matched, err := zglob.Match(entry.glob, finding.Path); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
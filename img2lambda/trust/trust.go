@@ -0,0 +1,186 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+// Package trust verifies the signatures of source images before they are converted,
+// with a containers/image signature policy or a cosign public key.
+package trust
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
+	"github.com/containers/image/v5/image"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/signature"
+)
+
+// Type of the payloads signed by 'cosign sign'
+const cosignSignatureType = "cosign container image signature"
+
+// Whether any signature checks are configured
+func Enabled(opts *types.SignatureOptions) bool {
+	return opts != nil && (opts.PolicyFile != "" || opts.CosignKey != "")
+}
+
+// Verifies the manifest of the unparsed image against the signature policy and cosign signature in the options.
+// The caller must build the image from the same unparsed image, so that the verified manifest is the one converted.
+// Returns nil if no signature checks are configured.
+func Verify(ctx context.Context, unparsed *image.UnparsedImage, opts *types.SignatureOptions) (*types.SignatureVerification, error) {
+	if !Enabled(opts) {
+		return nil, nil
+	}
+
+	manifestBytes, _, err := unparsed.Manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	manifestDigest, err := manifest.Digest(manifestBytes)
+	if err != nil {
+		return nil, err
+	}
+	verification := &types.SignatureVerification{ManifestDigest: string(manifestDigest)}
+
+	if opts.PolicyFile != "" {
+		if err := verifyPolicy(ctx, unparsed, opts.PolicyFile); err != nil {
+			return nil, err
+		}
+		verification.PolicyFile = opts.PolicyFile
+	}
+
+	if opts.CosignKey != "" {
+		identity, err := verifyCosign(string(manifestDigest), opts)
+		if err != nil {
+			return nil, fmt.Errorf("cosign signature verification failed: %v", err)
+		}
+		verification.CosignKey = opts.CosignKey
+		verification.SignedIdentity = identity
+	}
+
+	return verification, nil
+}
+
+func verifyPolicy(ctx context.Context, unparsed *image.UnparsedImage, policyFile string) (retErr error) {
+	policy, err := signature.NewPolicyFromFile(policyFile)
+	if err != nil {
+		return fmt.Errorf("loading signature policy: %v", err)
+	}
+	policyContext, err := signature.NewPolicyContext(policy)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := policyContext.Destroy(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	allowed, err := policyContext.IsRunningImageAllowed(ctx, unparsed)
+	if !allowed {
+		if err == nil {
+			err = errors.New("rejected")
+		}
+		return fmt.Errorf("image is not allowed by signature policy %s: %v", policyFile, err)
+	}
+	return nil
+}
+
+// Payload of a cosign signature, in the simple signing format
+type cosignPayload struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+// Verifies the cosign signature of the payload and that the payload is for the given manifest digest.
+// Returns the Docker reference that was signed.
+func verifyCosign(manifestDigest string, opts *types.SignatureOptions) (string, error) {
+	if opts.CosignSignature == "" || opts.CosignPayload == "" {
+		return "", errors.New("a cosign signature and payload are required to verify with a cosign key")
+	}
+
+	key, err := loadPublicKey(opts.CosignKey)
+	if err != nil {
+		return "", err
+	}
+
+	encodedSignature, err := ioutil.ReadFile(opts.CosignSignature)
+	if err != nil {
+		return "", err
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encodedSignature)))
+	if err != nil {
+		return "", fmt.Errorf("decoding signature %s: %v", opts.CosignSignature, err)
+	}
+
+	payload, err := ioutil.ReadFile(opts.CosignPayload)
+	if err != nil {
+		return "", err
+	}
+
+	var ecdsaSig struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(sig, &ecdsaSig); err != nil {
+		return "", fmt.Errorf("parsing signature %s: %v", opts.CosignSignature, err)
+	}
+	hash := sha256.Sum256(payload)
+	if !ecdsa.Verify(key, hash[:], ecdsaSig.R, ecdsaSig.S) {
+		return "", fmt.Errorf("signature %s of payload %s does not match key %s", opts.CosignSignature, opts.CosignPayload, opts.CosignKey)
+	}
+
+	// Only trust the contents of the payload after verifying its signature
+	var parsed cosignPayload
+	if err := json.Unmarshal(payload, &parsed); err != nil {
+		return "", fmt.Errorf("parsing payload %s: %v", opts.CosignPayload, err)
+	}
+	if parsed.Critical.Type != cosignSignatureType {
+		return "", fmt.Errorf("payload %s has unexpected type %q", opts.CosignPayload, parsed.Critical.Type)
+	}
+	if parsed.Critical.Image.DockerManifestDigest != manifestDigest {
+		return "", fmt.Errorf("payload %s signs manifest %s, but the image manifest is %s",
+			opts.CosignPayload, parsed.Critical.Image.DockerManifestDigest, manifestDigest)
+	}
+
+	return parsed.Critical.Identity.DockerReference, nil
+}
+
+// Loads an ECDSA public key in PEM format, as written by 'cosign generate-key-pair'
+func loadPublicKey(filename string) (*ecdsa.PublicKey, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(contents)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM-encoded public key found in %s", filename)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing public key %s: %v", filename, err)
+	}
+
+	ecdsaKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key %s is a %T, but cosign keys must be ECDSA keys", filename, key)
+	}
+	return ecdsaKey, nil
+}
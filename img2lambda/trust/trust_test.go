@@ -0,0 +1,202 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package trust
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
+	"github.com/containers/image/v5/image"
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testImageDir = "../converter/testdata/dir-image"
+
+	// Digest of testImageDir/manifest.json
+	testManifestDigest = "sha256:bfc30393df02b201127353d1c1ccb8507a9a2482cda6815620d27553abd2704a"
+
+	// Signed by testdata/public-key.gpg in testdata/dir-image.signature
+	testSignedIdentity = "example.com/lambda-php:latest"
+)
+
+func verifyImage(t *testing.T, imageDir string, opts *types.SignatureOptions) (*types.SignatureVerification, error) {
+	ref, err := alltransports.ParseImageName("dir:" + imageDir)
+	require.NoError(t, err)
+	src, err := ref.NewImageSource(context.Background(), nil)
+	require.NoError(t, err)
+	defer src.Close()
+
+	return Verify(context.Background(), image.UnparsedInstance(src, nil), opts)
+}
+
+func writePolicy(t *testing.T, dir string, requirement string) string {
+	policyFile := filepath.Join(dir, "policy.json")
+	policy := fmt.Sprintf(`{"default": [%s]}`, requirement)
+	require.NoError(t, ioutil.WriteFile(policyFile, []byte(policy), 0644))
+	return policyFile
+}
+
+func signedByPolicy(t *testing.T) string {
+	keyPath, err := filepath.Abs("testdata/public-key.gpg")
+	require.NoError(t, err)
+	return fmt.Sprintf(`{"type": "signedBy", "keyType": "GPGKeys", "keyPath": %q, "signedIdentity": {"type": "exactReference", "dockerReference": %q}}`,
+		keyPath, testSignedIdentity)
+}
+
+// Copy of the test image with the simple signing signature from testdata
+func signedImageDir(t *testing.T, dir string) string {
+	imageDir := filepath.Join(dir, "signed-image")
+	require.NoError(t, os.Mkdir(imageDir, 0755))
+
+	files, err := ioutil.ReadDir(testImageDir)
+	require.NoError(t, err)
+	for _, file := range files {
+		contents, err := ioutil.ReadFile(filepath.Join(testImageDir, file.Name()))
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(imageDir, file.Name()), contents, 0644))
+	}
+
+	signature, err := ioutil.ReadFile("testdata/dir-image.signature")
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(imageDir, "signature-1"), signature, 0644))
+	return imageDir
+}
+
+func TestVerifyWithoutChecks(t *testing.T) {
+	verification, err := verifyImage(t, testImageDir, &types.SignatureOptions{})
+	assert.Nil(t, err)
+	assert.Nil(t, verification)
+}
+
+func TestVerifyPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trust")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	policyFile := writePolicy(t, dir, `{"type": "insecureAcceptAnything"}`)
+	verification, err := verifyImage(t, testImageDir, &types.SignatureOptions{PolicyFile: policyFile})
+	assert.Nil(t, err)
+	assert.Equal(t, &types.SignatureVerification{ManifestDigest: testManifestDigest, PolicyFile: policyFile}, verification)
+
+	policyFile = writePolicy(t, dir, `{"type": "reject"}`)
+	_, err = verifyImage(t, testImageDir, &types.SignatureOptions{PolicyFile: policyFile})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "image is not allowed by signature policy")
+}
+
+func TestVerifyPolicySignedBy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trust")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	opts := &types.SignatureOptions{PolicyFile: writePolicy(t, dir, signedByPolicy(t))}
+
+	verification, err := verifyImage(t, signedImageDir(t, dir), opts)
+	assert.Nil(t, err)
+	assert.Equal(t, testManifestDigest, verification.ManifestDigest)
+
+	// The test image without a signature
+	_, err = verifyImage(t, testImageDir, opts)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no signature exists")
+}
+
+func TestVerifyPolicyFileNotFound(t *testing.T) {
+	_, err := verifyImage(t, testImageDir, &types.SignatureOptions{PolicyFile: "testdata/does-not-exist.json"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "loading signature policy")
+}
+
+// Writes a cosign public key, and a payload for the given manifest digest signed by the key
+func writeCosignFiles(t *testing.T, dir string, manifestDigest string) *types.SignatureOptions {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	opts := &types.SignatureOptions{
+		CosignKey:       filepath.Join(dir, "cosign.pub"),
+		CosignSignature: filepath.Join(dir, "signature"),
+		CosignPayload:   filepath.Join(dir, "payload.json"),
+	}
+	require.NoError(t, ioutil.WriteFile(opts.CosignKey, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}), 0644))
+
+	payload := fmt.Sprintf(`{"critical":{"identity":{"docker-reference":%q},"image":{"docker-manifest-digest":%q},"type":"cosign container image signature"},"optional":null}`,
+		testSignedIdentity, manifestDigest)
+	require.NoError(t, ioutil.WriteFile(opts.CosignPayload, []byte(payload), 0644))
+
+	hash := sha256.Sum256([]byte(payload))
+	r, s, err := ecdsa.Sign(rand.Reader, key, hash[:])
+	require.NoError(t, err)
+	signature, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(opts.CosignSignature, []byte(base64.StdEncoding.EncodeToString(signature)+"\n"), 0644))
+
+	return opts
+}
+
+func TestVerifyCosign(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trust")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	opts := writeCosignFiles(t, dir, testManifestDigest)
+	verification, err := verifyImage(t, testImageDir, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, &types.SignatureVerification{
+		ManifestDigest: testManifestDigest,
+		CosignKey:      opts.CosignKey,
+		SignedIdentity: testSignedIdentity,
+	}, verification)
+}
+
+func TestVerifyCosignWrongDigest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trust")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	opts := writeCosignFiles(t, dir, "sha256:0000000000000000000000000000000000000000000000000000000000000000")
+	_, err = verifyImage(t, testImageDir, opts)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "but the image manifest is "+testManifestDigest)
+}
+
+func TestVerifyCosignWrongKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trust")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	opts := writeCosignFiles(t, dir, testManifestDigest)
+
+	// Replace the public key with another one
+	otherDir := filepath.Join(dir, "other")
+	require.NoError(t, os.Mkdir(otherDir, 0755))
+	opts.CosignKey = writeCosignFiles(t, otherDir, testManifestDigest).CosignKey
+
+	_, err = verifyImage(t, testImageDir, opts)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "does not match key")
+}
+
+func TestVerifyCosignRequiresSignature(t *testing.T) {
+	_, err := verifyImage(t, testImageDir, &types.SignatureOptions{CosignKey: "cosign.pub"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "a cosign signature and payload are required")
+}
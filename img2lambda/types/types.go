@@ -3,52 +3,491 @@
 package types
 
 import (
+	"time"
+
 	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/signer/signeriface"
 	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/clients"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/logging"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/progress"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/secrets"
+	imgtypes "github.com/containers/image/v5/types"
 )
 
 type LambdaDeploymentPackage struct {
-	FileCount int
-	File      string
+	FileCount   int
+	File        string
+	SBOMFile    string
+	Signed      *SignedArtifact // Only set if the deployment package was signed
+	PrunedFiles int             // Files not repacked because the execution environment provides them
+	PrunedBytes int64
 }
 
 type LambdaLayer struct {
-	Digest string
-	File   string
+	Digest           string
+	File             string
+	SBOMFile         string
+	Signed           *SignedArtifact // Only set if the layer was signed
+	Part             int             // Number of the part, starting at 1, only set if the image layer was split into several Lambda layers
+	FlattenedDigests []string        // Image layer digests merged into the layer, only set if they were flattened to apply deleted files
+	Extensions       []LambdaExtension
+	BundledLibraries []string // Sonames of the libraries of the image bundled into lib/, only set for the layer of bundled libraries
+	PrunedFiles      int      // Files of the image layer not repacked because the execution environment provides them
+	PrunedBytes      int64
+}
+
+// Executable in /opt/extensions of a Lambda layer, which Lambda starts as an extension
+type LambdaExtension struct {
+	Name             string `json:"name"`
+	Path             string `json:"path"`
+	ImageLayerDigest string `json:"imageLayerDigest"` // Image layer that the executable is from
+}
+
+// Signed copy of a zip file in S3, written by an AWS Signer signing job
+type SignedArtifact struct {
+	SigningJobID string `json:"signingJobId"`
+	S3Bucket     string `json:"s3Bucket"`
+	S3Key        string `json:"s3Key"`
+}
+
+// Lambda layers and function deployment package repacked from a container image
+type RepackedImage struct {
+	Name             string
+	ManifestDigest   string
+	Verification     *SignatureVerification // Only set if signatures were verified
+	BaseImage        string                 // Base image whose layers were skipped, if any
+	BaseLayerDigests []string               // Digests of the skipped layers of the base image
+	Environment      string                 // Execution environment whose files were pruned, if any
+	Layers           []LambdaLayer
+	Function         *LambdaDeploymentPackage
+	SecretFindings   []secrets.Finding // Potential secrets not allowed by the secrets allowlist, which must not be published
+}
+
+// Signature checks that the source image must pass before it is converted
+type SignatureOptions struct {
+	PolicyFile      string // containers/image policy.json that must allow the image
+	CosignKey       string // PEM-encoded public key of a cosign signature of the image
+	CosignSignature string // Base64-encoded cosign signature, as written by 'cosign sign --output-signature'
+	CosignPayload   string // Payload signed by the cosign signature, as written by 'cosign sign --output-payload'
+}
+
+// Describes how the manifest of the source image was verified
+type SignatureVerification struct {
+	ManifestDigest string `json:"manifestDigest"`
+	PolicyFile     string `json:"policyFile,omitempty"`
+	CosignKey      string `json:"cosignKey,omitempty"`
+	SignedIdentity string `json:"signedIdentity,omitempty"` // Docker reference in the cosign signature payload
+}
+
+// Lambda layer version that a Lambda layer file was matched to or published as
+type PublishedLayer struct {
+	Layer      LambdaLayer
+	Name       string // Name of the Lambda layer
+	CodeSha256 string
+	CodeSize   int64
+	Matched    bool // Matched to an existing layer version instead of publishing a new version
+	Arn        string
+	Version    int64
+}
+
+type PublishedLayers struct {
+	Layers          []PublishedLayer
+	BaseLayerArns   []string // Layer versions of the base image, listed before the layers in the results files
+	LayerArns       []string // All layer versions for the function in order, as written to the results files
+	JSONResultsFile string
+	YAMLResultsFile string
+	ProvenanceFile  string
+}
+
+// Where a published Lambda layer version came from, written to provenance.json next to the results files
+type LayerProvenance struct {
+	LayerName        string `json:"layerName"`
+	LayerVersionArn  string `json:"layerVersionArn"`
+	Matched          bool   `json:"matched"` // Matched to an existing layer version, which was built from the same image layer earlier
+	Image            string `json:"image"`
+	ManifestDigest   string `json:"manifestDigest"`
+	ImageLayerDigest string `json:"imageLayerDigest"`
+	Part             int    `json:"part,omitempty"` // Only set if the image layer was split into several layers
+	ToolVersion      string `json:"toolVersion"`
+	BuildTimestamp   string `json:"buildTimestamp"`
+}
+
+// Describes a whole run of the tool, for parsing by CI systems
+type Report struct {
+	Image          string                 `json:"image"`
+	ManifestDigest string                 `json:"manifestDigest"`
+	Verification   *SignatureVerification `json:"signatureVerification,omitempty"`
+	BaseImage      string                 `json:"baseImage,omitempty"`
+	BaseLayerArns  []string               `json:"baseLayerArns,omitempty"`
+	LayerArns      []string               `json:"layerArns,omitempty"`
+	Published      bool                   `json:"published"`
+	Layers         []ReportLayer          `json:"layers"`
+	Function       ReportFunction         `json:"function"`
+	Extensions     []LambdaExtension      `json:"extensions,omitempty"`
+	Environment    string                 `json:"environment,omitempty"` // Execution environment whose files were pruned
+	SecretFindings []secrets.Finding      `json:"secretFindings,omitempty"`
+}
+
+// Record of a conversion, written to conversion.json in the output directory next to the Lambda layer files
+// and function deployment package, from which another process can publish the layers later
+type ConversionManifest struct {
+	ToolVersion      string                 `json:"toolVersion"`
+	Image            string                 `json:"image"`          // Name of the image as given, like my-image:latest
+	ImageReference   string                 `json:"imageReference"` // containers/image transport reference, like docker-daemon:my-image:latest
+	ManifestDigest   string                 `json:"manifestDigest"`
+	Verification     *SignatureVerification `json:"signatureVerification,omitempty"`
+	BaseImage        string                 `json:"baseImage,omitempty"`
+	BaseLayerDigests []string               `json:"baseLayerDigests,omitempty"`
+	BaseLayerArns    []string               `json:"baseLayerArns,omitempty"`
+	PrependLayerArns []string               `json:"prependLayerArns,omitempty"`
+	AppendLayerArns  []string               `json:"appendLayerArns,omitempty"`
+	Environment      string                 `json:"environment,omitempty"`
+	Layers           []ManifestLayer        `json:"layers"`
+	Function         *ManifestFunction      `json:"function,omitempty"` // Only set if the image has function files
+	SecretFindings   []secrets.Finding      `json:"secretFindings,omitempty"`
+}
+
+type ManifestLayer struct {
+	File             string            `json:"file"` // Relative to the directory of the conversion manifest
+	ImageLayerDigest string            `json:"imageLayerDigest"`
+	CodeSha256       string            `json:"codeSha256"`
+	CodeSize         int64             `json:"codeSize"`
+	SBOMFile         string            `json:"sbomFile,omitempty"`
+	Part             int               `json:"part,omitempty"`
+	FlattenedDigests []string          `json:"flattenedImageLayerDigests,omitempty"`
+	Extensions       []LambdaExtension `json:"extensions,omitempty"`
+	BundledLibraries []string          `json:"bundledLibraries,omitempty"`
+	PrunedFiles      int               `json:"prunedFiles,omitempty"`
+	PrunedBytes      int64             `json:"prunedBytes,omitempty"`
+}
+
+type ManifestFunction struct {
+	File        string `json:"file"` // Relative to the directory of the conversion manifest
+	CodeSha256  string `json:"codeSha256"`
+	CodeSize    int64  `json:"codeSize"`
+	FileCount   int    `json:"fileCount"`
+	SBOMFile    string `json:"sbomFile,omitempty"`
+	PrunedFiles int    `json:"prunedFiles,omitempty"`
+	PrunedBytes int64  `json:"prunedBytes,omitempty"`
+}
+
+// Pins the image to the layer versions published from it, written to img2lambda.lock after publishing.
+// Publishing the same image to several regions adds their layer versions to the lock.
+type Lock struct {
+	ToolVersion    string        `json:"toolVersion"`
+	Image          string        `json:"image"`          // Name of the image as given, like my-image:latest
+	ImageReference string        `json:"imageReference"` // containers/image transport reference, like docker-daemon:my-image:latest
+	ManifestDigest string        `json:"manifestDigest"`
+	Layers         []LockedLayer `json:"layers"`
+}
+
+type LockedLayer struct {
+	ImageLayerDigest string                        `json:"imageLayerDigest"`
+	Part             int                           `json:"part,omitempty"`
+	Versions         map[string]LockedLayerVersion `json:"versions"` // Published layer version by region
+}
+
+type LockedLayerVersion struct {
+	Arn        string `json:"arn"`
+	CodeSha256 string `json:"codeSha256"` // Of the published zip file, which differs between regions for signed layers
+	CodeSize   int64  `json:"codeSize"`
+}
+
+// Difference between a lock and the image or the published layer versions
+type LockDrift struct {
+	ImageLayerDigest string `json:"imageLayerDigest,omitempty"`
+	Arn              string `json:"arn,omitempty"`
+	Message          string `json:"message"`
+}
+
+const (
+	LayerStatusMatched      = "matched"
+	LayerStatusPublished    = "published"
+	LayerStatusNotPublished = "not-published"
+)
+
+type ReportLayer struct {
+	ImageLayerDigest string          `json:"imageLayerDigest"`
+	LayerName        string          `json:"layerName,omitempty"`
+	File             string          `json:"file"`
+	SBOMFile         string          `json:"sbomFile,omitempty"`
+	CodeSha256       string          `json:"codeSha256"`
+	CodeSize         int64           `json:"codeSize"`
+	Status           string          `json:"status"`
+	Arn              string          `json:"arn,omitempty"`
+	Version          int64           `json:"version,omitempty"`
+	Signed           *SignedArtifact `json:"signed,omitempty"`
+	Part             int             `json:"part,omitempty"`
+	FlattenedDigests []string        `json:"flattenedImageLayerDigests,omitempty"`
+	Extensions       []string        `json:"extensions,omitempty"` // Names of the extensions in the layer
+	BundledLibraries []string        `json:"bundledLibraries,omitempty"`
+	PrunedFiles      int             `json:"prunedFiles,omitempty"`
+	PrunedBytes      int64           `json:"prunedBytes,omitempty"`
+}
+
+type ReportFunction struct {
+	File        string          `json:"file,omitempty"`
+	SBOMFile    string          `json:"sbomFile,omitempty"`
+	FileCount   int             `json:"fileCount"`
+	Signed      *SignedArtifact `json:"signed,omitempty"`
+	PrunedFiles int             `json:"prunedFiles,omitempty"`
+	PrunedBytes int64           `json:"prunedBytes,omitempty"`
+}
+
+// Describes what each layer of a container image would be repacked into, without writing anything
+type ImageInspection struct {
+	Image            string           `json:"image"`
+	Layers           []InspectedLayer `json:"layers"`
+	BundledLibraries []string         `json:"bundledLibraries,omitempty"` // Libraries from outside of /opt that would be bundled into a Lambda layer
+}
+
+type InspectedLayer struct {
+	Digest         string          `json:"digest"`
+	MediaType      string          `json:"mediaType"`
+	Size           int64           `json:"size"`
+	Skipped        string          `json:"skipped,omitempty"` // Why the layer is not repacked at all, like 'base image' or 'not selected'
+	LayerFiles     []InspectedFile `json:"layerFiles"`        // Files that would be repacked into a Lambda layer
+	FunctionFiles  []InspectedFile `json:"functionFiles"`     // Files that would be repacked into the function deployment package
+	RemovedFiles   []InspectedFile `json:"removedFiles"`      // Files left out because later layers replace or delete them, or the execution environment provides them
+	Whiteouts      []string        `json:"whiteouts"`         // Whiteout files, which are skipped
+	IgnoredEntries []InspectedFile `json:"ignoredEntries"`    // Entries under /opt or /var/task that are not repacked, like directories
+	OtherFileCount int             `json:"otherFileCount"`    // Files outside of /opt and /var/task
+}
+
+type InspectedFile struct {
+	Path string `json:"path"`
+	Type string `json:"type"`
+	Size int64  `json:"size"`
+}
+
+// Compares the Lambda layers and function deployment package that two container images would be repacked into
+type ImageDiff struct {
+	OldImage string       `json:"oldImage"`
+	NewImage string       `json:"newImage"`
+	Layers   []LayerDiff  `json:"layers"`
+	Function FunctionDiff `json:"function"`
+}
+
+const (
+	LayerUnchanged = "unchanged" // Same image layer and zip contents: the existing Lambda layer version would be matched
+	LayerNew       = "new"       // A new Lambda layer version would be published
+	LayerRemoved   = "removed"   // Only in the old image
+)
+
+type LayerDiff struct {
+	Digest     string `json:"digest"`
+	Part       int    `json:"part,omitempty"` // Only set if the image layer was split into several Lambda layers
+	Status     string `json:"status"`
+	CodeSha256 string `json:"codeSha256"`
+	CodeSize   int64  `json:"codeSize"`
+}
+
+type FunctionDiff struct {
+	Added          []string `json:"added"`
+	Removed        []string `json:"removed"`
+	Modified       []string `json:"modified"`
+	UnchangedCount int      `json:"unchangedCount"`
 }
 
 type CmdOptions struct {
-	Image              string   // Name of the container image
-	ImageType          string   // Type of the container image
-	Region             string   // AWS region
-	Profile            string   // AWS credentials profile
-	OutputDir          string   // Output directory for the Lambda layers
-	DryRun             bool     // Dry-run (will not register with Lambda)
-	LayerNamespace     string   // Prefix for published Lambda layers
-	Description        string   // Description of the current layer version
-	LicenseInfo        string   // Layer's software license
-	CompatibleRuntimes []string // A list of function runtimes compatible with the current layer
+	Image               string        // Name of the container image
+	ImageType           string        // Type of the container image
+	Region              string        // AWS region
+	Profile             string        // AWS credentials profile
+	OutputDir           string        // Output directory for the Lambda layers
+	DryRun              bool          // Dry-run (will not register with Lambda)
+	LayerNamespace      string        // Prefix for published Lambda layers
+	LayerNameTemplate   string        // Template for the names of published Lambda layers, replacing <namespace>-sha256-<hex>
+	Description         string        // Template for the description of the current layer version
+	LicenseInfo         string        // Layer's software license
+	CompatibleRuntimes  []string      // A list of function runtimes compatible with the current layer
+	SBOM                bool          // Write a software bill of materials for each layer and the function
+	SecretsAllowlist    string        // File listing potential secrets that are allowed to be packaged
+	FlattenWhiteouts    bool          // Merge layers to apply files deleted by later image layers
+	BaseImage           string        // Image that the image is built from, whose layers are not repacked
+	BaseLayersFile      string        // layers.json with the published layer versions of the base image
+	IncludeLayers       []string      // Only repack the image layers matching these selectors
+	MaxLayerSizeMB      int64         // Split Lambda layer files larger than this many megabytes, unless zero
+	SeparateExtensions  bool          // Move the files under /opt/extensions into a dedicated Lambda layer
+	BundleLibraries     bool          // Bundle the libraries of the image that repacked binaries need into a Lambda layer
+	PruneEnvironment    bool          // Do not repack files that the execution environment of the runtime provides
+	EnvironmentManifest string        // Manifest of the files of the execution environment, required for pruning them
+	KeepFiles           []string      // Patterns of files that are repacked even if the execution environment provides them
+	Runtime             string        // Runtime of the function, to check the repacked files against
+	Handler             string        // Handler of the function, to check that its file is repacked
+	HandlerFile         string        // Template for the path of the handler file, for custom runtimes
+	ExcludeLayers       []string      // Do not repack the image layers matching these selectors
+	PrependLayerArns    []string      // Existing layer versions listed before the layers of the image
+	AppendLayerArns     []string      // Existing layer versions listed after the layers of the image
+	OutputFormat        string        // Output format of the inspect command
+	LogFormat           string        // Log output format
+	Quiet               bool          // Only log warnings and errors
+	Verbose             bool          // Log debug messages, like why each file is or is not repacked
+	Timeout             time.Duration // Overall timeout of the command
+	KeepLayerZips       bool          // Keep the Lambda layer zip files in the output directory after publishing
+	Signatures          SignatureOptions
+	SigningProfile      string // AWS Signer signing profile for the function deployment package and layers
+	SigningBucket       string // Versioned S3 bucket for staging the files to sign and the signed files
+	Logger              *logging.Logger
+	Progress            *progress.Reporter
+}
+
+type ExtractOptions struct {
+	OutputDir           string
+	SBOM                bool
+	SecretsAllowlist    string
+	SystemContext       *imgtypes.SystemContext // Defaults to locating the Docker daemon with DOCKER_HOST
+	Signatures          SignatureOptions        // Signatures are only verified if a policy file or cosign key is given
+	FlattenWhiteouts    bool                    // Merge layers to apply files deleted by later image layers, instead of warning
+	BaseImage           string                  // Image whose layers are skipped, as a containers/image transport reference
+	IncludeLayers       []string                // Only repack the layers matching these selectors, see extract.LayerSelector
+	MaxLayerSize        int64                   // Split Lambda layer files larger than this many bytes into several files, unless zero
+	SeparateExtensions  bool                    // Move the files under /opt/extensions into a dedicated Lambda layer
+	BundleLibraries     bool                    // Bundle the libraries of the image that repacked ELF files need into a Lambda layer
+	PruneEnvironment    bool                    // Do not repack files that the execution environment of the runtime provides
+	Runtime             string                  // Runtime whose execution environment's files are pruned
+	EnvironmentManifest string                  // Manifest of the files of the execution environment, required for pruning them
+	KeepFiles           []string                // Patterns of files that are repacked even if the execution environment provides them
+	ExcludeLayers       []string                // Do not repack the layers matching these selectors
+	Logger              *logging.Logger
+	Progress            *progress.Reporter
 }
 
 type PublishOptions struct {
 	LambdaClient       lambdaiface.LambdaAPI
 	LayerPrefix        string
+	LayerNameTemplate  string
 	ResultsDir         string
 	SourceImageName    string
-	Description        string
+	ManifestDigest     string
+	BuildTime          time.Time // Defaults to the current time
+	Description        string    // Template for the layer version descriptions
 	LicenseInfo        string
 	CompatibleRuntimes []string
+	KeepLayerFiles     bool     // Keep the Lambda layer files after publishing them
+	BaseLayerArns      []string // Published layer versions of the base image, listed before the layers in the results files
+	PrependLayerArns   []string // Additional layer versions listed first in the results files
+	AppendLayerArns    []string // Additional layer versions listed last in the results files
+	Logger             *logging.Logger
+	Progress           *progress.Reporter
+}
+
+// Checks of the repacked function and layers against the runtime of the function
+type ValidationOptions struct {
+	Runtime             string // Runtime of the function, like python3.8 or provided. Nothing is checked without a runtime
+	Handler             string // Handler of the function, like hello.hello. Not checked if empty
+	HandlerFileTemplate string // Template for the path of the handler file, see validate.HandlerTemplateData
+	ExternalLayers      bool   // The function uses layers that were not repacked, so missing files are only warned about
+	Logger              *logging.Logger
+}
+
+type SigningOptions struct {
+	SignerClient   signeriface.SignerAPI
+	S3Client       s3iface.S3API
+	SigningProfile string
+	Bucket         string
+	Prefix         string // Prefix of the S3 keys of the files to sign and the signed files
+	Logger         *logging.Logger
+	Progress       *progress.Reporter
+}
+
+type LockVerifyOptions struct {
+	LambdaClients func(region string) lambdaiface.LambdaAPI // Lambda client for the layer versions in each region
+	SystemContext *imgtypes.SystemContext
+	Signatures    SignatureOptions
+	Logger        *logging.Logger
+}
+
+// Options of the conversion library. Layers are only published if a Lambda client is given.
+type ConverterOptions struct {
+	ImageType           string // Type of the container image, defaults to 'docker'
+	OutputDir           string // Output directory for the Lambda layers and function deployment package
+	SBOM                bool
+	SecretsAllowlist    string
+	FlattenWhiteouts    bool     // Merge layers to apply files deleted by later image layers, instead of warning
+	BaseImage           string   // Image of the same type whose layers are not repacked, because the image is built from it
+	BaseLayersFile      string   // layers.json with the published layer versions of the base image
+	IncludeLayers       []string // Only repack the image layers matching these selectors, see extract.LayerSelector
+	MaxLayerSize        int64    // Split Lambda layer files larger than this many bytes into several files, unless zero
+	SeparateExtensions  bool     // Move the files under /opt/extensions into a dedicated Lambda layer
+	BundleLibraries     bool     // Bundle the libraries of the image that repacked ELF files need into a Lambda layer
+	PruneEnvironment    bool     // Do not repack files that the execution environment of the runtime provides
+	EnvironmentManifest string   // Manifest of the files of the execution environment, required for pruning them
+	KeepFiles           []string // Patterns of files that are repacked even if the execution environment provides them
+	Runtime             string   // Runtime of the function, to check the repacked files against before publishing
+	Handler             string   // Handler of the function, to check that its file is repacked
+	HandlerFile         string   // Template for the path of the handler file, see validate.HandlerTemplateData
+	ExcludeLayers       []string // Do not repack the image layers matching these selectors
+	PrependLayerArns    []string // Existing layer versions listed before the layers of the image, like extensions
+	AppendLayerArns     []string // Existing layer versions listed after the layers of the image
+	SystemContext       *imgtypes.SystemContext
+	Signatures          SignatureOptions
+	LambdaClient        lambdaiface.LambdaAPI
+	LayerPrefix         string // Prefix for published Lambda layers, defaults to 'img2lambda'
+	LayerNameTemplate   string // Template for the names of published Lambda layers, see publish.LayerTemplateData
+	Description         string // Template for the layer version descriptions, see publish.LayerTemplateData
+	LicenseInfo         string
+	CompatibleRuntimes  []string
+	WriteResults        bool // Write conversion.json, layers.json, layers.yaml, img2lambda.lock and report.json to the output directory
+	KeepLayerFiles      bool // Keep the Lambda layer files after publishing them
+	SignerClient        signeriface.SignerAPI
+	S3Client            s3iface.S3API
+	SigningProfile      string // Files are only signed if a signing profile and Signer client are given
+	SigningBucket       string
+	Logger              *logging.Logger
+	Progress            *progress.Reporter
+}
+
+// Converts the options to the options of a conversion, with AWS clients unless this is a dry-run
+func ConvertToConverterOptions(opts *CmdOptions) *ConverterOptions {
+	converterOpts := ConvertToLocalConverterOptions(opts)
+	if !opts.DryRun {
+		converterOpts.LambdaClient = clients.NewLambdaClient(opts.Region, opts.Profile)
+		if opts.SigningProfile != "" {
+			converterOpts.SignerClient = clients.NewSignerClient(opts.Region, opts.Profile)
+			converterOpts.S3Client = clients.NewS3Client(opts.Region, opts.Profile)
+		}
+	}
+	return converterOpts
 }
 
-func ConvertToPublishOptions(opts *CmdOptions) *PublishOptions {
-	return &PublishOptions{
-		SourceImageName:    opts.Image,
-		LambdaClient:       clients.NewLambdaClient(opts.Region, opts.Profile),
-		LayerPrefix:        opts.LayerNamespace,
-		ResultsDir:         opts.OutputDir,
-		Description:        opts.Description,
-		LicenseInfo:        opts.LicenseInfo,
-		CompatibleRuntimes: opts.CompatibleRuntimes,
+// Converts the options to the options of a conversion without AWS clients, for commands
+// that read or repack the image like a conversion does, but do not publish anything
+func ConvertToLocalConverterOptions(opts *CmdOptions) *ConverterOptions {
+	return &ConverterOptions{
+		ImageType:           opts.ImageType,
+		OutputDir:           opts.OutputDir,
+		SBOM:                opts.SBOM,
+		SecretsAllowlist:    opts.SecretsAllowlist,
+		FlattenWhiteouts:    opts.FlattenWhiteouts,
+		BaseImage:           opts.BaseImage,
+		BaseLayersFile:      opts.BaseLayersFile,
+		IncludeLayers:       opts.IncludeLayers,
+		MaxLayerSize:        opts.MaxLayerSizeMB * 1000 * 1000,
+		SeparateExtensions:  opts.SeparateExtensions,
+		BundleLibraries:     opts.BundleLibraries,
+		PruneEnvironment:    opts.PruneEnvironment,
+		EnvironmentManifest: opts.EnvironmentManifest,
+		KeepFiles:           opts.KeepFiles,
+		Runtime:             opts.Runtime,
+		Handler:             opts.Handler,
+		HandlerFile:         opts.HandlerFile,
+		ExcludeLayers:       opts.ExcludeLayers,
+		PrependLayerArns:    opts.PrependLayerArns,
+		AppendLayerArns:     opts.AppendLayerArns,
+		Signatures:          opts.Signatures,
+		LayerPrefix:         opts.LayerNamespace,
+		LayerNameTemplate:   opts.LayerNameTemplate,
+		Description:         opts.Description,
+		LicenseInfo:         opts.LicenseInfo,
+		CompatibleRuntimes:  opts.CompatibleRuntimes,
+		WriteResults:        true,
+		KeepLayerFiles:      opts.KeepLayerZips,
+		SigningProfile:      opts.SigningProfile,
+		SigningBucket:       opts.SigningBucket,
+		Logger:              opts.Logger,
+		Progress:            opts.Progress,
 	}
 }
 
@@ -65,7 +504,7 @@ func (r Runtimes) Contains(runtime string) bool {
 	return false
 }
 
-// a list of aws supported runtimes as of 2020-06-18
+// a list of aws supported runtimes as of 2020-08-12
 var ValidRuntimes = Runtimes{
 	// eol'ed runtimes are included to support existing functions
 	"nodejs",         // eol
@@ -89,4 +528,5 @@ var ValidRuntimes = Runtimes{
 	"ruby2.5",
 	"ruby2.7",
 	"provided",
+	"provided.al2",
 }
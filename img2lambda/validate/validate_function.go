@@ -0,0 +1,243 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+// Package validate checks that Lambda could start the function from the repacked
+// deployment package and layers, before they are published.
+package validate
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
+)
+
+// Values available in handler file templates, like src/{{.Function}}.php
+type HandlerTemplateData struct {
+	Handler  string // Handler of the function, like hello.hello
+	Module   string // Handler up to its last dot, like hello
+	Function string // Handler after its last dot, like hello
+}
+
+func newHandlerTemplateData(handler string) *HandlerTemplateData {
+	data := &HandlerTemplateData{Handler: handler, Module: handler}
+	if i := strings.LastIndex(handler, "."); i >= 0 {
+		data.Module = handler[:i]
+		data.Function = handler[i+1:]
+	}
+	return data
+}
+
+// Parses the template for the path of the handler file, relative to /var/task unless it starts with /
+func ParseHandlerFileTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	t, err := template.New("handler-file").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid handler file template: %v", err)
+	}
+	if err := t.Execute(&bytes.Buffer{}, newHandlerTemplateData("file.handler")); err != nil {
+		return nil, fmt.Errorf("invalid handler file template: %v", err)
+	}
+	return t, nil
+}
+
+// Modes of the files of the function and its layers, by their path in the Lambda
+// execution environment without the leading slash, like var/task/hello.py or opt/bootstrap
+type fileTree map[string]os.FileMode
+
+// Lists the files as Lambda extracts them: the layers in order, where files of later layers
+// replace files of earlier layers, and the function deployment package in /var/task
+func readFileTree(image *types.RepackedImage) (fileTree, error) {
+	tree := fileTree{}
+	for _, layer := range image.Layers {
+		if err := tree.addZipFiles(layer.File, "opt"); err != nil {
+			return nil, err
+		}
+	}
+	if image.Function != nil && image.Function.FileCount > 0 {
+		if err := tree.addZipFiles(image.Function.File, "var/task"); err != nil {
+			return nil, err
+		}
+	}
+	return tree, nil
+}
+
+func (tree fileTree) addZipFiles(filename string, dir string) error {
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		tree[path.Join(dir, f.Name)] = f.Mode()
+	}
+	return nil
+}
+
+// Returns the first of the paths that is in the tree
+func (tree fileTree) find(paths []string) (string, bool) {
+	for _, p := range paths {
+		if _, found := tree[p]; found {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+func (tree fileTree) checkExecutable(p string) *problem {
+	mode := tree[p]
+	if mode&os.ModeSymlink == 0 && mode&0111 == 0 {
+		return &problem{message: fmt.Sprintf("/%s is not executable (mode %04o)", p, mode.Perm())}
+	}
+	return nil
+}
+
+type problem struct {
+	message string
+	missing bool // A file is missing, which might be in a layer that was not repacked
+}
+
+func isCustomRuntime(runtime string) bool {
+	return strings.HasPrefix(runtime, "provided")
+}
+
+// Checks that the function and its layers have the bootstrap file of custom runtimes, and the
+// file of the handler. Handler files are found by the conventions of the managed runtimes, or the
+// handler file template. Without a runtime, nothing is checked.
+func ValidateFunction(image *types.RepackedImage, opts *types.ValidationOptions) error {
+	if opts.Runtime == "" {
+		return nil
+	}
+
+	handlerFile, err := ParseHandlerFileTemplate(opts.HandlerFileTemplate)
+	if err != nil {
+		return err
+	}
+
+	tree, err := readFileTree(image)
+	if err != nil {
+		return err
+	}
+
+	var problems []*problem
+	if isCustomRuntime(opts.Runtime) {
+		problems = append(problems, checkBootstrap(tree, opts.Runtime)...)
+	}
+
+	if opts.Handler != "" {
+		candidates, executable, err := handlerFiles(opts.Runtime, opts.Handler, handlerFile)
+		if err != nil {
+			return err
+		}
+		if candidates == nil && isCustomRuntime(opts.Runtime) {
+			opts.Logger.Warnf("Not checking the file of handler %s, because the %s runtime loads handlers in its own way. "+
+				"Describe the handler file with a template like 'src/{{.Function}}.php' to check it", opts.Handler, opts.Runtime)
+		} else if candidates == nil {
+			opts.Logger.Infof("Not checking the files of handler %s, because img2lambda does not know where the %s runtime loads it from", opts.Handler, opts.Runtime)
+		} else {
+			problems = append(problems, checkHandler(tree, opts.Handler, candidates, executable)...)
+		}
+	}
+
+	var messages []string
+	for _, p := range problems {
+		if p.missing && opts.ExternalLayers {
+			opts.Logger.Warnf("%s, so it must be in the layers of the base image or the additional layers", p.message)
+			continue
+		}
+		messages = append(messages, p.message)
+	}
+	if len(messages) > 0 {
+		return fmt.Errorf("the function would fail to start with runtime %s:\n  %s", opts.Runtime, strings.Join(messages, "\n  "))
+	}
+
+	opts.Logger.Infof("Checked the function files for runtime %s", opts.Runtime)
+	return nil
+}
+
+// Custom runtimes run /var/task/bootstrap, or /opt/bootstrap if the function has none
+func checkBootstrap(tree fileTree, runtime string) []*problem {
+	bootstrap, found := tree.find([]string{"var/task/bootstrap", "opt/bootstrap"})
+	if !found {
+		return []*problem{{
+			message: fmt.Sprintf("the %s runtime runs /var/task/bootstrap or /opt/bootstrap, but neither is in the function or its layers", runtime),
+			missing: true,
+		}}
+	}
+	if p := tree.checkExecutable(bootstrap); p != nil {
+		return []*problem{p}
+	}
+	return nil
+}
+
+func checkHandler(tree fileTree, handler string, candidates []string, executable bool) []*problem {
+	file, found := tree.find(candidates)
+	if !found {
+		var paths []string
+		for _, c := range candidates {
+			paths = append(paths, "/"+c)
+		}
+		return []*problem{{
+			message: fmt.Sprintf("handler %s needs one of %s, but none is in the function or its layers", handler, strings.Join(paths, ", ")),
+			missing: true,
+		}}
+	}
+	if executable {
+		if p := tree.checkExecutable(file); p != nil {
+			return []*problem{p}
+		}
+	}
+	return nil
+}
+
+// Paths that the runtime could load the handler from, any of which is enough, and whether the file must be executable.
+// Returns no paths if the runtime's handler files are not known.
+func handlerFiles(runtime string, handler string, handlerFile *template.Template) ([]string, bool, error) {
+	if handlerFile != nil {
+		var b bytes.Buffer
+		if err := handlerFile.Execute(&b, newHandlerTemplateData(handler)); err != nil {
+			return nil, false, fmt.Errorf("invalid handler file template: %v", err)
+		}
+		name := b.String()
+		if strings.HasPrefix(name, "/") {
+			return []string{path.Clean(strings.TrimPrefix(name, "/"))}, false, nil
+		}
+		return []string{path.Join("var/task", name)}, false, nil
+	}
+
+	data := newHandlerTemplateData(handler)
+	switch {
+	case strings.HasPrefix(runtime, "python"):
+		// Like hello.hello or package.module.function
+		module := strings.Replace(data.Module, ".", "/", -1)
+		var files []string
+		for _, dir := range []string{"var/task", "opt/python", "opt/python/lib/" + runtime + "/site-packages"} {
+			files = append(files, path.Join(dir, module+".py"), path.Join(dir, module+".pyc"), path.Join(dir, module, "__init__.py"))
+		}
+		return files, false, nil
+	case strings.HasPrefix(runtime, "nodejs"):
+		// Like index.handler or dir/index.handler
+		var files []string
+		for _, ext := range []string{".js", ".mjs", ".cjs"} {
+			files = append(files, path.Join("var/task", data.Module+ext))
+		}
+		return files, false, nil
+	case strings.HasPrefix(runtime, "ruby"):
+		// Like function.handler or function.Module::Class.method
+		file := strings.SplitN(handler, ".", 2)[0]
+		return []string{path.Join("var/task", file+".rb")}, false, nil
+	case runtime == "go1.x":
+		// Name of the executable
+		return []string{path.Join("var/task", handler)}, true, nil
+	default:
+		return nil, false, nil
+	}
+}
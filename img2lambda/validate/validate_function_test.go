@@ -0,0 +1,182 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+package validate
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/logging"
+	"github.com/awslabs/aws-lambda-container-image-converter/img2lambda/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Writes a zip file with empty files and the given modes
+func writeZip(t *testing.T, dir string, name string, files map[string]os.FileMode) string {
+	filename := filepath.Join(dir, name)
+	out, err := os.Create(filename)
+	require.NoError(t, err)
+	defer out.Close()
+
+	w := zip.NewWriter(out)
+	for name, mode := range files {
+		header := &zip.FileHeader{Name: name}
+		header.SetMode(mode)
+		_, err := w.CreateHeader(header)
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return filename
+}
+
+// Image with the PHP runtime of the example in a layer and the functions in the deployment package
+func examplePHPImage(t *testing.T, dir string, bootstrapMode os.FileMode) *types.RepackedImage {
+	return &types.RepackedImage{
+		Layers: []types.LambdaLayer{
+			{File: writeZip(t, dir, "layer-1.zip", map[string]os.FileMode{"bootstrap": bootstrapMode, "bin/php": 0755})},
+		},
+		Function: &types.LambdaDeploymentPackage{
+			FileCount: 2,
+			File:      writeZip(t, dir, "function.zip", map[string]os.FileMode{"src/hello.php": 0644, "src/goodbye.php": 0644}),
+		},
+	}
+}
+
+func mustParseHandlerFileTemplate(t *testing.T, text string) *template.Template {
+	tmpl, err := ParseHandlerFileTemplate(text)
+	require.NoError(t, err)
+	return tmpl
+}
+
+func TestValidateCustomRuntime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	image := examplePHPImage(t, dir, 0555)
+	opts := &types.ValidationOptions{Runtime: "provided", Handler: "hello.hello", HandlerFileTemplate: "src/{{.Function}}.php"}
+	assert.NoError(t, ValidateFunction(image, opts))
+
+	// Without a handler file template, only the bootstrap is checked, with a warning
+	var out bytes.Buffer
+	opts = &types.ValidationOptions{Runtime: "provided", Handler: "anything", Logger: logging.New(&out, logging.LevelInfo, logging.FormatText)}
+	assert.NoError(t, ValidateFunction(image, opts))
+	assert.Contains(t, out.String(), "Not checking the file of handler anything, because the provided runtime loads handlers in its own way")
+
+	// The example PHP runtime loads the handler hello.hello from src/hello.php
+	opts = &types.ValidationOptions{Runtime: "provided.al2", Handler: "hello.hello", HandlerFileTemplate: "src/{{.Function}}.php"}
+	candidates, executable, err := handlerFiles(opts.Runtime, opts.Handler, mustParseHandlerFileTemplate(t, opts.HandlerFileTemplate))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"var/task/src/hello.php"}, candidates)
+	assert.False(t, executable)
+	assert.NoError(t, ValidateFunction(image, opts))
+
+	opts = &types.ValidationOptions{Runtime: "provided", Handler: "hello.missing", HandlerFileTemplate: "src/{{.Function}}.php"}
+	err = ValidateFunction(image, opts)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "handler hello.missing needs one of /var/task/src/missing.php, but none is in the function or its layers")
+
+	opts = &types.ValidationOptions{Runtime: "provided", Handler: "hello.hello", HandlerFileTemplate: "/opt/bin/{{.Module}}"}
+	err = ValidateFunction(image, opts)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "needs one of /opt/bin/hello,")
+}
+
+func TestValidateBootstrap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	opts := &types.ValidationOptions{Runtime: "provided"}
+	err = ValidateFunction(examplePHPImage(t, dir, 0644), opts)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the function would fail to start with runtime provided:\n  /opt/bootstrap is not executable (mode 0644)")
+
+	// The bootstrap of the function deployment package is run instead of the one in the layers
+	image := examplePHPImage(t, dir, 0644)
+	image.Function.File = writeZip(t, dir, "function.zip", map[string]os.FileMode{"bootstrap": 0755})
+	assert.NoError(t, ValidateFunction(image, opts))
+
+	image.Layers = nil
+	image.Function.File = writeZip(t, dir, "function.zip", map[string]os.FileMode{"hello.php": 0644})
+	err = ValidateFunction(image, opts)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the provided runtime runs /var/task/bootstrap or /opt/bootstrap, but neither is in the function or its layers")
+
+	// Missing files may be in layers that were not repacked
+	var out bytes.Buffer
+	opts = &types.ValidationOptions{Runtime: "provided", ExternalLayers: true, Logger: logging.New(&out, logging.LevelInfo, logging.FormatText)}
+	assert.NoError(t, ValidateFunction(image, opts))
+	assert.Contains(t, out.String(), "WARN")
+	assert.Contains(t, out.String(), "must be in the layers of the base image or the additional layers")
+}
+
+func TestValidateManagedRuntimes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	image := &types.RepackedImage{
+		Layers: []types.LambdaLayer{
+			{File: writeZip(t, dir, "layer-1.zip", map[string]os.FileMode{"python/shared/util.py": 0644})},
+		},
+		Function: &types.LambdaDeploymentPackage{
+			FileCount: 5,
+			File: writeZip(t, dir, "function.zip", map[string]os.FileMode{
+				"hello.py":            0644,
+				"pkg/app/__init__.py": 0644,
+				"handlers/index.js":   0644,
+				"function.rb":         0644,
+				"main":                0644,
+			}),
+		},
+	}
+
+	valid := map[string][]string{
+		"python3.8":  {"hello.hello", "pkg.app.handler", "shared.util.handler"},
+		"nodejs12.x": {"handlers/index.handler"},
+		"ruby2.7":    {"function.handler", "function.Module::Class.method"},
+		"java11":     {"example.Handler::handleRequest"},
+	}
+	for runtime, handlers := range valid {
+		for _, handler := range handlers {
+			assert.NoError(t, ValidateFunction(image, &types.ValidationOptions{Runtime: runtime, Handler: handler}), "%s %s", runtime, handler)
+		}
+	}
+
+	err = ValidateFunction(image, &types.ValidationOptions{Runtime: "python3.8", Handler: "missing.handler"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "handler missing.handler needs one of /var/task/missing.py, /var/task/missing.pyc, /var/task/missing/__init__.py, /opt/python/missing.py")
+
+	err = ValidateFunction(image, &types.ValidationOptions{Runtime: "nodejs12.x", Handler: "index.handler"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "handler index.handler needs one of /var/task/index.js, /var/task/index.mjs, /var/task/index.cjs")
+
+	err = ValidateFunction(image, &types.ValidationOptions{Runtime: "go1.x", Handler: "main"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "/var/task/main is not executable (mode 0644)")
+}
+
+func TestValidateWithoutRuntime(t *testing.T) {
+	assert.NoError(t, ValidateFunction(&types.RepackedImage{}, &types.ValidationOptions{Handler: "hello.hello"}))
+}
+
+func TestParseHandlerFileTemplate(t *testing.T) {
+	template, err := ParseHandlerFileTemplate("")
+	assert.NoError(t, err)
+	assert.Nil(t, template)
+
+	_, err = ParseHandlerFileTemplate("src/{{.Function")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid handler file template")
+
+	_, err = ParseHandlerFileTemplate("src/{{.Unknown}}.php")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid handler file template")
+}